@@ -0,0 +1,292 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ClarkLabUVA/mds/pkg/identifier"
+)
+
+const usage = `usage: mds [command] [flags]
+
+Run without a command to start the server.
+
+Commands:
+  export    write every identifier in a namespace to a file or stdout
+  import    load an NDJSON or JSON-LD dump into a namespace, keeping its ARKs
+  migrate-urls
+            rewrite the url of identifiers after MDS_BASE_URL or a url template changes
+  index-references
+            record the references of identifiers written before references were recorded
+`
+
+// runCommand dispatches a command line subcommand and returns the process exit code
+func runCommand(command string, args []string) int {
+
+	switch command {
+	case "export":
+		return runExport(args)
+
+	case "import":
+		return runImport(args)
+
+	case "migrate-urls":
+		return runMigrateURLs(args)
+
+	case "index-references":
+		return runIndexReferences(args)
+
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return 0
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		return 2
+	}
+}
+
+// connectMongo connects the configured backend to mongo, the returned function disconnects it
+func connectMongo() (disconnect func(), err error) {
+
+	server.Mongo.Client, err = server.Mongo.Connect(context.Background())
+	if err != nil {
+		return
+	}
+
+	disconnect = func() {
+		server.Mongo.Client.Disconnect(context.Background())
+	}
+
+	return
+}
+
+func runExport(args []string) int {
+
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", identifier.ExportNDJSON, "output format, ndjson or jsonld")
+	since := flags.String("since", "", "only export identifiers modified at or after this RFC3339 timestamp or date")
+	output := flags.String("o", "", "file to write the export to, defaults to stdout")
+
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: mds export [flags] ark:{prefix}")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	namespace := "ark:" + strings.TrimPrefix(strings.TrimPrefix(flags.Arg(0), "ark:"), "/")
+
+	var sinceTime time.Time
+	if *since != "" {
+		var err error
+		sinceTime, err = identifier.ParseSince(*since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid since %q: must be an RFC3339 timestamp or a date\n", *since)
+			return 2
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create %s: %s\n", *output, err.Error())
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	disconnect, err := connectMongo()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed connecting to mongo: %s\n", err.Error())
+		return 1
+	}
+	defer disconnect()
+
+	buffered := bufio.NewWriter(out)
+	count, err := server.ExportNamespace(context.Background(), namespace, *format, sinceTime, buffered)
+	if flushErr := buffered.Flush(); err == nil {
+		err = flushErr
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export of %s failed after %d identifiers: %s\n", namespace, count, err.Error())
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d identifiers from %s\n", count, namespace)
+	return 0
+}
+
+func runImport(args []string) int {
+
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	policy := flags.String("policy", identifier.ImportFail, "what to do with identifiers that already exist, skip, overwrite or fail")
+	dryRun := flags.Bool("dry-run", false, "validate the dump and report what would be imported without writing anything")
+	input := flags.String("i", "", "file to read the dump from, defaults to stdin")
+
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: mds import [flags] ark:{prefix}")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	namespace := "ark:" + strings.TrimPrefix(strings.TrimPrefix(flags.Arg(0), "ark:"), "/")
+
+	var in io.Reader = os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open %s: %s\n", *input, err.Error())
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	disconnect, err := connectMongo()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed connecting to mongo: %s\n", err.Error())
+		return 1
+	}
+	defer disconnect()
+
+	report, err := server.ImportNamespace(namespace, bufio.NewReader(in), *policy, *dryRun, identifier.User{})
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import into %s failed: %s\n", namespace, err.Error())
+		return 1
+	}
+
+	if report.Failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func runMigrateURLs(args []string) int {
+
+	flags := flag.NewFlagSet("migrate-urls", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list the urls that would change without writing anything")
+
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: mds migrate-urls [flags] [ark:{prefix}]")
+		fmt.Fprintln(flags.Output(), "identifiers in every namespace are migrated when no namespace is given")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var namespace string
+	if flags.NArg() == 1 {
+		namespace = "ark:" + strings.TrimPrefix(strings.TrimPrefix(flags.Arg(0), "ark:"), "/")
+	}
+
+	disconnect, err := connectMongo()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed connecting to mongo: %s\n", err.Error())
+		return 1
+	}
+	defer disconnect()
+
+	changes, err := server.MigrateURLs(context.Background(), namespace, *dryRun)
+
+	for _, change := range changes {
+		fmt.Fprintf(os.Stdout, "%s\t%s\t%s\n", change.ID, change.Old, change.New)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "url migration failed after %d identifiers: %s\n", len(changes), err.Error())
+		return 1
+	}
+
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "%d identifiers would be migrated\n", len(changes))
+	} else {
+		fmt.Fprintf(os.Stderr, "migrated %d identifiers\n", len(changes))
+	}
+
+	return 0
+}
+
+func runIndexReferences(args []string) int {
+
+	flags := flag.NewFlagSet("index-references", flag.ContinueOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: mds index-references")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	disconnect, err := connectMongo()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed connecting to mongo: %s\n", err.Error())
+		return 1
+	}
+	defer disconnect()
+
+	if err = server.EnsureReferenceIndex(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create the reference index: %s\n", err.Error())
+		return 1
+	}
+
+	count, err := server.IndexReferences(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "indexing references failed after %d identifiers: %s\n", count, err.Error())
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "indexed the references of %d identifiers\n", count)
+	return 0
+}
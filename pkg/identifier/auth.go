@@ -122,7 +122,7 @@ func AuthMiddleware (next http.Handler) http.Handler {
         // read bearer token from request
         var authToken string
 
-        authToken = r.Header.Get("Authorization")
+        authToken = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 
         // if bearer token doesn't exist
         if authToken == "" {
@@ -131,8 +131,8 @@ func AuthMiddleware (next http.Handler) http.Handler {
             authCookie, err := r.Cookie("fairscapeAuth") 
 
             if err != nil {
-                w.Write([]byte(`{"error": "request missing authorization token"}`))
                 w.WriteHeader(403)
+                w.Write([]byte(`{"error": "request missing authorization token"}`))
                 return
             }
 
@@ -157,8 +157,8 @@ func AuthMiddleware (next http.Handler) http.Handler {
                 Msg("Error Parsing Token")
 
             
-            w.Write([]byte(`{"message": "invalid token", "error": "`+ err.Error() + `"}`))        
             w.WriteHeader(401)
+            w.Write([]byte(`{"message": "invalid token", "error": "`+ err.Error() + `"}`))
             return
         }
 
@@ -198,13 +198,41 @@ func AuthMiddleware (next http.Handler) http.Handler {
 }
 
 
+// OptionalAuthMiddleware authenticates requests that carry a token the same as AuthMiddleware,
+// and lets requests without one through as the zero User, so that public reads need no token.
+// A token that is present but invalid is still refused.
+func OptionalAuthMiddleware (next http.Handler) http.Handler {
+
+    authenticated := AuthMiddleware(next)
+
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+        if r.Header.Get("Authorization") == "" {
+            if _, err := r.Cookie("fairscapeAuth"); err != nil {
+                next.ServeHTTP(w, r)
+                return
+            }
+        }
+
+        authenticated.ServeHTTP(w, r)
+    })
+}
+
+//userFromRequest returns the user AuthMiddleware placed in the request context,
+//or the zero User when the request was not authenticated
+func userFromRequest(r *http.Request) (u User) {
+    u, _ = r.Context().Value("user").(User)
+    return
+}
+
+
 //Resource is the struct for the 
 type Resource struct {
 	ID    	string `json:"@id" bson:"@id"`
 	Type  	string `json:"@type" bson:"@type"` 
 	Owner 	string `json:"owner" bson:"owner"`
 	Users 	[]string `json:"users" bson:"users"`
-	Groups 	[]string `json:"groups" bson: "groups"`
+	Groups 	[]string `json:"groups" bson:"groups"`
 }
 
 //AuthGetACL queries the ACL for the specified resource at the auth service
@@ -0,0 +1,54 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestOptionalAuth(t *testing.T) {
+
+	var seen User
+	handler := OptionalAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = userFromRequest(r)
+	}))
+
+	serve := func(authorization string) int {
+		seen = User{}
+		req := httptest.NewRequest("GET", "/ark:99999/test", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(""); code != 200 || seen.ID != "" {
+		t.Fatalf("Anonymous Request was not Passed Through: %d %+v", code, seen)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &UserTokenClaims{
+		Role:           "user",
+		StandardClaims: jwt.StandardClaims{Subject: "https://orcid.org/0000-0000-0000-0000"},
+	}).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatalf("Failed to Sign Token: %s", err.Error())
+	}
+
+	if code := serve("Bearer " + token); code != 200 || seen.ID != "https://orcid.org/0000-0000-0000-0000" || seen.Role != "user" {
+		t.Fatalf("User of the Token was not Identified: %d %+v", code, seen)
+	}
+
+	if code := serve("Bearer not a token"); code != 401 {
+		t.Fatalf("Invalid Token was Accepted: %d", code)
+	}
+}
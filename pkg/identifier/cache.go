@@ -0,0 +1,259 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the number of rendered responses the resolve cache holds when none is configured
+const DefaultCacheSize = 10000
+
+// ResolveCache is a bounded LRU of rendered resolve responses, keyed by canonical ARK and representation.
+// It is safe for concurrent use, and a nil cache caches nothing.
+type ResolveCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[cacheKey]*list.Element
+	// byID indexes the cached representations of each identifier, so they are invalidated together
+	byID map[string]map[cacheKey]bool
+	// generation counts invalidations, a response read before an invalidation is not cached after it
+	generation uint64
+}
+
+type cacheKey struct {
+	guid           string
+	representation string
+}
+
+type cacheEntry struct {
+	key cacheKey
+	res Resolution
+}
+
+// NewResolveCache returns a cache holding up to capacity responses
+func NewResolveCache(capacity int) *ResolveCache {
+
+	return &ResolveCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[cacheKey]*list.Element),
+		byID:     make(map[string]map[cacheKey]bool),
+	}
+}
+
+// canonicalARK normalizes the forms an ARK can be written in, ark:/99999/x and ark:99999/x are the same identifier
+func canonicalARK(guid string) string {
+
+	if len(guid) >= 4 && strings.EqualFold(guid[:4], "ark:") {
+		guid = "ark:" + strings.TrimPrefix(guid[4:], "/")
+	}
+
+	return guid
+}
+
+// representation identifies the response resolve options produce, the order fields are listed in doesn't matter
+func (opt ResolveOptions) representation() string {
+
+	fields := append([]string(nil), opt.Fields...)
+	sort.Strings(fields)
+
+	return opt.Format + "|" + strings.Join(fields, ",")
+}
+
+// Get returns the cached response for a representation of guid
+func (c *ResolveCache) Get(guid string, representation string) (res Resolution, ok bool) {
+
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[cacheKey{canonicalARK(guid), representation}]
+	if !ok {
+		return
+	}
+
+	c.order.MoveToFront(elem)
+
+	return elem.Value.(*cacheEntry).res, true
+}
+
+// Info returns the validators of any cached representation of guid, they are the same for all of them
+func (c *ResolveCache) Info(guid string) (info CacheInfo, ok bool) {
+
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.byID[canonicalARK(guid)] {
+		return c.entries[key].Value.(*cacheEntry).res.CacheInfo, true
+	}
+
+	return
+}
+
+// Generation is read before the record of a response is, and passed to Add with the response
+func (c *ResolveCache) Generation() uint64 {
+
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// Add caches a response, unless something was invalidated since generation was read, evicting the least recently
+// used responses beyond the capacity
+func (c *ResolveCache) Add(guid string, representation string, res Resolution, generation uint64) {
+
+	if c == nil || c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	key := cacheKey{canonicalARK(guid), representation}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).res = res
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, res: res})
+	if c.byID[key.guid] == nil {
+		c.byID[key.guid] = make(map[cacheKey]bool)
+	}
+	c.byID[key.guid][key] = true
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+// Invalidate drops every cached representation of guid, or of every identifier in guid when it is a namespace
+func (c *ResolveCache) Invalidate(guid string) {
+
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	guid = canonicalARK(guid)
+
+	if !isNamespace(guid) {
+		for key := range c.byID[guid] {
+			c.remove(c.entries[key])
+		}
+		return
+	}
+
+	for id, keys := range c.byID {
+		if strings.HasPrefix(id, guid+"/") {
+			for key := range keys {
+				c.remove(c.entries[key])
+			}
+		}
+	}
+}
+
+// Purge drops every cached response
+func (c *ResolveCache) Purge() {
+
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.order.Init()
+	c.entries = make(map[cacheKey]*list.Element)
+	c.byID = make(map[string]map[cacheKey]bool)
+}
+
+// Len is the number of cached responses
+func (c *ResolveCache) Len() int {
+
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *ResolveCache) remove(elem *list.Element) {
+
+	key := c.order.Remove(elem).(*cacheEntry).key
+	delete(c.entries, key)
+
+	delete(c.byID[key.guid], key)
+	if len(c.byID[key.guid]) == 0 {
+		delete(c.byID, key.guid)
+	}
+}
+
+// WatchInvalidations invalidates cached responses as records change in mongo, including changes written by other
+// replicas, until ctx is done. Change streams need mongo to run as a replica set. Whenever the stream has to be
+// reopened, after waiting retry, the whole cache is purged since changes may have been missed.
+func (b *Backend) WatchInvalidations(ctx context.Context, retry time.Duration) {
+
+	for {
+		err := b.Mongo.WatchChanges(ctx, func(id string) {
+			if id == "" {
+				b.Cache.Purge()
+				return
+			}
+			b.Cache.Invalidate(id)
+		})
+
+		b.Cache.Purge()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "WatchInvalidations").
+			Dur("retry", retry).
+			Msg("change stream closed, cache purged")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
@@ -0,0 +1,109 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"testing"
+)
+
+func TestResolveCache(t *testing.T) {
+
+	resolution := func(body string, rev int64) Resolution {
+		return Resolution{Body: []byte(body), CacheInfo: CacheInfo{Revision: rev}}
+	}
+
+	t.Run("Keys", func(t *testing.T) {
+
+		cache := NewResolveCache(10)
+		rep := ResolveOptions{Format: FormatCompacted, Fields: []string{"name", "author"}}.representation()
+
+		cache.Add("ark:/99999/test", rep, resolution(`{"name": "test"}`, 1), cache.Generation())
+
+		if _, ok := cache.Get("ARK:99999/test", rep); !ok {
+			t.Fatalf("Equivalent ARK Missed the Cache")
+		}
+
+		reordered := ResolveOptions{Format: FormatCompacted, Fields: []string{"author", "name"}}.representation()
+		if reordered != rep {
+			t.Fatalf("Field Order Changed the Representation: %s %s", rep, reordered)
+		}
+
+		if _, ok := cache.Get("ark:99999/test", ResolveOptions{Format: FormatCompacted}.representation()); ok {
+			t.Fatalf("Different Representation Hit the Cache")
+		}
+
+		if info, ok := cache.Info("ark:99999/test"); !ok || info.Revision != 1 {
+			t.Fatalf("Incorrect Cached Validators: %+v %t", info, ok)
+		}
+	})
+
+	t.Run("Eviction", func(t *testing.T) {
+
+		cache := NewResolveCache(2)
+		cache.Add("ark:99999/a", "", resolution("a", 1), cache.Generation())
+		cache.Add("ark:99999/b", "", resolution("b", 1), cache.Generation())
+
+		// reading a makes b the least recently used
+		cache.Get("ark:99999/a", "")
+		cache.Add("ark:99999/c", "", resolution("c", 1), cache.Generation())
+
+		if _, ok := cache.Get("ark:99999/b", ""); ok {
+			t.Fatalf("Least Recently Used Response was not Evicted")
+		}
+		if _, ok := cache.Get("ark:99999/a", ""); !ok || cache.Len() != 2 {
+			t.Fatalf("Incorrect Eviction, %d Cached", cache.Len())
+		}
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+
+		cache := NewResolveCache(10)
+		cache.Add("ark:99999/a", "", resolution("a", 1), cache.Generation())
+		cache.Add("ark:99999/a", "json", resolution("a", 1), cache.Generation())
+		cache.Add("ark:99999/b", "", resolution("b", 1), cache.Generation())
+		cache.Add("ark:11111/c", "", resolution("c", 1), cache.Generation())
+
+		cache.Invalidate("ark:/99999/a")
+		if _, ok := cache.Info("ark:99999/a"); ok || cache.Len() != 2 {
+			t.Fatalf("Identifier was not Invalidated, %d Cached", cache.Len())
+		}
+
+		cache.Invalidate("ark:99999")
+		if _, ok := cache.Get("ark:99999/b", ""); ok {
+			t.Fatalf("Namespace Invalidation Kept an Identifier")
+		}
+		if _, ok := cache.Get("ark:11111/c", ""); !ok {
+			t.Fatalf("Namespace Invalidation Dropped Another Namespace")
+		}
+
+		// a response read before an invalidation isn't cached after it
+		generation := cache.Generation()
+		cache.Invalidate("ark:99999/d")
+		cache.Add("ark:99999/d", "", resolution("d", 1), generation)
+		if _, ok := cache.Get("ark:99999/d", ""); ok {
+			t.Fatalf("Stale Response was Cached")
+		}
+
+		cache.Purge()
+		if cache.Len() != 0 {
+			t.Fatalf("Purge Kept %d Responses", cache.Len())
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+
+		var cache *ResolveCache
+		cache.Add("ark:99999/a", "", resolution("a", 1), cache.Generation())
+		cache.Invalidate("ark:99999/a")
+		cache.Purge()
+
+		if _, ok := cache.Get("ark:99999/a", ""); ok || cache.Len() != 0 {
+			t.Fatalf("Nil Cache Cached a Response")
+		}
+	})
+
+}
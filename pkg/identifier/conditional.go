@@ -0,0 +1,145 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/buger/jsonparser"
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultCacheControl lets caches store resolved identifiers, but has them revalidate before every reuse
+const DefaultCacheControl = "no-cache"
+
+// CacheInfo is what caches store and revalidate a resolved identifier by
+type CacheInfo struct {
+	// Revision is the revision of the identifier, its ETag
+	Revision int64
+	// LastModified is when the identifier was last updated, or minted, the zero time when unknown
+	LastModified time.Time
+	// CacheControl is the Cache-Control the namespace policy sets
+	CacheControl string
+	// Embargoed is set while the identifier is embargoed, what it resolves to then depends on the user
+	Embargoed bool
+}
+
+// validatorFields are the properties of a record CacheInfo is read from
+var validatorFields = []string{"_rev", "dateModified", "sdPublicationDate", "_embargo"}
+
+// IdentifierCacheInfo reads what caches revalidate an identifier by, from the resolve cache or else without reading
+// its metadata
+func (b *Backend) IdentifierCacheInfo(guid string) (info CacheInfo, err error) {
+
+	if info, ok := b.Cache.Info(guid); ok {
+		return info, nil
+	}
+
+	record, err := b.Mongo.FindOne(bson.D{{"_id", guid}}, validatorFields...)
+	if err != nil {
+		return
+	}
+
+	return b.cacheInfo(guid, record)
+}
+
+// cacheInfo reads the validators of a record of guid, along with the Cache-Control of its namespace
+func (b *Backend) cacheInfo(guid string, record []byte) (info CacheInfo, err error) {
+
+	info.Revision = recordRevision(record)
+	info.LastModified = recordLastModified(record)
+
+	// responses that depend on the user are kept out of shared caches
+	if info.Embargoed, _ = recordEmbargoed(record, time.Now()); info.Embargoed {
+		info.CacheControl = "private, no-store"
+		return
+	}
+
+	info.CacheControl, err = b.namespaceCacheControl(strings.Split(guid, "/")[0])
+
+	return
+}
+
+// namespaceCacheControl returns the Cache-Control set by the policy of a namespace
+func (b *Backend) namespaceCacheControl(namespace string) (string, error) {
+
+	record, err := b.Mongo.FindOne(bson.D{{"_id", namespace}}, "policy")
+	if err == mongo.ErrNoDocuments {
+		return DefaultCacheControl, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	policy, err := parseNamespacePolicy(record)
+	if err != nil || policy.CacheControl == "" {
+		return DefaultCacheControl, err
+	}
+
+	return policy.CacheControl, nil
+}
+
+// recordLastModified reads when a record was last changed, from dateModified or else sdPublicationDate
+func recordLastModified(record []byte) time.Time {
+
+	for _, field := range []string{"dateModified", "sdPublicationDate"} {
+		value, err := jsonparser.GetString(record, field)
+		if err != nil {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return t.UTC().Truncate(time.Second)
+		}
+	}
+
+	return time.Time{}
+}
+
+// notModified evaluates the If-None-Match and If-Modified-Since headers of a GET against the validators of an
+// identifier. If-Modified-Since is only considered without If-None-Match.
+func notModified(r *http.Request, info CacheInfo) bool {
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+
+		etag := ETag(info.Revision)
+		for _, tag := range strings.Split(match, ",") {
+			// the weak comparison, W/ is ignored
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if since := r.Header.Get("If-Modified-Since"); since != "" && !info.LastModified.IsZero() {
+		t, err := http.ParseTime(since)
+		return err == nil && !info.LastModified.After(t)
+	}
+
+	return false
+}
+
+// setCacheHeaders writes the caching headers of a resolve response, validators are left out when tagged is false
+func setCacheHeaders(w http.ResponseWriter, info CacheInfo, tagged bool) {
+
+	w.Header().Set("Cache-Control", info.CacheControl)
+	w.Header().Set("Vary", "Accept")
+
+	if !tagged {
+		return
+	}
+
+	w.Header().Set("ETag", ETag(info.Revision))
+	if !info.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", info.LastModified.Format(http.TimeFormat))
+	}
+}
@@ -0,0 +1,94 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConditional(t *testing.T) {
+
+	modified := time.Date(2020, 6, 1, 12, 30, 0, 0, time.UTC)
+	info := CacheInfo{Revision: 3, LastModified: modified, CacheControl: "public, max-age=60"}
+
+	t.Run("LastModified", func(t *testing.T) {
+
+		record := []byte(`{"sdPublicationDate": "2020-05-01T08:00:00.123-04:00", "dateModified": "2020-06-01T12:30:00.5Z"}`)
+		if lm := recordLastModified(record); !lm.Equal(modified) {
+			t.Fatalf("Last-Modified should come from dateModified: %s", lm)
+		}
+
+		record = []byte(`{"sdPublicationDate": "2020-05-01T08:00:00.123-04:00"}`)
+		if lm := recordLastModified(record); !lm.Equal(time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Fatalf("Last-Modified should fall back to sdPublicationDate: %s", lm)
+		}
+
+		if lm := recordLastModified([]byte(`{"dateModified": "yesterday"}`)); !lm.IsZero() {
+			t.Fatalf("Unparseable Dates should give no Last-Modified: %s", lm)
+		}
+	})
+
+	t.Run("NotModified", func(t *testing.T) {
+
+		cases := []struct {
+			header, value string
+			expected      bool
+		}{
+			{"If-None-Match", `"3"`, true},
+			{"If-None-Match", `"2", W/"3"`, true},
+			{"If-None-Match", `*`, true},
+			{"If-None-Match", `"2"`, false},
+			{"If-Modified-Since", modified.Format(http.TimeFormat), true},
+			{"If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat), false},
+			{"If-Modified-Since", "not a date", false},
+		}
+
+		for _, c := range cases {
+			r := httptest.NewRequest("GET", "/ark:99999/test", nil)
+			r.Header.Set(c.header, c.value)
+			if notModified(r, info) != c.expected {
+				t.Fatalf("%s: %s should give %t", c.header, c.value, c.expected)
+			}
+		}
+
+		// If-None-Match takes precedence
+		r := httptest.NewRequest("GET", "/ark:99999/test", nil)
+		r.Header.Set("If-None-Match", `"2"`)
+		r.Header.Set("If-Modified-Since", modified.Format(http.TimeFormat))
+		if notModified(r, info) {
+			t.Fatalf("If-Modified-Since was Used Alongside If-None-Match")
+		}
+	})
+
+	t.Run("Headers", func(t *testing.T) {
+
+		w := httptest.NewRecorder()
+		setCacheHeaders(w, info, true)
+
+		if w.Header().Get("ETag") != `"3"` || w.Header().Get("Last-Modified") != "Mon, 01 Jun 2020 12:30:00 GMT" || w.Header().Get("Cache-Control") != "public, max-age=60" {
+			t.Fatalf("Incorrect Cache Headers: %+v", w.Header())
+		}
+
+		w = httptest.NewRecorder()
+		setCacheHeaders(w, info, false)
+		if w.Header().Get("ETag") != "" || w.Header().Get("Last-Modified") != "" || w.Header().Get("Cache-Control") == "" {
+			t.Fatalf("Untagged Response should only have Cache-Control: %+v", w.Header())
+		}
+	})
+
+	t.Run("Policy", func(t *testing.T) {
+
+		if _, err := parseNamespacePolicy([]byte(`{"policy": {"cacheControl": "public\r\nSet-Cookie: x=1"}}`)); !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("Multi Line Cache-Control was Accepted: %v", err)
+		}
+	})
+
+}
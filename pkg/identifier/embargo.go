@@ -0,0 +1,233 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/buger/jsonparser"
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// StatusEmbargoed is the creativeWorkStatus of the stub an embargoed identifier resolves to
+const StatusEmbargoed = "Embargoed"
+
+// ErrEmbargoed is returned when an anonymous user resolves an embargoed identifier
+var ErrEmbargoed = errors.New("Identifier is Embargoed")
+
+// embargoStubFields are the properties of an embargoed identifier that resolve before the embargo lifts
+var embargoStubFields = []string{"@context", "@id", "@type", "url", "embargoDate"}
+
+// embargoUntil parses an embargoDate, an RFC 3339 time or a date taken as midnight UTC. Identifiers are embargoed
+// while their embargoDate is after now.
+func embargoUntil(embargoDate string, now time.Time) (until time.Time, embargoed bool, err error) {
+
+	until, err = time.Parse(time.RFC3339, embargoDate)
+	if err != nil {
+		until, err = time.Parse("2006-01-02", embargoDate)
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w: embargoDate must be an RFC 3339 time or a date", ErrInvalidMetadata)
+	}
+
+	return until.UTC(), until.After(now), nil
+}
+
+// metadataEmbargo reads the embargo the embargoDate of metadata sets, nil when the metadata isn't embargoed.
+// owner is the user who may resolve the full record during the embargo.
+func metadataEmbargo(metadata map[string]interface{}, owner string, now time.Time) (embargo map[string]interface{}, err error) {
+
+	value, ok := metadata["embargoDate"]
+	if !ok {
+		return nil, nil
+	}
+
+	embargoDate, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: embargoDate must be a string", ErrInvalidMetadata)
+	}
+
+	until, embargoed, err := embargoUntil(embargoDate, now)
+	if err != nil || !embargoed {
+		return nil, err
+	}
+
+	return map[string]interface{}{"until": until, "owner": owner}, nil
+}
+
+// setEmbargo records the embargo of an edited record from its embargoDate, the owner is its publisher
+func setEmbargo(updated map[string]interface{}, now time.Time) error {
+
+	owner := ""
+	if publisher, ok := updated["sdPublisher"].(map[string]interface{}); ok {
+		owner, _ = publisher["@id"].(string)
+	}
+
+	embargo, err := metadataEmbargo(updated, owner, now)
+	if err != nil {
+		return err
+	}
+
+	delete(updated, "_embargo")
+	if embargo != nil {
+		updated["_embargo"] = embargo
+	}
+
+	return nil
+}
+
+// recordEmbargoed reads whether a stored record is embargoed at now, and who owns it
+func recordEmbargoed(record []byte, now time.Time) (embargoed bool, owner string) {
+
+	value, err := jsonparser.GetString(record, "_embargo", "until")
+	if err != nil {
+		return false, ""
+	}
+
+	until, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || !until.After(now) {
+		return false, ""
+	}
+
+	owner, _ = jsonparser.GetString(record, "_embargo", "owner")
+
+	return true, owner
+}
+
+// publicRecords restricts query to the records that aren't embargoed at now, for reads that don't check who is
+// reading
+func publicRecords(query bson.D, now time.Time) bson.D {
+	return append(query, bson.E{"_embargo.until", bson.D{{"$not", bson.D{{"$gt", now}}}}})
+}
+
+// maySeeEmbargoed reports whether viewer may resolve the full record of an embargoed identifier owned by owner
+func maySeeEmbargoed(owner string, viewer User) bool {
+	return viewer.Role == "admin" || (viewer.ID != "" && viewer.ID == owner)
+}
+
+// embargoStub reads the stub an embargoed identifier resolves to for users other than its owner
+func (b *Backend) embargoStub(guid string) (stub []byte, err error) {
+
+	stub, err = b.Mongo.FindOne(bson.D{{"_id", guid}}, embargoStubFields...)
+	if err != nil {
+		return
+	}
+
+	return jsonparser.Set(stub, []byte(`"`+StatusEmbargoed+`"`), "creativeWorkStatus")
+}
+
+// recordView is the metadata of a stored record as viewer may see it, an embargoed record is reduced to its stub
+// for anyone but its owner
+func recordView(record []byte, viewer User, now time.Time) ([]byte, error) {
+
+	embargoed, owner := recordEmbargoed(record, now)
+	if !embargoed || maySeeEmbargoed(owner, viewer) {
+		return processMetadataRead(record), nil
+	}
+
+	metadata := make(map[string]interface{})
+	if err := json.Unmarshal(record, &metadata); err != nil {
+		return nil, err
+	}
+
+	stub := map[string]interface{}{"creativeWorkStatus": StatusEmbargoed}
+	for _, field := range embargoStubFields {
+		if value, ok := metadata[field]; ok {
+			stub[field] = value
+		}
+	}
+
+	return json.Marshal(stub)
+}
+
+// LiftEmbargoes makes public the identifiers whose embargo ended by now, adding them to stardog and emitting an
+// EventEmbargoLifted for each, returning how many were
+func (b *Backend) LiftEmbargoes(now time.Time) (count int, err error) {
+
+	ended := bson.D{{"_embargo.until", bson.D{{"$lte", now}}}}
+
+	var records [][]byte
+	err = b.Mongo.Iterate(context.Background(), ended, func(record []byte) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	for _, record := range records {
+
+		guid, _ := jsonparser.GetString(record, "_id")
+		owner, _ := jsonparser.GetString(record, "_embargo", "owner")
+
+		// lifting the embargo claims the record, so replicas running the same job add its triples once. Another
+		// replica, or an edit of the embargoDate, may have changed the record since it was read
+		var lifted []byte
+		lifted, err = b.Mongo.ModifyOne(append(bson.D{{"_id", guid}}, ended...), bson.D{
+			{"$unset", bson.D{{"_embargo", ""}}},
+			{"$currentDate", bson.D{{"_modified", true}}},
+			{"$inc", bson.D{{"_rev", 1}}},
+		})
+		if err == mongo.ErrNoDocuments {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		// the triples are of the record as it was lifted, when they can't be added the embargo is put back so the
+		// next run retries
+		if err = b.Stardog.AddIdentifier(graphForm(lifted)); err != nil {
+			if restoreErr := b.restoreEmbargo(guid, record, lifted); restoreErr != nil {
+				err = fmt.Errorf("%w, and the embargo of %s could not be restored: %s", err, guid, restoreErr.Error())
+			}
+			return
+		}
+
+		b.Cache.Invalidate(guid)
+		b.emit(Event{Type: EventEmbargoLifted, Identifier: guid, Owner: owner, Time: now})
+		count++
+	}
+
+	return count, nil
+}
+
+// restoreEmbargo puts back the embargo LiftEmbargoes took off the identifier guid, as it was in record, unless the
+// lifted record was changed since
+func (b *Backend) restoreEmbargo(guid string, record []byte, lifted []byte) error {
+
+	value, _ := jsonparser.GetString(record, "_embargo", "until")
+	until, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return err
+	}
+	owner, _ := jsonparser.GetString(record, "_embargo", "owner")
+
+	_, err = b.Mongo.ModifyOne(Revisions{recordRevision(lifted)}.filter(bson.D{{"_id", guid}}), bson.D{
+		{"$set", bson.D{{"_embargo", bson.D{{"until", until}, {"owner", owner}}}}},
+		{"$inc", bson.D{{"_rev", 1}}},
+	})
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+
+	// the record may have been resolved while it was public
+	b.Cache.Invalidate(guid)
+
+	return err
+}
+
+// LiftEmbargoesEvery runs LiftEmbargoes every interval until ctx is done
+func (b *Backend) LiftEmbargoesEvery(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, "LiftEmbargoes", b.LiftEmbargoes)
+}
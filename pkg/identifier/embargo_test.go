@@ -0,0 +1,126 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	bson "go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmbargo(t *testing.T) {
+
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	owner := "https://orcid.org/0000-0000-0000-0000"
+
+	t.Run("Parse", func(t *testing.T) {
+
+		if until, embargoed, err := embargoUntil("2020-07-01", now); err != nil || !embargoed || !until.Equal(time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Fatalf("Date was not Parsed as Midnight UTC: %s %t %v", until, embargoed, err)
+		}
+
+		if _, embargoed, err := embargoUntil("2020-05-31T23:00:00-04:00", now); err != nil || !embargoed {
+			t.Fatalf("Time with an Offset was not Parsed: %t %v", embargoed, err)
+		}
+
+		if _, embargoed, _ := embargoUntil("2020-05-01", now); embargoed {
+			t.Fatalf("Past Embargo Date Embargoed the Identifier")
+		}
+
+		if _, err := metadataEmbargo(map[string]interface{}{"embargoDate": "next month"}, owner, now); !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("Invalid Embargo Date was Accepted: %v", err)
+		}
+
+		if embargo, err := metadataEmbargo(map[string]interface{}{"name": "test"}, owner, now); embargo != nil || err != nil {
+			t.Fatalf("Metadata Without an Embargo Date was Embargoed: %+v %v", embargo, err)
+		}
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+
+		updated := map[string]interface{}{
+			"embargoDate": "2020-07-01",
+			"sdPublisher": map[string]interface{}{"@id": owner},
+		}
+		if err := setEmbargo(updated, now); err != nil {
+			t.Fatalf("Failed to Set Embargo: %s", err.Error())
+		}
+
+		embargo, ok := updated["_embargo"].(map[string]interface{})
+		if !ok || embargo["owner"] != owner {
+			t.Fatalf("Embargo was not Recorded: %+v", updated)
+		}
+
+		// removing the embargo date lifts the embargo
+		delete(updated, "embargoDate")
+		if setEmbargo(updated, now); updated["_embargo"] != nil {
+			t.Fatalf("Embargo was Kept: %+v", updated)
+		}
+	})
+
+	t.Run("Record", func(t *testing.T) {
+
+		record := []byte(`{"_id": "ark:99999/test", "_embargo": {"until": "2020-07-01T00:00:00Z", "owner": "` + owner + `"}}`)
+
+		embargoed, recordOwner := recordEmbargoed(record, now)
+		if !embargoed || recordOwner != owner {
+			t.Fatalf("Embargo was not Read: %t %s", embargoed, recordOwner)
+		}
+
+		if embargoed, _ = recordEmbargoed(record, now.AddDate(0, 2, 0)); embargoed {
+			t.Fatalf("Ended Embargo is Still in Effect")
+		}
+
+		if !maySeeEmbargoed(owner, User{ID: owner}) || !maySeeEmbargoed(owner, User{Role: "admin"}) {
+			t.Fatalf("Owner can't See the Embargoed Record")
+		}
+
+		if maySeeEmbargoed(owner, User{ID: "https://orcid.org/1111-1111-1111-1111"}) || maySeeEmbargoed("", User{}) {
+			t.Fatalf("Other User can See the Embargoed Record")
+		}
+
+		if read := processMetadataRead(record); strings.Contains(string(read), "_embargo") {
+			t.Fatalf("Embargo Details were Returned: %s", read)
+		}
+	})
+
+	t.Run("View", func(t *testing.T) {
+
+		record := []byte(`{"_id": "ark:99999/test", "@id": "ark:99999/test", "name": "secret", "_rev": 2, "_references": [], "_embargo": {"until": "2020-07-01T00:00:00Z", "owner": "` + owner + `"}}`)
+
+		full, err := recordView(record, User{ID: owner}, now)
+		if err != nil || !strings.Contains(string(full), "secret") || strings.Contains(string(full), "_") {
+			t.Fatalf("Owner did not get the Metadata without Internal Fields: %s %v", full, err)
+		}
+
+		stub, err := recordView(record, User{}, now)
+		if err != nil || strings.Contains(string(stub), "secret") || strings.Contains(string(stub), "_") || !strings.Contains(string(stub), StatusEmbargoed) {
+			t.Fatalf("Other User did not get the Stub: %s %v", stub, err)
+		}
+
+		if public, _ := recordView(record, User{}, now.AddDate(0, 2, 0)); !strings.Contains(string(public), "secret") {
+			t.Fatalf("Metadata was not Public once the Embargo Ended: %s", public)
+		}
+	})
+
+	t.Run("Public", func(t *testing.T) {
+
+		// lists and exports don't check who reads them, so they only read identifiers whose embargo ended
+		query := publicRecords(bson.D{{"namespace", "ark:99999"}}, now)
+		if len(query) != 2 || query[1].Key != "_embargo.until" {
+			t.Fatalf("Embargoed Records are not Filtered: %+v", query)
+		}
+
+		until, ok := query[1].Value.(bson.D)
+		if !ok || until[0].Key != "$not" {
+			t.Fatalf("Records without an Embargo are Filtered: %+v", query)
+		}
+	})
+
+}
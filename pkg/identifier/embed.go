@@ -0,0 +1,242 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+// Limits on inlining referenced identifiers when resolving
+const (
+	DefaultEmbedDepth = 1
+	MaxEmbedDepth     = 5
+)
+
+var ErrInvalidEmbed = errors.New("Invalid Expand Option")
+
+// EmbedOptions selects the referenced identifiers inlined into a resolved record
+type EmbedOptions struct {
+	// Properties whose references are inlined, * inlines the references of every property
+	Properties []string
+	// Depth is how many levels of references are inlined
+	Depth int
+}
+
+// ParseEmbedOptions reads the expand (comma separated properties) and depth query parameters
+func ParseEmbedOptions(expand string, depth string) (opt EmbedOptions, err error) {
+
+	for _, property := range strings.Split(expand, ",") {
+		if property = strings.TrimSpace(property); property != "" {
+			opt.Properties = append(opt.Properties, property)
+		}
+	}
+
+	opt.Depth = DefaultEmbedDepth
+	if depth != "" {
+		opt.Depth, err = strconv.Atoi(depth)
+		if err != nil || opt.Depth < 1 || opt.Depth > MaxEmbedDepth {
+			return opt, fmt.Errorf("%w: depth must be between 1 and %d", ErrInvalidEmbed, MaxEmbedDepth)
+		}
+	}
+
+	return
+}
+
+func (o EmbedOptions) selects(property string) bool {
+
+	if strings.HasPrefix(property, "@") {
+		return false
+	}
+
+	for _, p := range o.Properties {
+		if p == "*" || p == property {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordFetcher returns the metadata of the identifiers in ids by @id, identifiers that don't exist are left out
+type recordFetcher func(ids []string) (map[string]map[string]interface{}, error)
+
+// fetchRecords reads the metadata of several identifiers in one query
+func (b *Backend) fetchRecords(ids []string) (records map[string]map[string]interface{}, err error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	records = make(map[string]map[string]interface{}, len(ids))
+
+	now := time.Now()
+
+	err = b.Mongo.Iterate(ctx, bson.D{{"_id", bson.D{{"$in", ids}}}}, func(record []byte) error {
+
+		// embargoed identifiers are left as references
+		if embargoed, _ := recordEmbargoed(record, now); embargoed {
+			return nil
+		}
+
+		doc := make(map[string]interface{})
+		dec := json.NewDecoder(bytes.NewReader(processMetadataRead(record)))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return err
+		}
+
+		if id, ok := doc["@id"].(string); ok {
+			records[id] = doc
+		}
+		return nil
+	})
+
+	return
+}
+
+// embedNode is a record whose references are inlined, along with the identifiers it is nested in
+type embedNode struct {
+	doc       map[string]interface{}
+	ancestors map[string]bool
+}
+
+// reference is a node reference found in a record, and how to replace it
+type reference struct {
+	id        string
+	node      map[string]interface{}
+	ancestors map[string]bool
+	replace   func(interface{})
+}
+
+// embedReferences replaces objects referring to other identifiers by @id in doc with their records, one level at a
+// time up to the depth of the options. A reference to an identifier the record is already nested in is left as a
+// reference, as are references to identifiers that don't exist. Records with the same @context as doc don't repeat it.
+func embedReferences(doc map[string]interface{}, opt EmbedOptions, fetch recordFetcher) error {
+
+	if len(opt.Properties) == 0 {
+		return nil
+	}
+
+	rootID, _ := doc["@id"].(string)
+	frontier := []embedNode{{doc: doc, ancestors: map[string]bool{rootID: true}}}
+	fetched := map[string]map[string]interface{}{}
+
+	for level := 0; level < opt.Depth && len(frontier) > 0; level++ {
+
+		var refs []reference
+		var missing []string
+
+		for _, node := range frontier {
+			for property, value := range node.doc {
+				if !opt.selects(property) {
+					continue
+				}
+
+				property := property
+				parent := node.doc
+				collectReferences(value, node.ancestors, func(v interface{}) { parent[property] = v }, &refs)
+			}
+		}
+
+		for _, ref := range refs {
+			if _, ok := fetched[ref.id]; !ok {
+				fetched[ref.id] = nil
+				missing = append(missing, ref.id)
+			}
+		}
+
+		if len(missing) > 0 {
+			records, err := fetch(missing)
+			if err != nil {
+				return err
+			}
+			for id, record := range records {
+				fetched[id] = record
+			}
+		}
+
+		frontier = nil
+		for _, ref := range refs {
+			record := fetched[ref.id]
+			if record == nil {
+				continue
+			}
+
+			embedded := copyValue(record).(map[string]interface{})
+			if reflect.DeepEqual(embedded["@context"], doc["@context"]) {
+				delete(embedded, "@context")
+			}
+
+			// what the reference says about the node is kept unless the record says otherwise
+			for key, value := range ref.node {
+				if _, ok := embedded[key]; !ok {
+					embedded[key] = value
+				}
+			}
+			ref.replace(embedded)
+
+			ancestors := make(map[string]bool, len(ref.ancestors)+1)
+			for id := range ref.ancestors {
+				ancestors[id] = true
+			}
+			ancestors[ref.id] = true
+
+			frontier = append(frontier, embedNode{doc: embedded, ancestors: ancestors})
+		}
+	}
+
+	return nil
+}
+
+// collectReferences finds the node references in a property value, replace sets the property to a new value
+func collectReferences(value interface{}, ancestors map[string]bool, replace func(interface{}), refs *[]reference) {
+
+	switch v := value.(type) {
+
+	case map[string]interface{}:
+		id, ok := v["@id"].(string)
+		if !ok || ancestors[id] {
+			return
+		}
+		*refs = append(*refs, reference{id: id, node: v, ancestors: ancestors, replace: replace})
+
+	case []interface{}:
+		for i := range v {
+			i := i
+			collectReferences(v[i], ancestors, func(item interface{}) { v[i] = item }, refs)
+		}
+	}
+}
+
+func copyValue(value interface{}) interface{} {
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			c[key] = copyValue(item)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = copyValue(item)
+		}
+		return c
+	}
+
+	return value
+}
@@ -0,0 +1,127 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEmbed(t *testing.T) {
+
+	context := map[string]interface{}{"@vocab": DefaultVocab}
+
+	records := map[string]string{
+		"ark:99999/data": `{"@id": "ark:99999/data", "@context": {"@vocab": "http://schema.org/"}, "name": "data", "author": [{"@id": "ark:99999/max"}, {"@id": "ark:99999/missing"}], "generatedBy": {"@id": "ark:99999/comp"}}`,
+		"ark:99999/comp": `{"@id": "ark:99999/comp", "@context": {"@vocab": "http://schema.org/"}, "name": "comp", "generated": {"@id": "ark:99999/data"}, "usedSoftware": {"@id": "ark:99999/soft"}}`,
+		"ark:99999/soft": `{"@id": "ark:99999/soft", "@context": {"@vocab": "http://schema.org/", "ex": "http://example.org/"}, "name": "soft", "author": {"@id": "ark:99999/max"}}`,
+		"ark:99999/max":  `{"@id": "ark:99999/max", "@context": {"@vocab": "http://schema.org/"}, "name": "Max"}`,
+	}
+
+	var fetches [][]string
+	fetch := func(ids []string) (map[string]map[string]interface{}, error) {
+		fetches = append(fetches, ids)
+		found := map[string]map[string]interface{}{}
+		for _, id := range ids {
+			if record, ok := records[id]; ok {
+				doc := make(map[string]interface{})
+				json.Unmarshal([]byte(record), &doc)
+				found[id] = doc
+			}
+		}
+		return found, nil
+	}
+
+	resolve := func(t *testing.T, expand string, depth string) map[string]interface{} {
+		opt, err := ParseEmbedOptions(expand, depth)
+		if err != nil {
+			t.Fatalf("Failed to Parse Options: %s", err.Error())
+		}
+
+		doc := make(map[string]interface{})
+		json.Unmarshal([]byte(records["ark:99999/data"]), &doc)
+
+		fetches = nil
+		if err = embedReferences(doc, opt, fetch); err != nil {
+			t.Fatalf("Failed to Embed: %s", err.Error())
+		}
+		return doc
+	}
+
+	t.Run("Properties", func(t *testing.T) {
+
+		doc := resolve(t, "author", "")
+
+		expected := []interface{}{
+			map[string]interface{}{"@id": "ark:99999/max", "name": "Max"},
+			map[string]interface{}{"@id": "ark:99999/missing"},
+		}
+		if !reflect.DeepEqual(doc["author"], expected) {
+			t.Fatalf("Authors were not Embedded: %v", doc["author"])
+		}
+
+		if !reflect.DeepEqual(doc["generatedBy"], map[string]interface{}{"@id": "ark:99999/comp"}) {
+			t.Fatalf("Unselected Property was Embedded: %v", doc["generatedBy"])
+		}
+	})
+
+	t.Run("Depth", func(t *testing.T) {
+
+		doc := resolve(t, "generatedBy,usedSoftware", "2")
+
+		comp := doc["generatedBy"].(map[string]interface{})
+		soft := comp["usedSoftware"].(map[string]interface{})
+
+		// the second level has a different context, so it keeps its own
+		if soft["name"] != "soft" || soft["@context"] == nil || comp["@context"] != nil {
+			t.Fatalf("Second Level was not Embedded: %v", doc)
+		}
+
+		if !reflect.DeepEqual(soft["author"], map[string]interface{}{"@id": "ark:99999/max"}) {
+			t.Fatalf("Embedded beyond the Depth Limit: %v", soft)
+		}
+
+		if len(fetches) != 2 {
+			t.Fatalf("Expected one Fetch per Level, got %v", fetches)
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+
+		doc := resolve(t, "*", "5")
+
+		comp := doc["generatedBy"].(map[string]interface{})
+		if !reflect.DeepEqual(comp["generated"], map[string]interface{}{"@id": "ark:99999/data"}) {
+			t.Fatalf("Cycle was Embedded: %v", comp["generated"])
+		}
+
+		soft := comp["usedSoftware"].(map[string]interface{})
+		if soft["author"].(map[string]interface{})["name"] != "Max" {
+			t.Fatalf("Identifier Referenced Twice was not Embedded in Both Places: %v", soft)
+		}
+
+		if !reflect.DeepEqual(doc["@context"], context) {
+			t.Fatalf("Root Context was Changed: %v", doc["@context"])
+		}
+	})
+
+	t.Run("Options", func(t *testing.T) {
+
+		for _, depth := range []string{"0", "6", "deep"} {
+			if _, err := ParseEmbedOptions("author", depth); !errors.Is(err, ErrInvalidEmbed) {
+				t.Fatalf("Invalid Depth %s was Accepted: %v", depth, err)
+			}
+		}
+
+		opt, err := ParseEmbedOptions(" author, ,isPartOf ", "")
+		if err != nil || !reflect.DeepEqual(opt, EmbedOptions{Properties: []string{"author", "isPartOf"}, Depth: DefaultEmbedDepth}) {
+			t.Fatalf("Incorrect Options: %+v %v", opt, err)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// EventEmbargoLifted is emitted when an identifier becomes public at its embargo date
+const EventEmbargoLifted = "embargo.lifted"
+
+// Event reports a change the service made to an identifier on its own, rather than on request
+type Event struct {
+	Type       string `json:"type" bson:"type"`
+	Identifier string `json:"identifier" bson:"identifier"`
+	// Owner is the user the change concerns, the publisher of the identifier, when known
+	Owner string    `json:"owner,omitempty" bson:"owner,omitempty"`
+	Time  time.Time `json:"time" bson:"time"`
+	// Detail describes the change, depending on its type
+	Detail map[string]interface{} `json:"detail,omitempty" bson:"detail,omitempty"`
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// emit records an event in mongo, where consumers can read or watch it, and posts it to the event webhook when one
+// is configured. Failures are logged rather than returned, the change the event reports has already been made.
+func (b *Backend) emit(event Event) {
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.Mongo.RecordEvent(event)
+
+	if b.EventWebhook == "" {
+		return
+	}
+
+	if err := postEvent(b.EventWebhook, event); err != nil {
+		scheduleLogger.Error().
+			Err(err).
+			Str("operation", "PostEvent").
+			Str("type", event.Type).
+			Str("identifier", event.Identifier).
+			Msg("failed to deliver event to webhook")
+	}
+}
+
+func postEvent(url string, event Event) error {
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// DirectionUp follows provenance from an identifier to what it was generated by, derived from, used or is part of
+	DirectionUp = "up"
+	// DirectionDown follows provenance from an identifier to what was generated by, derived from, used or is part of it
+	DirectionDown = "down"
+	// DirectionBoth follows provenance both ways
+	DirectionBoth = "both"
+)
+
+// Limits on evidence graph traversal
+const (
+	DefaultEvidenceDepth = 3
+	MaxEvidenceDepth     = 10
+	DefaultEvidenceNodes = 100
+	MaxEvidenceNodes     = 1000
+)
+
+var ErrInvalidTraversal = errors.New("Invalid Evidence Graph Option")
+
+// evidenceProperties are the provenance properties an evidence graph follows, in order
+var evidenceProperties = []string{"generatedBy", "usedDataset", "usedSoftware", "wasDerivedFrom", "isPartOf"}
+
+// evidenceIRIs are the IRIs each provenance property is stored under, wasDerivedFrom is also written as the PROV term
+var evidenceIRIs = map[string][]string{
+	"generatedBy":    {DefaultVocab + "generatedBy"},
+	"usedDataset":    {DefaultVocab + "usedDataset"},
+	"usedSoftware":   {DefaultVocab + "usedSoftware"},
+	"wasDerivedFrom": {DefaultVocab + "wasDerivedFrom", "http://www.w3.org/ns/prov#wasDerivedFrom"},
+	"isPartOf":       {DefaultVocab + "isPartOf"},
+}
+
+// TraversalOptions bound the walk of an evidence graph
+type TraversalOptions struct {
+	// Depth is how many properties away from the identifier the walk goes
+	Depth int
+	// Direction is one of the Direction constants
+	Direction string
+	// Properties are the provenance properties followed, all of evidenceProperties when empty
+	Properties []string
+	// MaxNodes is how many identifiers the graph holds at most, the walk stops once it is reached
+	MaxNodes int
+}
+
+// ParseTraversalOptions reads the depth, direction, properties (comma separated) and limit query parameters
+func ParseTraversalOptions(depth string, direction string, properties string, limit string) (opt TraversalOptions, err error) {
+
+	opt = TraversalOptions{Depth: DefaultEvidenceDepth, Direction: DirectionUp, MaxNodes: DefaultEvidenceNodes}
+
+	if depth != "" {
+		opt.Depth, err = strconv.Atoi(depth)
+		if err != nil || opt.Depth < 1 || opt.Depth > MaxEvidenceDepth {
+			return opt, fmt.Errorf("%w: depth must be between 1 and %d", ErrInvalidTraversal, MaxEvidenceDepth)
+		}
+	}
+
+	if direction != "" {
+		if direction != DirectionUp && direction != DirectionDown && direction != DirectionBoth {
+			return opt, fmt.Errorf("%w: direction must be up, down or both", ErrInvalidTraversal)
+		}
+		opt.Direction = direction
+	}
+
+	for _, property := range strings.Split(properties, ",") {
+		if property = strings.TrimSpace(property); property == "" {
+			continue
+		}
+		if !containsString(evidenceProperties, property) {
+			return opt, fmt.Errorf("%w: properties must be among %s", ErrInvalidTraversal, strings.Join(evidenceProperties, ", "))
+		}
+		opt.Properties = append(opt.Properties, property)
+	}
+
+	if limit != "" {
+		opt.MaxNodes, err = strconv.Atoi(limit)
+		if err != nil || opt.MaxNodes < 1 || opt.MaxNodes > MaxEvidenceNodes {
+			return opt, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidTraversal, MaxEvidenceNodes)
+		}
+	}
+
+	return opt, nil
+}
+
+// iris lists the IRIs of the properties the walk follows
+func (opt TraversalOptions) iris() []string {
+
+	properties := opt.Properties
+	if len(properties) == 0 {
+		properties = evidenceProperties
+	}
+
+	var iris []string
+	for _, property := range properties {
+		iris = append(iris, evidenceIRIs[property]...)
+	}
+
+	return iris
+}
+
+// edgesQuery builds a SELECT query for the statements by one of the properties from the nodes to other IRIs, or with
+// inbound set to the nodes from other IRIs
+func edgesQuery(nodes []string, properties []string, inbound bool) (string, error) {
+
+	var query strings.Builder
+	query.WriteString("SELECT DISTINCT ?s ?p ?o WHERE { VALUES ?node {")
+
+	for _, node := range nodes {
+		iri, err := sparqlIRI(node)
+		if err != nil {
+			return "", err
+		}
+		query.WriteString(" " + iri)
+	}
+
+	query.WriteString(" } VALUES ?p {")
+	for _, property := range properties {
+		iri, err := sparqlIRI(property)
+		if err != nil {
+			return "", err
+		}
+		query.WriteString(" " + iri)
+	}
+	query.WriteString(" } ")
+
+	if inbound {
+		query.WriteString("?s ?p ?node . BIND(?node AS ?o) FILTER(isIRI(?s)) }")
+	} else {
+		query.WriteString("?node ?p ?o . BIND(?node AS ?s) FILTER(isIRI(?o)) }")
+	}
+
+	return query.String(), nil
+}
+
+// evidenceTerm names a property IRI by its term in the default vocabulary, other IRIs are kept whole
+func evidenceTerm(iri string) string {
+	return strings.TrimPrefix(iri, DefaultVocab)
+}
+
+// EvidenceGraph walks the provenance of an identifier in stardog as the options allow, returning the identifiers
+// reached as a JSON-LD @graph. Each node has its @id, @type and name, and the provenance properties followed to
+// other nodes of the graph. truncated reports that the walk stopped at the node limit.
+func (b *Backend) EvidenceGraph(guid string, opt TraversalOptions) (graph map[string]interface{}, truncated bool, err error) {
+
+	if _, err = b.Mongo.FindOne(bson.D{{"_id", guid}}, "_id"); err != nil {
+		return
+	}
+
+	nodes := []string{guid}
+	reached := map[string]bool{guid: true}
+	edges := make(map[string]map[string][]string)
+
+	var directions []bool
+	if opt.Direction != DirectionDown {
+		directions = append(directions, false)
+	}
+	if opt.Direction != DirectionUp {
+		directions = append(directions, true)
+	}
+
+	frontier := []string{guid}
+	for depth := 0; depth < opt.Depth && len(frontier) > 0; depth++ {
+
+		var next []string
+		for _, inbound := range directions {
+
+			bindings, queryErr := b.Stardog.Edges(frontier, opt.iris(), inbound)
+			if queryErr != nil {
+				return nil, false, queryErr
+			}
+
+			for _, edge := range bindings {
+
+				neighbor := edge["o"]
+				if inbound {
+					neighbor = edge["s"]
+				}
+
+				if !reached[neighbor] {
+					if len(nodes) >= opt.MaxNodes {
+						truncated = true
+						continue
+					}
+					reached[neighbor] = true
+					nodes = append(nodes, neighbor)
+
+					// nodes whose IRI can't be written in a query end the walk
+					if _, iriErr := sparqlIRI(neighbor); iriErr == nil {
+						next = append(next, neighbor)
+					}
+				}
+
+				addEdge(edges, edge["s"], evidenceTerm(edge["p"]), edge["o"])
+			}
+		}
+
+		frontier = next
+	}
+
+	// identifiers that don't exist, or are embargoed, are nodes with only an @id
+	records, err := b.fetchRecords(nodes)
+	if err != nil {
+		return
+	}
+
+	return evidenceDocument(nodes, records, edges), truncated, nil
+}
+
+// truncationWarning is the Warning header of an evidence graph cut short at limit nodes
+func truncationWarning(limit int) string {
+	return `299 - ` + strconv.Quote("Evidence graph truncated at "+strconv.Itoa(limit)+" nodes")
+}
+
+func addEdge(edges map[string]map[string][]string, subject string, property string, object string) {
+
+	if edges[subject] == nil {
+		edges[subject] = make(map[string][]string)
+	}
+	if !containsString(edges[subject][property], object) {
+		edges[subject][property] = append(edges[subject][property], object)
+	}
+}
+
+// evidenceDocument writes the nodes of an evidence graph, in the order they were reached, as a JSON-LD @graph
+func evidenceDocument(nodes []string, records map[string]map[string]interface{}, edges map[string]map[string][]string) map[string]interface{} {
+
+	graph := make([]interface{}, 0, len(nodes))
+	for _, id := range nodes {
+
+		node := map[string]interface{}{"@id": id}
+		for _, field := range []string{"@type", "name"} {
+			if value, ok := records[id][field]; ok {
+				node[field] = value
+			}
+		}
+
+		for property, objects := range edges[id] {
+			refs := make([]interface{}, len(objects))
+			for i, object := range objects {
+				refs[i] = map[string]interface{}{"@id": object}
+			}
+			node[property] = refs
+		}
+
+		graph = append(graph, node)
+	}
+
+	return map[string]interface{}{
+		"@context": mergeContext(nil),
+		"@graph":   graph,
+	}
+}
@@ -0,0 +1,116 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvidenceGraph(t *testing.T) {
+
+	t.Run("Options", func(t *testing.T) {
+
+		opt, err := ParseTraversalOptions("", "", "", "")
+		if err != nil || opt.Depth != DefaultEvidenceDepth || opt.Direction != DirectionUp || opt.MaxNodes != DefaultEvidenceNodes {
+			t.Fatalf("Incorrect Default Options: %+v %v", opt, err)
+		}
+		if len(opt.iris()) != 6 {
+			t.Fatalf("Default Options don't Follow Every Provenance Property: %v", opt.iris())
+		}
+
+		opt, err = ParseTraversalOptions("2", "both", "usedDataset, generatedBy", "50")
+		if err != nil || opt.Depth != 2 || opt.Direction != DirectionBoth || opt.MaxNodes != 50 {
+			t.Fatalf("Failed to Parse Options: %+v %v", opt, err)
+		}
+		if iris := opt.iris(); !reflect.DeepEqual(iris, []string{DefaultVocab + "usedDataset", DefaultVocab + "generatedBy"}) {
+			t.Fatalf("Incorrect Properties: %v", iris)
+		}
+
+		for _, invalid := range [][4]string{
+			{"0", "", "", ""},
+			{"11", "", "", ""},
+			{"", "sideways", "", ""},
+			{"", "", "author", ""},
+			{"", "", "", "1001"},
+		} {
+			if _, err = ParseTraversalOptions(invalid[0], invalid[1], invalid[2], invalid[3]); !errors.Is(err, ErrInvalidTraversal) {
+				t.Fatalf("Invalid Options Accepted %v: %v", invalid, err)
+			}
+		}
+	})
+
+	t.Run("Query", func(t *testing.T) {
+
+		query, err := edgesQuery([]string{"ark:99999/data"}, []string{DefaultVocab + "generatedBy"}, false)
+		if err != nil || !strings.Contains(query, "VALUES ?node { <ark:99999/data> }") || !strings.Contains(query, "?node ?p ?o") {
+			t.Fatalf("Incorrect Outbound Query: %s %v", query, err)
+		}
+
+		query, err = edgesQuery([]string{"ark:99999/data"}, []string{DefaultVocab + "generatedBy"}, true)
+		if err != nil || !strings.Contains(query, "?s ?p ?node") {
+			t.Fatalf("Incorrect Inbound Query: %s %v", query, err)
+		}
+
+		if _, err = edgesQuery([]string{"ark:99999/x> } DELETE {"}, nil, false); !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("IRI was not Escaped: %v", err)
+		}
+	})
+
+	t.Run("Edges", func(t *testing.T) {
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"head": {"vars": ["s", "p", "o"]}, "results": {"bindings": [
+				{"s": {"type": "uri", "value": "ark:99999/data"}, "p": {"type": "uri", "value": "http://schema.org/generatedBy"}, "o": {"type": "uri", "value": "ark:99999/comp"}}
+			]}}`))
+		}))
+		defer srv.Close()
+
+		stardog := StardogServer{URI: srv.URL, Database: "ors"}
+
+		bindings, err := stardog.Edges([]string{"ark:99999/data"}, []string{DefaultVocab + "generatedBy"}, false)
+		if err != nil || len(bindings) != 1 || bindings[0]["o"] != "ark:99999/comp" {
+			t.Fatalf("Incorrect Edges: %v %v", bindings, err)
+		}
+	})
+
+	t.Run("Document", func(t *testing.T) {
+
+		edges := make(map[string]map[string][]string)
+		addEdge(edges, "ark:99999/data", evidenceTerm(DefaultVocab+"generatedBy"), "ark:99999/comp")
+		addEdge(edges, "ark:99999/data", evidenceTerm(DefaultVocab+"generatedBy"), "ark:99999/comp")
+		addEdge(edges, "ark:99999/comp", evidenceTerm("http://www.w3.org/ns/prov#wasDerivedFrom"), "ark:99999/raw")
+
+		records := map[string]map[string]interface{}{
+			"ark:99999/data": {"@id": "ark:99999/data", "@type": "Dataset", "name": "data", "description": "Left Out"},
+		}
+
+		doc := evidenceDocument([]string{"ark:99999/data", "ark:99999/comp", "ark:99999/raw"}, records, edges)
+
+		graph, _ := doc["@graph"].([]interface{})
+		if len(graph) != 3 {
+			t.Fatalf("Incorrect Graph: %v", doc)
+		}
+
+		data := graph[0].(map[string]interface{})
+		if data["name"] != "data" || data["description"] != nil {
+			t.Fatalf("Incorrect Node: %v", data)
+		}
+		if generatedBy, _ := data["generatedBy"].([]interface{}); len(generatedBy) != 1 {
+			t.Fatalf("Incorrect Edges: %v", data)
+		}
+
+		comp := graph[1].(map[string]interface{})
+		if len(comp) != 2 || comp["http://www.w3.org/ns/prov#wasDerivedFrom"] == nil {
+			t.Fatalf("Node Outside the Default Vocabulary Incorrect: %v", comp)
+		}
+	})
+}
@@ -0,0 +1,292 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buger/jsonparser"
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// ExpiryWarn keeps expired identifiers as they are, they resolve with a Warning header. This is the default.
+	ExpiryWarn = "warn"
+	// ExpiryWithdraw sets the creativeWorkStatus of expired identifiers to StatusWithdrawn and removes them from
+	// stardog, they still resolve to their metadata
+	ExpiryWithdraw = "withdraw"
+	// ExpiryTombstone replaces expired identifiers with tombstones
+	ExpiryTombstone = "tombstone"
+)
+
+// StatusWithdrawn is the creativeWorkStatus of an identifier withdrawn when it expired
+const StatusWithdrawn = "Withdrawn"
+
+// EventIdentifierExpired is emitted, to notify the owner, when an identifier reaches its expires date
+const EventIdentifierExpired = "identifier.expired"
+
+var ErrExpiryAction = errors.New("Expiry Action must be warn, withdraw or tombstone")
+
+// expiresLayouts are the forms of expires that are understood, RFC 3339, ISO 8601 with an offset without a colon,
+// and a date taken as midnight UTC
+var expiresLayouts = []string{time.RFC3339, "2006-01-02T15:04:05-0700", "2006-01-02"}
+
+// parseExpires reads the schema.org expires of a record, ok is false when it has none that can be read
+func parseExpires(expires string) (t time.Time, ok bool) {
+
+	for _, layout := range expiresLayouts {
+		if t, err := time.Parse(layout, expires); err == nil {
+			return t.UTC(), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// recordExpires reads the expires of a stored record
+func recordExpires(record []byte) (t time.Time, ok bool) {
+
+	expires, err := jsonparser.GetString(record, "expires")
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return parseExpires(expires)
+}
+
+// expiryWarning is the Warning header of an identifier that expired
+func expiryWarning(expired time.Time) string {
+	return `299 - ` + strconv.Quote("Identifier expired "+expired.Format(time.RFC3339))
+}
+
+// resetExpiry lets an identifier expire again when an edit changes its expires
+func resetExpiry(original map[string]interface{}, updated map[string]interface{}) {
+
+	if !reflect.DeepEqual(original["expires"], updated["expires"]) {
+		delete(updated, "_expired")
+	}
+
+	setExpires(updated)
+}
+
+// setExpires stores the expires of a record as a date in _expires, for ExpireIdentifiers to query. An expires that
+// can't be parsed is stored as null, it never expires.
+func setExpires(updated map[string]interface{}) {
+
+	delete(updated, "_expires")
+
+	if value, ok := updated["expires"]; ok {
+		expires, _ := value.(string)
+		if t, ok := parseExpires(expires); ok {
+			updated["_expires"] = t
+		} else {
+			updated["_expires"] = nil
+		}
+	}
+}
+
+func validExpiryAction(action string) bool {
+	return action == ExpiryWarn || action == ExpiryWithdraw || action == ExpiryTombstone
+}
+
+// expiryAction returns what happens to the expired identifiers of a namespace, as its policy or else the backend sets
+func (b *Backend) expiryAction(namespace string) (string, error) {
+
+	record, err := b.Mongo.FindOne(bson.D{{"_id", namespace}}, "policy")
+	if err != nil && err != mongo.ErrNoDocuments {
+		return "", err
+	}
+
+	if err == nil {
+		policy, err := parseNamespacePolicy(record)
+		if err != nil {
+			return "", err
+		}
+		if policy.ExpiryAction != "" {
+			return policy.ExpiryAction, nil
+		}
+	}
+
+	if b.ExpiryAction == "" {
+		return ExpiryWarn, nil
+	}
+	if !validExpiryAction(b.ExpiryAction) {
+		return "", ErrExpiryAction
+	}
+
+	return b.ExpiryAction, nil
+}
+
+// ExpireIdentifiers handles the identifiers whose expires passed by now, as the expiry action of their namespace
+// selects, and notifies their owners with an EventIdentifierExpired. Each identifier is handled once, unless its
+// expires is changed. It returns how many identifiers were handled.
+func (b *Backend) ExpireIdentifiers(now time.Time) (count int, err error) {
+
+	if err = b.storeExpires(); err != nil {
+		return
+	}
+
+	pending := bson.D{
+		{"_expires", bson.D{{"$lte", now}}},
+		{"_expired", bson.D{{"$exists", false}}},
+		{"creativeWorkStatus", bson.D{{"$ne", StatusTombstone}}},
+	}
+
+	type expiring struct {
+		guid    string
+		expires time.Time
+		owner   string
+		status  string
+	}
+
+	var expired []expiring
+	err = b.Mongo.Iterate(context.Background(), pending, func(record []byte) error {
+		guid, _ := jsonparser.GetString(record, "_id")
+		expires, _ := recordExpires(record)
+		owner, _ := jsonparser.GetString(record, "sdPublisher", "@id")
+		status, _ := jsonparser.GetString(record, "creativeWorkStatus")
+		expired = append(expired, expiring{guid, expires, owner, status})
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	actions := make(map[string]string)
+
+	for _, e := range expired {
+
+		namespace := strings.Split(e.guid, "/")[0]
+		action, ok := actions[namespace]
+		if !ok {
+			if action, err = b.expiryAction(namespace); err != nil {
+				return
+			}
+			actions[namespace] = action
+		}
+
+		// marking the identifier claims it, so replicas running the same job handle it once
+		set := bson.D{{"_expired", bson.D{{"at", now}, {"action", action}}}}
+		if action == ExpiryWithdraw {
+			set = append(set, bson.E{"creativeWorkStatus", StatusWithdrawn})
+		}
+
+		var record []byte
+		record, err = b.Mongo.ModifyOne(append(bson.D{{"_id", e.guid}}, pending...), bson.D{
+			{"$set", set},
+			{"$currentDate", bson.D{{"_modified", true}}},
+			{"$inc", bson.D{{"_rev", 1}}},
+		})
+		if err == mongo.ErrNoDocuments {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		// when the identifier can't be withdrawn or tombstoned the claim is taken back, so the next run retries
+		switch action {
+		case ExpiryWithdraw:
+			err = b.Stardog.RemoveIdentifier(graphForm(record))
+		case ExpiryTombstone:
+			_, err = b.TombstoneIdentifier(e.guid)
+		}
+		if err != nil {
+			if restoreErr := b.restoreExpiry(e.guid, action, e.status, record); restoreErr != nil {
+				err = fmt.Errorf("%w, and the expiry of %s could not be retried: %s", err, e.guid, restoreErr.Error())
+			}
+			return
+		}
+
+		b.Cache.Invalidate(e.guid)
+		b.emit(Event{
+			Type:       EventIdentifierExpired,
+			Identifier: e.guid,
+			Owner:      e.owner,
+			Time:       now,
+			Detail:     map[string]interface{}{"expires": e.expires, "action": action},
+		})
+		count++
+	}
+
+	return count, nil
+}
+
+// restoreExpiry takes back the claim ExpireIdentifiers made on the identifier guid with action, putting back the
+// creativeWorkStatus it had, unless the claimed record was changed since
+func (b *Backend) restoreExpiry(guid string, action string, status string, claimed []byte) error {
+
+	unset := bson.D{{"_expired", ""}}
+	update := bson.D{{"$inc", bson.D{{"_rev", 1}}}}
+
+	if action == ExpiryWithdraw {
+		if status == "" {
+			unset = append(unset, bson.E{"creativeWorkStatus", ""})
+		} else {
+			update = append(update, bson.E{"$set", bson.D{{"creativeWorkStatus", status}}})
+		}
+	}
+
+	_, err := b.Mongo.ModifyOne(Revisions{recordRevision(claimed)}.filter(bson.D{{"_id", guid}}), append(update, bson.E{"$unset", unset}))
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+
+	// the record may have been resolved while it was withdrawn
+	b.Cache.Invalidate(guid)
+
+	return err
+}
+
+// storeExpires parses the expires of the records written before it was stored as a date
+func (b *Backend) storeExpires() error {
+
+	legacy := bson.D{
+		{"expires", bson.D{{"$exists", true}}},
+		{"_expires", bson.D{{"$exists", false}}},
+	}
+
+	updates := make(map[string]interface{})
+	err := b.Mongo.Iterate(context.Background(), legacy, func(record []byte) error {
+		guid, _ := jsonparser.GetString(record, "_id")
+		updates[guid] = nil
+		if expires, ok := recordExpires(record); ok {
+			updates[guid] = expires
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for guid, expires := range updates {
+		_, err = b.Mongo.ModifyOne(append(bson.D{{"_id", guid}}, legacy...), bson.D{{"$set", bson.D{{"_expires", expires}}}})
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnsureExpiryIndex indexes the parsed expires of identifiers, which ExpireIdentifiers queries
+func (b *Backend) EnsureExpiryIndex() error {
+	return b.Mongo.EnsureExpiryIndex()
+}
+
+// ExpireIdentifiersEvery runs ExpireIdentifiers every interval until ctx is done
+func (b *Backend) ExpireIdentifiersEvery(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, "ExpireIdentifiers", b.ExpireIdentifiers)
+}
@@ -0,0 +1,84 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+
+	t.Run("Parse", func(t *testing.T) {
+
+		expected := time.Date(2011, 7, 14, 18, 43, 37, 0, time.UTC)
+
+		for _, expires := range []string{"2011-07-14T19:43:37+0100", "2011-07-14T19:43:37+01:00"} {
+			if parsed, ok := parseExpires(expires); !ok || !parsed.Equal(expected) {
+				t.Fatalf("Failed to Parse expires %s: %s", expires, parsed)
+			}
+		}
+
+		if parsed, ok := recordExpires([]byte(`{"expires": "2011-07-14"}`)); !ok || !parsed.Equal(time.Date(2011, 7, 14, 0, 0, 0, 0, time.UTC)) {
+			t.Fatalf("Date was not Parsed as Midnight UTC: %s", parsed)
+		}
+
+		for _, record := range []string{`{"expires": "soon"}`, `{"expires": {"@value": "2011-07-14"}}`, `{"name": "test"}`} {
+			if _, ok := recordExpires([]byte(record)); ok {
+				t.Fatalf("Record Without a Readable expires Expires: %s", record)
+			}
+		}
+
+		if warning := expiryWarning(expected); warning != `299 - "Identifier expired 2011-07-14T18:43:37Z"` {
+			t.Fatalf("Incorrect Warning: %s", warning)
+		}
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+
+		original := map[string]interface{}{"expires": "2011-07-14", "_expired": map[string]interface{}{"action": ExpiryWarn}}
+
+		updated := map[string]interface{}{"expires": "2011-07-14", "_expired": original["_expired"]}
+		if resetExpiry(original, updated); updated["_expired"] == nil {
+			t.Fatalf("Unchanged expires Let the Identifier Expire Again")
+		}
+
+		updated["expires"] = "2030-01-01"
+		if resetExpiry(original, updated); updated["_expired"] != nil {
+			t.Fatalf("Changed expires Kept the Identifier Expired")
+		}
+
+		// the parsed date is what expired identifiers are queried by
+		if expires, ok := updated["_expires"].(time.Time); !ok || expires.Year() != 2030 {
+			t.Fatalf("expires was not Stored as a Date: %+v", updated)
+		}
+
+		updated["expires"] = "next year"
+		if resetExpiry(original, updated); updated["_expires"] != nil {
+			t.Fatalf("expires that can't be Parsed was Stored as a Date: %+v", updated)
+		}
+
+		delete(updated, "expires")
+		if resetExpiry(original, updated); len(updated) != 0 {
+			t.Fatalf("Removed expires was Kept: %+v", updated)
+		}
+	})
+
+	t.Run("Policy", func(t *testing.T) {
+
+		policy, err := parseNamespacePolicy([]byte(`{"policy": {"expiryAction": "withdraw"}}`))
+		if err != nil || policy.ExpiryAction != ExpiryWithdraw {
+			t.Fatalf("Expiry Action was not Read: %+v %v", policy, err)
+		}
+
+		if _, err = parseNamespacePolicy([]byte(`{"policy": {"expiryAction": "delete"}}`)); !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("Unknown Expiry Action was Accepted: %v", err)
+		}
+	})
+
+}
@@ -0,0 +1,103 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// Export formats supported by ExportNamespace
+const (
+	ExportNDJSON = "ndjson"
+	ExportJSONLD = "jsonld"
+)
+
+var ErrExportFormat = errors.New("Unsupported Export Format")
+
+// ExportNamespace streams every identifier in the namespace guid to w.
+// With ExportNDJSON each record is written on its own line, with ExportJSONLD the records are
+// written as members of a single JSON-LD @graph. If since is non zero only identifiers created or
+// modified at or after since are exported. Embargoed identifiers are left out until their embargo lifts.
+// Records are read from a mongo cursor one at a time.
+func (b *Backend) ExportNamespace(ctx context.Context, guid string, format string, since time.Time, w io.Writer) (count int, err error) {
+
+	if format != ExportNDJSON && format != ExportJSONLD {
+		return 0, ErrExportFormat
+	}
+
+	_, err = b.GetNamespace(guid)
+	if err == mongo.ErrNoDocuments {
+		return 0, ErrNoNamespace
+	}
+	if err != nil {
+		return
+	}
+
+	// embargoed identifiers are left out, and exported since the time their embargo lifts
+	query := publicRecords(bson.D{{"namespace", guid}}, time.Now())
+	if !since.IsZero() {
+		query = append(query, bson.E{"_modified", bson.D{{"$gte", since.UTC()}}})
+	}
+
+	if format == ExportJSONLD {
+		_, err = io.WriteString(w, `{"@context": {"@vocab": "http://schema.org/"}, "@graph": [`+"\n")
+		if err != nil {
+			return
+		}
+	}
+
+	err = b.Mongo.Iterate(ctx, query, func(record []byte) (writeErr error) {
+
+		record = processMetadataRead(record)
+
+		if format == ExportJSONLD && count > 0 {
+			if _, writeErr = io.WriteString(w, ",\n"); writeErr != nil {
+				return
+			}
+		}
+
+		if _, writeErr = w.Write(record); writeErr != nil {
+			return
+		}
+
+		if format == ExportNDJSON {
+			if _, writeErr = io.WriteString(w, "\n"); writeErr != nil {
+				return
+			}
+		}
+
+		count++
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	if format == ExportJSONLD {
+		_, err = io.WriteString(w, "\n]}\n")
+	}
+
+	return
+}
+
+// ParseSince parses the since filter of an export, which is either a full RFC3339 timestamp or a plain date
+func ParseSince(since string) (t time.Time, err error) {
+
+	t, err = time.Parse(time.RFC3339, since)
+	if err == nil {
+		return
+	}
+
+	return time.Parse("2006-01-02", since)
+}
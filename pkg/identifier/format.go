@@ -0,0 +1,412 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClarkLabUVA/mds/pkg/jsonld"
+	"github.com/ClarkLabUVA/mds/pkg/rdf"
+	"github.com/buger/jsonparser"
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrUnknownFormat = errors.New("Unknown Format")
+	ErrNotAcceptable = errors.New("None of the Accepted Media Types can be Produced")
+)
+
+// Formats an identifier can be resolved to
+const (
+	FormatJSON      = "json"
+	FormatCompacted = "compacted"
+	FormatExpanded  = "expanded"
+	FormatFlattened = "flattened"
+	FormatTurtle    = "turtle"
+	FormatNTriples  = "ntriples"
+	FormatNQuads    = "nquads"
+	FormatRDFXML    = "rdfxml"
+)
+
+// JSON-LD profiles selecting the document form of application/ld+json
+const (
+	profileCompacted = "http://www.w3.org/ns/json-ld#compacted"
+	profileExpanded  = "http://www.w3.org/ns/json-ld#expanded"
+	profileFlattened = "http://www.w3.org/ns/json-ld#flattened"
+)
+
+// formatNames are the values accepted by the format query parameter
+var formatNames = map[string]string{
+	"json":      FormatJSON,
+	"jsonld":    FormatCompacted,
+	"json-ld":   FormatCompacted,
+	"compacted": FormatCompacted,
+	"expanded":  FormatExpanded,
+	"flattened": FormatFlattened,
+	"turtle":    FormatTurtle,
+	"ttl":       FormatTurtle,
+	"ntriples":  FormatNTriples,
+	"n-triples": FormatNTriples,
+	"nt":        FormatNTriples,
+	"nquads":    FormatNQuads,
+	"n-quads":   FormatNQuads,
+	"nq":        FormatNQuads,
+	"rdfxml":    FormatRDFXML,
+	"rdf":       FormatRDFXML,
+	"xml":       FormatRDFXML,
+}
+
+// formatMediaTypes is the Content-Type served for each format
+var formatMediaTypes = map[string]string{
+	FormatJSON:      "application/json",
+	FormatCompacted: `application/ld+json; profile="` + profileCompacted + `"`,
+	FormatExpanded:  `application/ld+json; profile="` + profileExpanded + `"`,
+	FormatFlattened: `application/ld+json; profile="` + profileFlattened + `"`,
+	FormatTurtle:    rdf.MediaTypeTurtle + "; charset=utf-8",
+	FormatNTriples:  rdf.MediaTypeNTriples,
+	FormatNQuads:    rdf.MediaTypeNQuads,
+	FormatRDFXML:    rdf.MediaTypeRDFXML,
+}
+
+// NegotiateFormat picks the format to resolve to, from the format query parameter when it is set
+// and otherwise from the Accept header, preferring plain JSON when any type is acceptable
+func NegotiateFormat(accept string, format string) (string, error) {
+
+	if format != "" {
+		if f, ok := formatNames[strings.ToLower(format)]; ok {
+			return f, nil
+		}
+		return "", fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return FormatJSON, nil
+	}
+
+	type candidate struct {
+		format string
+		q      float64
+	}
+	var candidates []candidate
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil || q <= 0 {
+				continue
+			}
+		}
+
+		if f := mediaTypeFormat(mediaType, params["profile"]); f != "" {
+			candidates = append(candidates, candidate{f, q})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", ErrNotAcceptable
+	}
+
+	// the first of the most preferred types wins
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	return candidates[0].format, nil
+}
+
+func mediaTypeFormat(mediaType string, profile string) string {
+
+	switch mediaType {
+	case "application/ld+json":
+		// the profile may list several forms, the first recognised one is used
+		for _, p := range strings.Fields(profile) {
+			switch p {
+			case profileExpanded:
+				return FormatExpanded
+			case profileFlattened:
+				return FormatFlattened
+			case profileCompacted:
+				return FormatCompacted
+			}
+		}
+		return FormatCompacted
+	case "application/json", "*/*", "application/*":
+		return FormatJSON
+	case rdf.MediaTypeTurtle, "application/x-turtle":
+		return FormatTurtle
+	case rdf.MediaTypeNTriples:
+		return FormatNTriples
+	case rdf.MediaTypeNQuads:
+		return FormatNQuads
+	case rdf.MediaTypeRDFXML:
+		return FormatRDFXML
+	}
+
+	return ""
+}
+
+// ResolveOptions controls how an identifier is resolved
+type ResolveOptions struct {
+	// Format is the serialization of the record, one of the Format constants
+	Format string
+	// Fields restricts the properties returned to these dot notation paths, all properties are returned when empty
+	Fields []string
+	// Embed selects the referenced identifiers inlined into the record
+	Embed EmbedOptions
+	// User is who resolves the identifier, only the owner of an embargoed identifier resolves its full record
+	User User
+}
+
+// Resolution is an identifier serialized for a resolve request
+type Resolution struct {
+	Body        []byte
+	ContentType string
+	// Tombstone is set when the identifier has been tombstoned
+	Tombstone bool
+	// Expires is when the identifier expires, the zero time when it doesn't
+	Expires time.Time
+	CacheInfo
+}
+
+// ResolveIdentifier returns the identifier guid serialized as opt selects, from the resolve cache when it holds it.
+// Projecting fields and inlining referenced identifiers are only supported by the JSON formats.
+func (b *Backend) ResolveIdentifier(guid string, opt ResolveOptions) (res Resolution, err error) {
+
+	// embedded records can change without guid changing, so those responses aren't cached
+	if len(opt.Embed.Properties) > 0 {
+		return b.resolveIdentifier(guid, opt)
+	}
+
+	representation := opt.representation()
+	if res, ok := b.Cache.Get(guid, representation); ok {
+		return res, nil
+	}
+
+	generation := b.Cache.Generation()
+
+	res, err = b.resolveIdentifier(guid, opt)
+	if err == nil && !res.Embargoed {
+		b.Cache.Add(guid, representation, res, generation)
+	}
+
+	return
+}
+
+func (b *Backend) resolveIdentifier(guid string, opt ResolveOptions) (res Resolution, err error) {
+
+	jsonFormat := opt.Format == FormatJSON || opt.Format == FormatCompacted
+
+	if len(opt.Embed.Properties) > 0 && !jsonFormat {
+		err = fmt.Errorf("%w: expand is only supported for json and jsonld", ErrInvalidEmbed)
+		return
+	}
+
+	if len(opt.Fields) > 0 && !jsonFormat {
+		err = fmt.Errorf("%w: fields is only supported for json and jsonld", ErrInvalidFields)
+		return
+	}
+
+	// the status is needed to tell tombstones apart, and the validators to cache the response
+	required := append([]string{"creativeWorkStatus", "expires"}, validatorFields...)
+
+	var fields []string
+	if len(opt.Fields) > 0 {
+		fields = append(append(fields, opt.Fields...), required...)
+	}
+
+	record, err := b.Mongo.FindOne(bson.D{{"_id", guid}}, fields...)
+	if err != nil {
+		return
+	}
+
+	status, _ := jsonparser.GetString(record, "creativeWorkStatus")
+	res.Tombstone = status == StatusTombstone
+	res.Expires, _ = recordExpires(record)
+
+	if res.CacheInfo, err = b.cacheInfo(guid, record); err != nil {
+		return
+	}
+
+	// until the embargo lifts others get a stub, or nothing when they are anonymous
+	if embargoed, owner := recordEmbargoed(record, time.Now()); embargoed && !maySeeEmbargoed(owner, opt.User) {
+		if opt.User.ID == "" {
+			return res, ErrEmbargoed
+		}
+
+		if record, err = b.embargoStub(guid); err != nil {
+			return
+		}
+
+		res.Body, res.ContentType, err = RenderIdentifier(record, opt.Format)
+		return
+	}
+
+	res.Body, res.ContentType, err = RenderIdentifier(record, opt.Format)
+	if err != nil || (len(opt.Embed.Properties) == 0 && len(opt.Fields) == 0) {
+		return
+	}
+
+	doc := make(map[string]interface{})
+	dec := json.NewDecoder(bytes.NewReader(res.Body))
+	dec.UseNumber()
+	if err = dec.Decode(&doc); err != nil {
+		return
+	}
+
+	if len(opt.Fields) > 0 {
+		for _, field := range required {
+			if !containsString(opt.Fields, field) {
+				delete(doc, field)
+			}
+		}
+	}
+
+	if err = embedReferences(doc, opt.Embed, b.fetchRecords); err != nil {
+		return
+	}
+
+	res.Body, err = json.Marshal(doc)
+	return
+}
+
+// RenderIdentifier serializes a stored identifier record in format, returning the body and its Content-Type.
+// The JSON formats are the stored document, every other format is produced from its expanded form.
+func RenderIdentifier(record []byte, format string) (body []byte, contentType string, err error) {
+
+	contentType = formatMediaTypes[format]
+
+	if format == FormatJSON || format == FormatCompacted {
+		return processMetadataRead(record), contentType, nil
+	}
+
+	expanded, err := expandedForm(record)
+	if err != nil {
+		return
+	}
+
+	metadata := make(map[string]interface{})
+	if err = json.Unmarshal(record, &metadata); err != nil {
+		return
+	}
+
+	var out bytes.Buffer
+
+	switch format {
+	case FormatExpanded:
+		body, err = json.Marshal(expanded)
+		return
+
+	case FormatFlattened:
+		var flattened map[string]interface{}
+		flattened, err = jsonld.Compact(jsonld.Flatten(expanded), metadata["@context"], &jsonld.Options{Loader: contextLoader})
+		if err != nil {
+			return
+		}
+
+		// flattened documents always list their nodes in @graph
+		if _, ok := flattened["@graph"]; !ok {
+			graph := map[string]interface{}{}
+			for k, v := range flattened {
+				if k != "@context" {
+					graph[k] = v
+					delete(flattened, k)
+				}
+			}
+			flattened["@graph"] = []interface{}{}
+			if len(graph) > 0 {
+				flattened["@graph"] = []interface{}{graph}
+			}
+		}
+
+		body, err = json.Marshal(flattened)
+		return
+
+	case FormatTurtle:
+		err = rdf.WriteTurtle(&out, jsonld.ToRDF(expanded), contextPrefixes(metadata["@context"]))
+	case FormatNTriples:
+		err = rdf.WriteNTriples(&out, jsonld.ToRDF(expanded))
+	case FormatNQuads:
+		err = rdf.WriteNQuads(&out, jsonld.ToRDF(expanded))
+	case FormatRDFXML:
+		err = rdf.WriteRDFXML(&out, jsonld.ToRDF(expanded), contextPrefixes(metadata["@context"]))
+	default:
+		return nil, "", fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+
+	return out.Bytes(), contentType, err
+}
+
+// expandedForm returns the stored expansion of a record, expanding records stored before expansions were kept
+func expandedForm(record []byte) (expanded []interface{}, err error) {
+
+	if stored, getErr := jsonparser.GetString(record, "_expanded"); getErr == nil {
+		dec := json.NewDecoder(strings.NewReader(stored))
+		dec.UseNumber()
+		err = dec.Decode(&expanded)
+		return
+	}
+
+	metadata := make(map[string]interface{})
+	if err = json.Unmarshal(record, &metadata); err != nil {
+		return
+	}
+
+	metadata["@context"] = mergeContext(metadata["@context"])
+
+	expandedJSON, err := expandRecord(metadata)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal([]byte(expandedJSON), &expanded)
+	return
+}
+
+// contextPrefixes adds the prefixes a record's context defines to the default prefixes, so RDF output abbreviates
+// IRIs the same way the record does
+func contextPrefixes(ctx interface{}) map[string]string {
+
+	prefixes := map[string]string{}
+	for name, ns := range rdf.DefaultPrefixes {
+		prefixes[name] = ns
+	}
+
+	var contexts []interface{}
+	if list, ok := ctx.([]interface{}); ok {
+		contexts = list
+	} else {
+		contexts = []interface{}{ctx}
+	}
+
+	for _, c := range contexts {
+		definitions, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for term, value := range definitions {
+			ns, ok := value.(string)
+			if !ok || ns == "" || strings.HasPrefix(term, "@") || strings.Contains(term, ":") || !strings.ContainsAny(ns[len(ns)-1:], "/#") {
+				continue
+			}
+			prefixes[term] = ns
+		}
+	}
+
+	return prefixes
+}
@@ -0,0 +1,111 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+
+	t.Run("Negotiate", func(t *testing.T) {
+
+		cases := []struct {
+			accept   string
+			format   string
+			expected string
+		}{
+			{"", "", FormatJSON},
+			{"*/*", "", FormatJSON},
+			{"text/turtle", "", FormatTurtle},
+			{"application/rdf+xml;q=0.5, application/n-triples", "", FormatNTriples},
+			{`application/ld+json;profile="http://www.w3.org/ns/json-ld#expanded"`, "", FormatExpanded},
+			{"application/ld+json", "", FormatCompacted},
+			{"text/html, */*;q=0.1", "", FormatJSON},
+			{"application/json", "ttl", FormatTurtle},
+			{"", "nquads", FormatNQuads},
+		}
+
+		for _, c := range cases {
+			format, err := NegotiateFormat(c.accept, c.format)
+			if err != nil || format != c.expected {
+				t.Fatalf("Accept %q format %q: expected %s, got %s %v", c.accept, c.format, c.expected, format, err)
+			}
+		}
+
+		if _, err := NegotiateFormat("text/html", ""); err != ErrNotAcceptable {
+			t.Fatalf("Unsupported Media Type was Accepted: %v", err)
+		}
+
+		if _, err := NegotiateFormat("", "yaml"); !errors.Is(err, ErrUnknownFormat) {
+			t.Fatalf("Unknown Format was Accepted: %v", err)
+		}
+	})
+
+	t.Run("Render", func(t *testing.T) {
+
+		payload := []byte(`{
+			"@context": {"prov": "http://www.w3.org/ns/prov#"},
+			"@type": "Dataset",
+			"name": "test",
+			"prov:wasGeneratedBy": {"@id": "ark:99999/computation"}
+		}`)
+
+		record, err := processMetadataWrite(payload, "ark:99999/test", User{}, "http://ors.uvadcos.io/ark:99999/test")
+		if err != nil {
+			t.Fatalf("Failed to Process Metadata: %s", err.Error())
+		}
+
+		expected := map[string][]string{
+			FormatTurtle:    {"@prefix prov: <http://www.w3.org/ns/prov#>", "<ark:99999/test> a schema:Dataset", `schema:name "test"`, "prov:wasGeneratedBy <ark:99999/computation>"},
+			FormatNTriples:  {"<ark:99999/test> <http://www.w3.org/ns/prov#wasGeneratedBy> <ark:99999/computation> ."},
+			FormatNQuads:    {"<ark:99999/test> <http://schema.org/name> \"test\" ."},
+			FormatRDFXML:    {`<rdf:Description rdf:about="ark:99999/test">`, `<prov:wasGeneratedBy rdf:resource="ark:99999/computation"/>`},
+			FormatExpanded:  {`"http://schema.org/name":[{"@value":"test"}]`},
+			FormatFlattened: {`"@graph":[{`, `"prov:wasGeneratedBy":{"@id":"ark:99999/computation"}`},
+			FormatJSON:      {`"prov:wasGeneratedBy"`},
+		}
+
+		for format, fragments := range expected {
+			body, contentType, err := RenderIdentifier(record, format)
+			if err != nil {
+				t.Fatalf("Failed to Render %s: %s", format, err.Error())
+			}
+
+			if contentType == "" {
+				t.Fatalf("No Content-Type for %s", format)
+			}
+
+			for _, fragment := range fragments {
+				if !strings.Contains(string(body), fragment) {
+					t.Fatalf("%s is Missing %s:\n%s", format, fragment, body)
+				}
+			}
+
+			if strings.Contains(string(body), "_expanded") || strings.Contains(string(body), "namespace") {
+				t.Fatalf("%s Includes Internal Fields:\n%s", format, body)
+			}
+		}
+
+		// records stored before expansions were kept are expanded when they are resolved
+		legacy := []byte(`{"_id": "ark:99999/old", "@id": "ark:99999/old", "@context": {"@vocab": "http://schema.org/"}, "name": "old", "namespace": "ark:99999"}`)
+
+		body, _, err := RenderIdentifier(legacy, FormatExpanded)
+		if err != nil {
+			t.Fatalf("Failed to Render Legacy Record: %s", err.Error())
+		}
+
+		var doc []map[string]interface{}
+		if err = json.Unmarshal(body, &doc); err != nil || len(doc) != 1 || doc[0]["@id"] != "ark:99999/old" {
+			t.Fatalf("Legacy Record was not Expanded: %s", body)
+		}
+	})
+
+}
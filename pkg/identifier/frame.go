@@ -0,0 +1,152 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ClarkLabUVA/mds/pkg/jsonld"
+	"github.com/ClarkLabUVA/mds/pkg/rdf"
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+// Limits on the graph read to be framed
+const (
+	// FrameDepth is how many properties away from the identifiers statements are read
+	FrameDepth = 5
+	// MaxFrameStatements is how many statements are read at most
+	MaxFrameStatements = 10000
+)
+
+// FrameIdentifier frames the graph connected to an identifier, or to every identifier of a namespace, up to
+// FrameDepth properties away. A frame for an identifier that doesn't select nodes by @id or @type is framed
+// around the identifier. truncated reports that the graph had more than MaxFrameStatements statements, of which
+// only some were framed.
+func (b *Backend) FrameIdentifier(guid string, frame map[string]interface{}) (framed map[string]interface{}, truncated bool, err error) {
+
+	// the identifier or namespace must exist
+	if _, err = b.Mongo.FindOne(bson.D{{"_id", guid}}); err != nil {
+		return
+	}
+
+	var quads []rdf.Quad
+
+	if isNamespace(guid) {
+		quads, err = b.Stardog.NamespaceSubgraph(guid)
+	} else {
+		quads, err = b.Stardog.Subgraph([]string{guid})
+	}
+	if err != nil {
+		return
+	}
+
+	if len(quads) > MaxFrameStatements {
+		quads, truncated = quads[:MaxFrameStatements], true
+	}
+
+	framed, err = frameGraph(quads, guid, frame)
+
+	return
+}
+
+// frameTruncationWarning is the Warning header of a frame of a graph cut short at limit statements
+func frameTruncationWarning(limit int) string {
+	return `299 - ` + strconv.Quote("Framed graph truncated at "+strconv.Itoa(limit)+" statements")
+}
+
+// frameGraph frames statements retrieved for guid, the frame's context defaults to the schema.org vocabulary
+func frameGraph(quads []rdf.Quad, guid string, frame map[string]interface{}) (map[string]interface{}, error) {
+
+	shaped := make(map[string]interface{}, len(frame)+1)
+	for k, v := range frame {
+		shaped[k] = v
+	}
+	shaped["@context"] = mergeContext(frame["@context"])
+
+	_, hasID := frame["@id"]
+	_, hasType := frame["@type"]
+	if !isNamespace(guid) && !hasID && !hasType {
+		shaped["@id"] = guid
+	}
+
+	framed, err := jsonld.Frame(jsonld.FromRDF(quads, true), shaped, &jsonld.Options{Loader: contextLoader})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMetadata, err.Error())
+	}
+
+	return framed, nil
+}
+
+func isNamespace(guid string) bool {
+	return !strings.Contains(guid, "/")
+}
+
+// subgraphQuery builds a CONSTRUCT query for the statements about the roots, or the identifiers in a namespace,
+// and the nodes up to depth properties away from them, returning at most limit statements. Each distance is a
+// path of fixed length, so the query never follows a path of any length through the graph.
+func subgraphQuery(roots []string, namespace string, depth int, limit int) (string, error) {
+
+	var root strings.Builder
+	if namespace != "" {
+		if _, err := sparqlIRI(namespace); err != nil {
+			return "", err
+		}
+		root.WriteString("{ SELECT DISTINCT ?root WHERE { ?root ?rootProperty ?rootValue . FILTER(STRSTARTS(STR(?root), " + strconv.Quote(namespace+"/") + ")) } } ")
+	} else {
+		root.WriteString("VALUES ?root {")
+		for _, r := range roots {
+			iri, err := sparqlIRI(r)
+			if err != nil {
+				return "", err
+			}
+			root.WriteString(" " + iri)
+		}
+		root.WriteString(" } ")
+	}
+
+	var query strings.Builder
+	query.WriteString("CONSTRUCT { ?s ?p ?o } WHERE { SELECT DISTINCT ?s ?p ?o WHERE { ")
+
+	for distance := 0; distance <= depth; distance++ {
+		if distance > 0 {
+			query.WriteString("UNION ")
+		}
+		query.WriteString("{ " + root.String())
+
+		if distance == 0 {
+			query.WriteString("BIND(?root AS ?s) } ")
+			continue
+		}
+
+		node := "?root"
+		for step := 1; step <= distance; step++ {
+			next := "?n" + strconv.Itoa(step)
+			if step == distance {
+				next = "?s"
+			}
+			query.WriteString(node + " ?p" + strconv.Itoa(step) + " " + next + " . ")
+			node = next
+		}
+		query.WriteString("FILTER(!isLiteral(?s)) } ")
+	}
+
+	query.WriteString("?s ?p ?o } LIMIT " + strconv.Itoa(limit) + " }")
+
+	return query.String(), nil
+}
+
+// sparqlIRI writes iri as a SPARQL IRI reference, rejecting characters that would end it
+func sparqlIRI(iri string) (string, error) {
+
+	if iri == "" || strings.ContainsAny(iri, "<>\"{}|^`\\ \t\n\r") {
+		return "", fmt.Errorf("%w: %q is not a valid IRI", ErrInvalidMetadata, iri)
+	}
+
+	return "<" + iri + ">", nil
+}
@@ -0,0 +1,80 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ClarkLabUVA/mds/pkg/rdf"
+)
+
+func TestFrame(t *testing.T) {
+
+	t.Run("Query", func(t *testing.T) {
+
+		query, err := subgraphQuery([]string{"ark:99999/data"}, "", 2, 100)
+		if err != nil || !strings.Contains(query, "VALUES ?root { <ark:99999/data> }") {
+			t.Fatalf("Incorrect Subgraph Query: %s %v", query, err)
+		}
+
+		query, err = subgraphQuery(nil, "ark:99999", 2, 100)
+		if err != nil || !strings.Contains(query, `STRSTARTS(STR(?root), "ark:99999/")`) {
+			t.Fatalf("Incorrect Namespace Query: %s %v", query, err)
+		}
+
+		if strings.Contains(query, "*") || !strings.Contains(query, "?root ?p1 ?n1 . ?n1 ?p2 ?s .") || strings.Contains(query, "?p3") || !strings.HasSuffix(query, "LIMIT 100 }") {
+			t.Fatalf("Subgraph Query is not Bounded: %s", query)
+		}
+
+		if _, err = subgraphQuery([]string{"ark:99999/x> } DELETE {"}, "", 2, 100); !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("IRI was not Escaped: %v", err)
+		}
+	})
+
+	t.Run("Graph", func(t *testing.T) {
+
+		quads, _, err := rdf.ParseTurtle(strings.NewReader(`
+@prefix schema: <http://schema.org/> .
+<ark:99999/data> a schema:Dataset ; schema:name "data" ; schema:author [ schema:name "Max" ] ; schema:generatedBy <ark:99999/comp> .
+<ark:99999/comp> a schema:Computation ; schema:usedSoftware <ark:99999/soft> .
+<ark:99999/soft> a schema:SoftwareSourceCode ; schema:name "soft" .
+`), "")
+		if err != nil {
+			t.Fatalf("Failed to Parse Graph: %s", err.Error())
+		}
+
+		framed, err := frameGraph(quads, "ark:99999/data", map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("Failed to Frame: %s", err.Error())
+		}
+
+		if framed["@id"] != "ark:99999/data" || framed["name"] != "data" {
+			t.Fatalf("Frame was not Rooted at the Identifier: %v", framed)
+		}
+
+		comp, _ := framed["generatedBy"].(map[string]interface{})
+		soft, _ := comp["usedSoftware"].(map[string]interface{})
+		if soft["name"] != "soft" {
+			t.Fatalf("Software was not Embedded: %v", framed)
+		}
+
+		framed, err = frameGraph(quads, "ark:99999/data", map[string]interface{}{"@type": "Computation", "@explicit": true, "usedSoftware": map[string]interface{}{}})
+		if err != nil {
+			t.Fatalf("Failed to Frame: %s", err.Error())
+		}
+
+		if framed["@id"] != "ark:99999/comp" || framed["@type"] != "Computation" {
+			t.Fatalf("Frame @type was not Used: %v", framed)
+		}
+
+		if _, err = frameGraph(quads, "ark:99999/data", map[string]interface{}{"@embed": "sometimes"}); !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("Invalid Frame was Accepted: %v", err)
+		}
+	})
+}
@@ -1,12 +1,17 @@
 package identifier
 
 import (
+	"bytes"
 	"net/http"
 	"github.com/gorilla/mux"
 	"io/ioutil"
 	"strings"
 	"github.com/google/uuid"
+	mongo "go.mongodb.org/mongo-driver/mongo"
 	"encoding/json"
+	"errors"
+	"mime"
+	"time"
 )
 
 
@@ -49,6 +54,11 @@ func (b *Backend) CreateArkNamespaceHandler(w http.ResponseWriter, r *http.Reque
 			serveJSON(w, 400, map[string]interface{}{"error": err.Error()})
 
 		default:
+			if errors.Is(err, ErrInvalidMetadata) {
+				serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Namespace Policy"})
+				return
+			}
+
 			serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Creating Namespace"})
 
 	}
@@ -110,6 +120,11 @@ func (b *Backend) UpdateArkNamespaceHandler(w http.ResponseWriter, r *http.Reque
 
 	update, err := ioutil.ReadAll(r.Body)
 
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Error reading in payload"})
+		return
+	}
+
 	response, err := b.UpdateNamespace(guid, update)
 
 	switch err {
@@ -117,10 +132,233 @@ func (b *Backend) UpdateArkNamespaceHandler(w http.ResponseWriter, r *http.Reque
 		w.WriteHeader(200)
 		w.Write(response)
 
+	case ErrNoNamespace:
+		serveJSON(w, 404, map[string]interface{}{"error": "Namespace Not Found"})
+
 	default:
-		w.Write([]byte(`{"error": "` + err.Error() + `"}`))
-		w.WriteHeader(500)
+		if errors.Is(err, ErrInvalidMetadata) {
+			serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Namespace Policy"})
+			return
+		}
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Updating Namespace"})
+
+	}
+
+	return
+
+}
+
+
+//DeleteArkNamespaceHandler is the http handler for deleting identifier namespaces.
+//Namespaces holding identifiers are only deleted when ?cascade=remove or ?cascade=tombstone is given
+func (b *Backend) DeleteArkNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+
+    /*
+	// extract user from request context
+	var u User
+	contextUser := r.Context().Value("user")
+	u = contextUser.(User)
+
+	// if user is not an admin return a 403 error
+	if u.Role != "admin" {
+		serveJSON(w, 403, map[string]interface{}{"error": "action not permitted", "message": "only admins may delete ark namespaces"})
+		return 
+	}
+    */
+
+	vars := mux.Vars(r)
+	guid := "ark:" + vars["prefix"]
+
+	response, err := b.DeleteNamespace(guid, r.URL.Query().Get("cascade"))
+
+	switch err {
+	case nil:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"deleted": ` + string(response) + `}`))
+
+	case ErrNoNamespace:
+		serveJSON(w, 404, map[string]interface{}{"error": "Namespace Not Found"})
+
+	case ErrNamespaceNotEmpty:
+		serveJSON(w, 409, map[string]interface{}{"error": err.Error(), "message": "use ?cascade=remove or ?cascade=tombstone to delete the identifiers in " + guid})
+
+	case ErrCascade:
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "cascade must be one of remove, tombstone"})
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Deleting Namespace"})
+
+	}
 
+	return
+
+}
+
+
+//ExportArkNamespaceHandler streams every identifier in a namespace as NDJSON or as a JSON-LD @graph
+func (b *Backend) ExportArkNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	guid := "ark:" + vars["prefix"]
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = ExportNDJSON
+		if strings.Contains(r.Header.Get("Accept"), "application/ld+json") {
+			format = ExportJSONLD
+		}
+	}
+
+	var since time.Time
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		var err error
+		since, err = ParseSince(sinceParam)
+		if err != nil {
+			serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "since must be an RFC3339 timestamp or a date"})
+			return
+		}
+	}
+
+	// check the namespace before committing to a streamed 200 response
+	_, err := b.GetNamespace(guid)
+	if err != nil {
+		serveJSON(w, 404, map[string]interface{}{"error": "Namespace " + guid + " does not exist"})
+		return
+	}
+
+	switch format {
+	case ExportNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	case ExportJSONLD:
+		w.Header().Set("Content-Type", "application/ld+json")
+	default:
+		serveJSON(w, 400, map[string]interface{}{"error": ErrExportFormat.Error(), "message": "format must be one of ndjson, jsonld"})
+		return
+	}
+	w.WriteHeader(200)
+
+	count, err := b.ExportNamespace(r.Context(), guid, format, since, w)
+
+	// the status line has already been sent, so errors can only be logged
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "ExportNamespace").
+			Str("namespace", guid).
+			Int("count", count).
+			Msg("export terminated early")
+	}
+
+	return
+
+}
+
+
+//ImportArkNamespaceHandler loads an NDJSON or JSON-LD dump into a namespace, keeping the ARKs of each record
+func (b *Backend) ImportArkNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+
+	u := userFromRequest(r)
+
+	vars := mux.Vars(r)
+	guid := "ark:" + vars["prefix"]
+
+	policy := r.URL.Query().Get("policy")
+	if policy == "" {
+		policy = ImportFail
+	}
+
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	report, err := b.ImportNamespace(guid, r.Body, policy, dryRun, u)
+
+	switch {
+	case err == nil:
+		serveJSON(w, 200, report)
+
+	case err == ErrImportConflict:
+		serveJSON(w, 409, report)
+
+	case err == ErrImportPolicy:
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "policy must be one of skip, overwrite, fail"})
+
+	case err == ErrNoNamespace:
+		serveJSON(w, 404, map[string]interface{}{"error": "Namespace " + guid + " does not exist"})
+
+	case errors.Is(err, ErrJSONUnmarshal):
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Error reading in payload"})
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Importing Namespace"})
+	}
+
+	return
+
+}
+
+
+//ListArkNamespacesHandler is the http handler for listing identifier namespaces
+func (b *Backend) ListArkNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+
+	opt, err := ParseFindOptions(query.Get("limit"), query.Get("cursor"), query.Get("sort"), query.Get("fields"))
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	page, err := b.ListNamespaces(opt)
+
+	switch err {
+	case nil:
+		serveJSON(w, 200, page)
+
+	case ErrInvalidCursor:
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error()})
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Listing Namespaces"})
+	}
+
+	return
+
+}
+
+
+//ListArkIdentifiersHandler is the http handler for listing the identifiers in a namespace
+func (b *Backend) ListArkIdentifiersHandler(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	guid := "ark:" + vars["prefix"]
+
+	query := r.URL.Query()
+
+	opt, err := ParseFindOptions(query.Get("limit"), query.Get("cursor"), query.Get("sort"), query.Get("fields"))
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	var types []string
+	for _, t := range query["@type"] {
+		types = append(types, strings.Split(t, ",")...)
+	}
+
+	page, err := b.ListIdentifiers(guid, types, opt)
+
+	switch err {
+	case nil:
+		serveJSON(w, 200, page)
+
+	case ErrNoNamespace:
+		serveJSON(w, 404, map[string]interface{}{"error": "Namespace " + guid + " does not exist"})
+
+	case ErrInvalidCursor:
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error()})
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Listing Identifiers"})
 	}
 
 	return
@@ -131,27 +369,222 @@ func (b *Backend) UpdateArkNamespaceHandler(w http.ResponseWriter, r *http.Reque
 //ArkResolveHandler 
 func (b *Backend) ArkResolveHandler(w http.ResponseWriter, r *http.Request) {
 
-	guid := strings.TrimPrefix(r.RequestURI, "/")
+	// the identifiers referring to an identifier are listed under its ARK
+	if strings.HasSuffix(requestGUID(r), "/references") {
+		b.ArkReferencesHandler(w, r)
+		return
+	}
+
+	guid := requestGUID(r)
+
+	format, err := NegotiateFormat(r.Header.Get("Accept"), r.URL.Query().Get("format"))
+
+	switch {
+	case err == nil:
 
-	identifier, err := b.GetIdentifier(guid)
+	case errors.Is(err, ErrUnknownFormat):
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "format must be one of json, jsonld, expanded, flattened, turtle, ntriples, nquads or rdfxml"})
+		return
+
+	default:
+		serveJSON(w, 406, map[string]interface{}{"error": err.Error()})
+		return
+	}
 
+	embed, err := ParseEmbedOptions(r.URL.Query().Get("expand"), r.URL.Query().Get("depth"))
 	if err != nil {
-		serveJSON(w, 500, map[string]interface{}{"error": err.Error()})
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	fields, err := ParseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	// embedded records change without the identifier changing, so they have no validators
+	tagged := len(embed.Properties) == 0
+
+	// conditional requests are answered from the validators alone when nothing has changed
+	if tagged && (r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "") {
+		info, err := b.IdentifierCacheInfo(guid)
+		if err == nil && !info.Embargoed && notModified(r, info) {
+			setCacheHeaders(w, info, true)
+			w.WriteHeader(304)
+			return
+		}
+	}
+
+	res, err := b.ResolveIdentifier(guid, ResolveOptions{Format: format, Fields: fields, Embed: embed, User: userFromRequest(r)})
+
+	switch {
+	case err == nil:
+
+	case err == ErrEmbargoed:
+		serveJSON(w, 403, map[string]interface{}{"error": err.Error(), "message": "Identifier " + guid + " is embargoed, sign in to see its stub"})
+		return
+
+	case errors.Is(err, ErrInvalidEmbed), errors.Is(err, ErrInvalidFields):
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error()})
+		return
+
+	case err == mongo.ErrNoDocuments:
+		serveJSON(w, 404, map[string]interface{}{"error": "Identifier " + guid + " does not exist"})
+		return
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Resolving Identifier"})
+		return
+	}
+
+	w.Header().Set("Content-Type", res.ContentType)
+	setCacheHeaders(w, res.CacheInfo, tagged)
+
+	// expired identifiers still resolve, with a warning
+	if !res.Expires.IsZero() && !res.Expires.After(time.Now()) {
+		w.Header().Set("Warning", expiryWarning(res.Expires))
+	}
+
+	// tombstones still resolve, but report that the metadata is gone
+	if res.Tombstone {
+		w.WriteHeader(410)
+		w.Write(res.Body)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	w.Write(identifier)
+	w.Write(res.Body)
 	return
 
 }
 
+//ArkFrameHandler
+func (b *Backend) ArkFrameHandler(w http.ResponseWriter, r *http.Request) {
+
+	guid := strings.TrimPrefix(requestGUID(r), "frame/")
+
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Error reading in payload"})
+		return
+	}
+
+	frame := make(map[string]interface{})
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err = dec.Decode(&frame); err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "frame must be a JSON-LD object"})
+		return
+	}
+
+	framed, truncated, err := b.FrameIdentifier(guid, frame)
+
+	switch {
+	case err == nil:
+
+	case err == mongo.ErrNoDocuments:
+		serveJSON(w, 404, map[string]interface{}{"error": "Identifier " + guid + " does not exist"})
+		return
+
+	case errors.Is(err, ErrInvalidMetadata):
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Frame"})
+		return
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Framing Identifier"})
+		return
+	}
+
+	body, err := json.Marshal(framed)
+	if err != nil {
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Framing Identifier"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/ld+json")
+	if truncated {
+		w.Header().Set("Warning", frameTruncationWarning(MaxFrameStatements))
+	}
+	w.WriteHeader(200)
+	w.Write(body)
+}
+
+// ArkReferencesHandler lists the identifiers referring to an identifier, grouped by the property that refers to it
+func (b *Backend) ArkReferencesHandler(w http.ResponseWriter, r *http.Request) {
+
+	guid := normalizeArk(strings.TrimSuffix(requestGUID(r), "/references"))
+
+	inbound, err := b.ReferencesTo(guid)
+
+	switch {
+	case err == nil:
+		serveJSON(w, 200, inbound)
+
+	case err == mongo.ErrNoDocuments:
+		serveJSON(w, 404, map[string]interface{}{"error": "Identifier " + guid + " does not exist"})
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Finding References"})
+	}
+}
+
+// EvidenceGraphHandler returns the provenance graph around an identifier as JSON-LD
+func (b *Backend) EvidenceGraphHandler(w http.ResponseWriter, r *http.Request) {
+
+	guid := normalizeArk(strings.TrimPrefix(requestGUID(r), "evidencegraph/"))
+
+	query := r.URL.Query()
+	opt, err := ParseTraversalOptions(query.Get("depth"), query.Get("direction"), query.Get("properties"), query.Get("limit"))
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Evidence Graph Option"})
+		return
+	}
+
+	graph, truncated, err := b.EvidenceGraph(guid, opt)
+
+	switch {
+	case err == nil:
+
+	case err == mongo.ErrNoDocuments:
+		serveJSON(w, 404, map[string]interface{}{"error": "Identifier " + guid + " does not exist"})
+		return
+
+	case errors.Is(err, ErrInvalidMetadata):
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Identifier"})
+		return
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Building Evidence Graph"})
+		return
+	}
+
+	body, err := json.Marshal(graph)
+	if err != nil {
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Building Evidence Graph"})
+		return
+	}
+
+	// a graph cut short at the node limit is still returned
+	if truncated {
+		w.Header().Set("Warning", truncationWarning(opt.MaxNodes))
+	}
+
+	w.Header().Set("Content-Type", "application/ld+json")
+	w.WriteHeader(200)
+	w.Write(body)
+}
+
+// requestGUID is the identifier addressed by the path of a request, which may contain slashes
+func requestGUID(r *http.Request) string {
+	return strings.TrimPrefix(strings.SplitN(r.RequestURI, "?", 2)[0], "/")
+}
+
 
 //ArkCreateHandler
 func (b *Backend) ArkCreateHandler(w http.ResponseWriter, r *http.Request) {
 
-	var u User
+	u := userFromRequest(r)
     /*
 	// extract user from request context
 	var err error
@@ -165,7 +598,7 @@ func (b *Backend) ArkCreateHandler(w http.ResponseWriter, r *http.Request) {
 
     */
 
-	guid := strings.TrimPrefix(r.RequestURI, "/")
+	guid := requestGUID(r)
 
 	splitPath := strings.Split(guid, "/")
 	namespace := splitPath[0]
@@ -189,19 +622,37 @@ func (b *Backend) ArkCreateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	bodyBytes, err = requestMetadata(r.Header.Get("Content-Type"), bodyBytes, guid)
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Metadata"})
+		return
+	}
+
 	err = b.CreateIdentifier(guid, bodyBytes, u)
 
-	switch err {
-	case nil:
+	switch {
+	case err == nil:
+		if warning := b.referenceWarning(guid); warning != "" {
+			w.Header().Set("Warning", warning)
+		}
 		serveJSON(w, 201, map[string]interface{}{"created": guid})
 
-	case ErrNoNamespace:
+	case err == ErrNoNamespace:
 		serveJSON(w, 404, map[string]interface{}{"error": "Namespace ark:" + namespace + " does not exist"})
 
-	case ErrAlreadyExists:
+	case err == ErrAlreadyExists:
 		serveJSON(w, 400, map[string]interface{}{"error": "Identifier ark:" + guid + " already exists"})
 
-	case ErrInvalidMetadata:
+	case err == ErrReserved:
+		serveJSON(w, 403, map[string]interface{}{"error": err.Error(), "message": "only the user who reserved the identifier may fill it in"})
+
+	case err == ErrNotPermitted:
+		serveJSON(w, 403, map[string]interface{}{"error": err.Error(), "message": "namespace policy does not allow this user to mint identifiers"})
+
+	case errors.Is(err, ErrDanglingReference):
+		serveJSON(w, 422, map[string]interface{}{"error": err.Error(), "message": "metadata refers to identifiers that do not exist"})
+
+	case errors.Is(err, ErrInvalidMetadata):
 		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Metadata"})
 
 	default:
@@ -215,7 +666,7 @@ func (b *Backend) ArkCreateHandler(w http.ResponseWriter, r *http.Request) {
 //ArkMintHandler
 func (b *Backend) ArkMintHandler(w http.ResponseWriter, r *http.Request) {
 
-	var u User
+	u := userFromRequest(r)
     /*
 	// extract user from request context
 	contextUser := r.Context().Value("user")
@@ -238,6 +689,17 @@ func (b *Backend) ArkMintHandler(w http.ResponseWriter, r *http.Request) {
 	// get vars from path
 	vars := mux.Vars(r)
 
+	// a retried request with the same Idempotency-Key is answered with the identifier the first one minted
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	fingerprint := IdempotencyFingerprint(r.Header.Get("Content-Type"), bodyBytes)
+	if idempotencyKey != "" {
+		idempotencyKey, err = ParseIdempotencyKey(idempotencyKey, "ark:"+vars["prefix"], u)
+		if err != nil {
+			serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Idempotency-Key must be at most 255 printable ASCII characters"})
+			return
+		}
+	}
+
 	// create a uuid
 	identifierUUID := uuid.New()
 
@@ -255,18 +717,49 @@ func (b *Backend) ArkMintHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	bodyBytes, err = requestMetadata(r.Header.Get("Content-Type"), bodyBytes, guid)
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Metadata"})
+		return
+	}
+
 	// store identifier record
-	err = b.CreateIdentifier(guid, bodyBytes, u)
+	mint := func() error { return b.CreateIdentifier(guid, bodyBytes, u) }
 
-	switch err {
+	minted := guid
+	if idempotencyKey != "" {
+		minted, err = b.MintOnce(idempotencyKey, fingerprint, guid, mint)
+	} else {
+		err = mint()
+	}
 
-	case nil:
-		serveJSON(w, 201, map[string]interface{}{"created": guid})
+	switch {
 
-	case ErrNoNamespace:
+	case err == nil:
+		if minted != guid {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		if warning := b.referenceWarning(minted); warning != "" {
+			w.Header().Set("Warning", warning)
+		}
+		serveJSON(w, 201, map[string]interface{}{"created": minted})
+
+	case err == ErrIdempotencyKeyReused:
+		serveJSON(w, 422, map[string]interface{}{"error": err.Error(), "message": "Idempotency-Key was already used to mint an identifier with a different payload"})
+
+	case err == ErrIdempotencyKeyInProgress:
+		serveJSON(w, 409, map[string]interface{}{"error": err.Error(), "message": "a request with this Idempotency-Key is still minting, retry later"})
+
+	case err == ErrNoNamespace:
 		serveJSON(w, 404, map[string]interface{}{"error": "Namespace ark:" + vars["prefix"] + " does not exist"})
 
-	case ErrInvalidMetadata:
+	case err == ErrNotPermitted:
+		serveJSON(w, 403, map[string]interface{}{"error": err.Error(), "message": "namespace policy does not allow this user to mint identifiers"})
+
+	case errors.Is(err, ErrDanglingReference):
+		serveJSON(w, 422, map[string]interface{}{"error": err.Error(), "message": "metadata refers to identifiers that do not exist"})
+
+	case errors.Is(err, ErrInvalidMetadata):
 		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Metadata"})
 
 	default:
@@ -278,12 +771,49 @@ func (b *Backend) ArkMintHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 
-//ArkUpdateHandler
-func (b *Backend) ArkUpdateHandler(w http.ResponseWriter, r *http.Request) {
+//ArkReserveHandler
+func (b *Backend) ArkReserveHandler(w http.ResponseWriter, r *http.Request) {
+
+	u := userFromRequest(r)
 
 	// get vars from path
 	vars := mux.Vars(r)
-	guid := "ark:" + vars["prefix"] + "/" + vars["suffix"]
+
+	// a reservation lasts until the requested expiry, or the reservation TTL
+	expires, err := b.ParseReservationExpiry(r.URL.Query().Get("expires"), time.Now())
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "expires must be an RFC 3339 time within the reservation TTL"})
+		return
+	}
+
+	guid := "ark:" + vars["prefix"] + "/" + uuid.New().String()
+
+	identifier, err := b.ReserveIdentifier(guid, u, expires)
+
+	switch {
+
+	case err == nil:
+		serveJSON(w, 201, map[string]interface{}{"reserved": guid, "expires": expires.UTC().Format(time.RFC3339), "identifier": json.RawMessage(identifier)})
+
+	case err == ErrNoNamespace:
+		serveJSON(w, 404, map[string]interface{}{"error": "Namespace ark:" + vars["prefix"] + " does not exist"})
+
+	case err == ErrNotPermitted:
+		serveJSON(w, 403, map[string]interface{}{"error": err.Error(), "message": "namespace policy does not allow this user to mint identifiers"})
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Reserving Identifier"})
+	}
+
+	return
+}
+
+
+//ArkUpdateHandler
+func (b *Backend) ArkUpdateHandler(w http.ResponseWriter, r *http.Request) {
+
+	// the suffix may itself contain slashes, so the guid is read from the whole path
+	guid := normalizeArk(requestGUID(r))
 
     /*
 	// extract user from request context
@@ -316,20 +846,127 @@ func (b *Backend) ArkUpdateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	update, err = requestMetadata(r.Header.Get("Content-Type"), update, guid)
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Metadata"})
+		return
+	}
+
+	identifier, err := b.UpdateIdentifier(guid, update, userFromRequest(r), ParseIfMatch(r.Header.Get("If-Match")))
 
+	switch {
+	case err == nil:
 
-	identifier, err := b.UpdateIdentifier(guid, update)
+	case err == mongo.ErrNoDocuments:
+		serveJSON(w, 404, map[string]interface{}{"error": "Identifier " + guid + " does not exist"})
+		return
+
+	case err == ErrReserved:
+		serveJSON(w, 403, map[string]interface{}{"error": err.Error(), "message": "only the user who reserved the identifier may fill it in"})
+		return
 
+	case err == ErrPreconditionFailed:
+		serveJSON(w, 412, map[string]interface{}{"error": err.Error(), "message": "Identifier has Changed since it was Read"})
+		return
+
+	case errors.Is(err, ErrDanglingReference):
+		serveJSON(w, 422, map[string]interface{}{"error": err.Error(), "message": "metadata refers to identifiers that do not exist"})
+		return
+
+	case errors.Is(err, ErrInvalidMetadata):
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Metadata"})
+		return
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Updating Identifier"})
+		return
+	}
+
+	b.serveUpdated(w, r, guid, identifier)
+
+	return
+
+}
+
+
+// serveUpdated answers an update with the updated metadata, as the user who made it may resolve it
+func (b *Backend) serveUpdated(w http.ResponseWriter, r *http.Request, guid string, identifier []byte) {
+
+	updated, err := recordView(identifier, userFromRequest(r), time.Now())
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(500)
-		w.Write([]byte(`{"error": ` + err.Error() + `}`))
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Updating Identifier"})
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", ETag(recordRevision(identifier)))
+	if warning := b.referenceWarning(guid); warning != "" {
+		w.Header().Set("Warning", warning)
+	}
 	w.WriteHeader(200)
-	w.Write([]byte(`{"updated": ` + string(identifier) + `}`))
+	w.Write([]byte(`{"updated": ` + string(updated) + `}`))
+}
+
+
+//ArkPatchHandler
+func (b *Backend) ArkPatchHandler(w http.ResponseWriter, r *http.Request) {
+
+	// the suffix may itself contain slashes, so the guid is read from the whole path
+	guid := normalizeArk(requestGUID(r))
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != MediaTypeMergePatch && mediaType != MediaTypeJSONPatch) {
+		w.Header().Set("Accept-Patch", MediaTypeMergePatch+", "+MediaTypeJSONPatch)
+		serveJSON(w, 415, map[string]interface{}{"error": ErrUnsupportedPatch.Error(), "message": "Content-Type must be " + MediaTypeMergePatch + " or " + MediaTypeJSONPatch})
+		return
+	}
+
+	patch, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Error reading in payload"})
+		return
+	}
+
+	identifier, err := b.PatchIdentifier(guid, patch, mediaType, userFromRequest(r), ParseIfMatch(r.Header.Get("If-Match")))
+
+	switch {
+	case err == nil:
+
+	case err == mongo.ErrNoDocuments:
+		serveJSON(w, 404, map[string]interface{}{"error": "Identifier " + guid + " does not exist"})
+		return
+
+	case err == ErrReserved:
+		serveJSON(w, 403, map[string]interface{}{"error": err.Error(), "message": "only the user who reserved the identifier may fill it in"})
+		return
+
+	case err == ErrPreconditionFailed:
+		serveJSON(w, 412, map[string]interface{}{"error": err.Error(), "message": "Identifier has Changed since it was Read"})
+		return
+
+	case errors.Is(err, ErrInvalidPatch):
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Patch"})
+		return
+
+	case errors.Is(err, ErrPatchConflict):
+		serveJSON(w, 409, map[string]interface{}{"error": err.Error(), "message": "Patch Cannot be Applied"})
+		return
+
+	case errors.Is(err, ErrDanglingReference):
+		serveJSON(w, 422, map[string]interface{}{"error": err.Error(), "message": "metadata refers to identifiers that do not exist"})
+		return
+
+	case errors.Is(err, ErrInvalidMetadata):
+		serveJSON(w, 400, map[string]interface{}{"error": err.Error(), "message": "Invalid Metadata"})
+		return
+
+	default:
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Updating Identifier"})
+		return
+	}
+
+	b.serveUpdated(w, r, guid, identifier)
 
 	return
 
@@ -339,9 +976,8 @@ func (b *Backend) ArkUpdateHandler(w http.ResponseWriter, r *http.Request) {
 //ArkDeleteHandler
 func (b *Backend) ArkDeleteHandler(w http.ResponseWriter, r *http.Request) {
 
-	// get vars from path
-	vars := mux.Vars(r)
-	guid := "ark:" + vars["prefix"] + "/" + vars["suffix"]
+	// the suffix may itself contain slashes, so the guid is read from the whole path
+	guid := normalizeArk(requestGUID(r))
 	
     /*
 	// extract user from request context
@@ -364,18 +1000,43 @@ func (b *Backend) ArkDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	}
     */
 
-	identifier, err := b.DeleteIdentifier(guid)
+	// identifiers other identifiers refer to are only deleted when forced
+	force := r.URL.Query().Get("force") == "true"
 
-	if err != nil {
+	identifier, err := b.DeleteIdentifier(guid, ParseIfMatch(r.Header.Get("If-Match")), force)
+
+	switch {
+	case err == nil:
+
+	case err == mongo.ErrNoDocuments:
+		serveJSON(w, 404, map[string]interface{}{"error": "Identifier " + guid + " does not exist"})
+		return
+
+	case errors.Is(err, ErrReferenced):
+		serveJSON(w, 409, map[string]interface{}{"error": err.Error(), "message": "other identifiers refer to this identifier, delete with force=true to remove it anyway"})
+		return
+
+	case err == ErrPreconditionFailed:
+		serveJSON(w, 412, map[string]interface{}{"error": err.Error(), "message": "Identifier has Changed since it was Read"})
+		return
+
+	default:
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(500)
 		w.Write([]byte(`{"error": ` + err.Error() + `}`))
 		return
 	}
 
+	// the deleted metadata is returned as it resolved, without the fields the service keeps for itself
+	deleted, err := recordView(identifier, userFromRequest(r), time.Now())
+	if err != nil {
+		serveJSON(w, 500, map[string]interface{}{"error": err.Error(), "message": "Error Deleting Identifier"})
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	w.Write([]byte(`{"deleted": ` + string(identifier) + `}`))
+	w.Write([]byte(`{"deleted": ` + string(deleted) + `}`))
 
 	return
 
@@ -0,0 +1,156 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mime"
+	"strings"
+	"time"
+)
+
+// DefaultIdempotencyWindow is how long an Idempotency-Key is remembered when no window is configured
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// idempotencyClaimTimeout is how long a mint may hold a key before it is considered abandoned, such as by a
+// server that stopped mid request, and another request with the key may mint instead
+const idempotencyClaimTimeout = time.Minute
+
+// maxIdempotencyKeyLength bounds the keys accepted from clients
+const maxIdempotencyKeyLength = 255
+
+var (
+	ErrInvalidIdempotencyKey    = errors.New("Invalid Idempotency Key")
+	ErrIdempotencyKeyReused     = errors.New("Idempotency Key Reused With a Different Payload")
+	ErrIdempotencyKeyInProgress = errors.New("Idempotency Key In Progress")
+)
+
+// IdempotencyClaim records the identifier minted for an Idempotency-Key
+type IdempotencyClaim struct {
+	// Key is the Idempotency-Key scoped to the namespace and user that sent it
+	Key string `bson:"_id"`
+	// Fingerprint is the hash of the payload the key was first sent with
+	Fingerprint string `bson:"fingerprint"`
+	// GUID is the identifier minted for the key
+	GUID string `bson:"guid"`
+	// Claimed is when the key was first sent, keys are forgotten once the idempotency window has passed since
+	Claimed time.Time `bson:"claimed"`
+	// Completed is set once the identifier is minted
+	Completed bool `bson:"completed"`
+}
+
+// ParseIdempotencyKey checks an Idempotency-Key header and scopes it to the namespace and user minting with it,
+// so that clients choosing the same key don't collide
+func ParseIdempotencyKey(header string, namespace string, author User) (string, error) {
+
+	if len(header) > maxIdempotencyKeyLength {
+		return "", ErrInvalidIdempotencyKey
+	}
+
+	for _, c := range header {
+		if c < 0x20 || c > 0x7e {
+			return "", ErrInvalidIdempotencyKey
+		}
+	}
+
+	return strings.Join([]string{namespace, author.ID, header}, "\n"), nil
+}
+
+// IdempotencyFingerprint hashes a mint request, a key reused with a different fingerprint is rejected
+func IdempotencyFingerprint(contentType string, payload []byte) string {
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(contentType + "\n"))
+	hash.Write(payload)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (b *Backend) idempotencyWindow() time.Duration {
+
+	if b.IdempotencyWindow > 0 {
+		return b.IdempotencyWindow
+	}
+
+	return DefaultIdempotencyWindow
+}
+
+// EnsureIdempotencyIndex has mongo forget idempotency keys once the idempotency window has passed
+func (b *Backend) EnsureIdempotencyIndex() error {
+	return b.Mongo.EnsureIdempotencyIndex(b.idempotencyWindow())
+}
+
+// MintOnce calls mint to mint guid unless key was already used within the idempotency window, in which case the
+// identifier minted for it is returned without calling mint. A key reused with a different fingerprint returns
+// ErrIdempotencyKeyReused, and one whose first request is still minting ErrIdempotencyKeyInProgress.
+// When mint fails the key is released, so that a retry can mint.
+func (b *Backend) MintOnce(key string, fingerprint string, guid string, mint func() error) (minted string, err error) {
+
+	// mongo stores times to the millisecond, the claim is matched by its time when completed or released
+	claim := IdempotencyClaim{
+		Key:         key,
+		Fingerprint: fingerprint,
+		GUID:        guid,
+		Claimed:     time.Now().UTC().Truncate(time.Millisecond),
+	}
+
+	claimed := false
+	for attempt := 0; attempt < 2; attempt++ {
+
+		var held IdempotencyClaim
+		held, claimed, err = b.Mongo.ClaimIdempotencyKey(claim)
+		if err != nil {
+			return "", err
+		}
+		if claimed {
+			break
+		}
+
+		age := claim.Claimed.Sub(held.Claimed)
+
+		switch {
+
+		// mongo removes expired keys about once a minute, until then they are taken over here, as are
+		// abandoned claims
+		case age >= b.idempotencyWindow() || (!held.Completed && age >= idempotencyClaimTimeout):
+			if err = b.Mongo.ReleaseIdempotencyKey(held); err != nil {
+				return "", err
+			}
+
+		case held.Fingerprint != fingerprint:
+			return "", ErrIdempotencyKeyReused
+
+		case !held.Completed:
+			return "", ErrIdempotencyKeyInProgress
+
+		default:
+			return held.GUID, nil
+		}
+	}
+
+	// another request took over the key between releasing and claiming it
+	if !claimed {
+		return "", ErrIdempotencyKeyInProgress
+	}
+
+	if err = mint(); err != nil {
+		b.Mongo.ReleaseIdempotencyKey(claim)
+		return "", err
+	}
+
+	// the identifier is minted even if this fails, the failure is logged and retries are answered as in progress
+	// until the claim times out
+	b.Mongo.CompleteIdempotencyKey(claim)
+
+	return guid, nil
+}
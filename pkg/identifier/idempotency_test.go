@@ -0,0 +1,57 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+
+	t.Run("Scope", func(t *testing.T) {
+
+		user := User{ID: "https://orcid.org/0000-0000-0000-0000"}
+		other := User{ID: "https://orcid.org/1111-1111-1111-1111"}
+
+		key, err := ParseIdempotencyKey("run-42", "ark:99999", user)
+		if err != nil {
+			t.Fatalf("Valid Key was Rejected: %s", err.Error())
+		}
+
+		otherUser, _ := ParseIdempotencyKey("run-42", "ark:99999", other)
+		otherNamespace, _ := ParseIdempotencyKey("run-42", "ark:11111", user)
+		if key == otherUser || key == otherNamespace {
+			t.Fatalf("Key was not Scoped to the User and Namespace")
+		}
+
+		for _, header := range []string{"run\n42", "ключ", strings.Repeat("k", 256)} {
+			if _, err = ParseIdempotencyKey(header, "ark:99999", user); err != ErrInvalidIdempotencyKey {
+				t.Fatalf("Invalid Key was Accepted %q", header)
+			}
+		}
+	})
+
+	t.Run("Fingerprint", func(t *testing.T) {
+
+		payload := []byte(`{"name": "test"}`)
+		fingerprint := IdempotencyFingerprint("application/json", payload)
+
+		if IdempotencyFingerprint("application/json; charset=utf-8", payload) != fingerprint {
+			t.Fatalf("Media Type Parameters Changed the Fingerprint")
+		}
+
+		if IdempotencyFingerprint("application/json", []byte(`{"name": "other"}`)) == fingerprint {
+			t.Fatalf("Different Payloads Have the Same Fingerprint")
+		}
+
+		if IdempotencyFingerprint("text/turtle", payload) == fingerprint {
+			t.Fatalf("Different Content Types Have the Same Fingerprint")
+		}
+	})
+
+}
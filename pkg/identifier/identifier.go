@@ -7,9 +7,11 @@
 package identifier
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	bson "go.mongodb.org/mongo-driver/bson"
 	mongo "go.mongodb.org/mongo-driver/mongo"
 	"strings"
@@ -24,11 +26,58 @@ var ErrAlreadyExists = errors.New("Document Already Exists")
 var ErrNoNamespace = errors.New("No Namespace Record Found")
 var ErrMissingProp = errors.New("Instance is missing required properties")
 var ErrJSONUnmarshal = errors.New("Failed to Unmarshal JSON")
+var ErrNamespaceNotEmpty = errors.New("Namespace Still Contains Identifiers")
+var ErrCascade = errors.New("Unsupported Cascade Option")
+
+// StatusTombstone is the creativeWorkStatus of an identifier whose metadata has been removed
+const StatusTombstone = "Tombstone"
 
 type Backend struct {
 	Mongo      MongoServer
 	Stardog    StardogServer
 	useStardog bool
+	// BaseURL is the public address of the deployment, substituted for {base} in url templates
+	BaseURL string
+	// URLTemplate builds the url of identifiers in namespaces whose policy doesn't set urlTemplate
+	URLTemplate string
+	// Cache holds rendered resolve responses, nothing is cached when it is nil
+	Cache *ResolveCache
+	// IdempotencyWindow is how long Idempotency-Keys of mint requests are remembered, DefaultIdempotencyWindow when 0
+	IdempotencyWindow time.Duration
+	// ReservationTTL is how long reservations last by default, and at most, DefaultReservationTTL when 0
+	ReservationTTL time.Duration
+	// ReservationExpiry is what happens to reservations that expire, ReservationRelease when empty or ReservationFlag
+	ReservationExpiry string
+	// EventWebhook is posted the events the service emits, such as embargoes lifting, when it is set
+	EventWebhook string
+	// ExpiryAction is what happens to identifiers once their expires passes, unless their namespace policy sets it,
+	// ExpiryWarn when empty
+	ExpiryAction string
+	// ReferenceCheck is how references to identifiers that don't exist are handled, unless their namespace policy
+	// sets it, ReferenceIgnore when empty
+	ReferenceCheck string
+}
+
+// identifierURL returns the url of the identifier guid under the namespace policy
+func (b *Backend) identifierURL(policy NamespacePolicy, guid string) string {
+
+	base := b.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	if !strings.HasSuffix(base, "/") {
+		base = base + "/"
+	}
+
+	template := policy.URLTemplate
+	if template == "" {
+		template = b.URLTemplate
+	}
+	if template == "" {
+		template = DefaultURLTemplate
+	}
+
+	return expandURLTemplate(template, base, guid)
 }
 
 //NewBackend initilizes a new backend with specified data, and preforms the required setup and database commands
@@ -58,6 +107,11 @@ func (b *Backend) CreateNamespace(guid string, payload []byte) (err error) {
 	ns["@id"] = guid
 	ns["_id"] = guid
 
+	// reject namespaces whose policy can't be enforced
+	if _, err = parseNamespacePolicy(payload); err != nil {
+		return
+	}
+
 	bsonRecord, err := bson.Marshal(ns)
 
 	if err != nil {
@@ -84,33 +138,179 @@ func (b *Backend) GetNamespace(guid string) (response []byte, err error) {
 		return
 	}
 
-	return
+	return namespaceView(response), nil
 }
 
-func (b *Backend) UpdateNamespace(guid string, payload []byte) (response []byte, err error) { return }
+// namespaceView leaves out of a namespace record the revision and modification time that updates add to every
+// record, which only identifiers expose, as their ETag
+func namespaceView(record []byte) []byte {
+	return jsonparser.Delete(jsonparser.Delete(record, "_rev"), "_modified")
+}
 
-func (b *Backend) DeleteNamespace(guid string) (response []byte, err error) { return }
+// UpdateNamespace merges payload into the namespace record, nested properties are updated rather than replaced.
+// The @id and _id of a namespace can not be changed, and are ignored if present in payload.
+func (b *Backend) UpdateNamespace(guid string, payload []byte) (response []byte, err error) {
 
-func (b *Backend) CreateIdentifier(guid string, payload []byte, author User) (err error) {
+	_, err = b.GetNamespace(guid)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoNamespace
+	}
+	if err != nil {
+		return
+	}
 
-	guidSplit := strings.Split(guid, "/")
-	_, err = b.GetNamespace(guidSplit[0])
+	update := make(map[string]interface{})
+	err = json.Unmarshal(payload, &update)
+	if err != nil {
+		return nil, fmt.Errorf(`{"message": "%q", "error": "%s"}`, ErrJSONUnmarshal, err.Error())
+	}
+
+	for _, protected := range []string{"@id", "_id", "namespace"} {
+		delete(update, protected)
+	}
+
+	if len(update) == 0 {
+		return b.GetNamespace(guid)
+	}
+
+	updateBytes, err := json.Marshal(update)
+	if err != nil {
+		return
+	}
+
+	if _, err = parseNamespacePolicy(updateBytes); err != nil {
+		return
+	}
+
+	response, err = b.Mongo.UpdateOne(bson.D{{"_id", guid}}, updateBytes)
+	if err == nil {
+		response = namespaceView(response)
+	}
+
+	// the policy sets the Cache-Control of every identifier in the namespace
+	b.Cache.Invalidate(guid)
+
+	return
+}
+
+// Cascade options for DeleteNamespace
+const (
+	CascadeNone      = ""
+	CascadeRemove    = "remove"
+	CascadeTombstone = "tombstone"
+)
+
+// DeleteNamespace removes the namespace record. If the namespace still holds identifiers the delete is refused
+// with ErrNamespaceNotEmpty, unless cascade is CascadeRemove, which deletes every identifier in the namespace,
+// or CascadeTombstone, which replaces every identifier with a tombstone. Both remove the identifiers from stardog.
+// CascadeRemove also deletes the identifiers that were tombstones already.
+func (b *Backend) DeleteNamespace(guid string, cascade string) (response []byte, err error) {
 
+	if cascade != CascadeNone && cascade != CascadeRemove && cascade != CascadeTombstone {
+		return nil, ErrCascade
+	}
+
+	_, err = b.GetNamespace(guid)
 	if err == mongo.ErrNoDocuments {
-		return ErrNoNamespace
+		return nil, ErrNoNamespace
+	}
+	if err != nil {
+		return
 	}
 
-	metadata, err := processMetadataWrite(payload, guid, author)
+	// identifiers that are already tombstones do not block deletion, a cascade that removes the identifiers removes
+	// the tombstones as well, so none are left in a namespace that no longer exists
+	live := bson.D{
+		{"namespace", guid},
+		{"creativeWorkStatus", bson.D{{"$ne", StatusTombstone}}},
+	}
+	affected := live
+	if cascade == CascadeRemove {
+		affected = bson.D{{"namespace", guid}}
+	}
+
+	count, err := b.Mongo.CountDocuments(live)
 	if err != nil {
 		return
 	}
 
-	// TODO validate identifier metadata
+	if count > 0 && cascade == CascadeNone {
+		return nil, ErrNamespaceNotEmpty
+	}
+
+	if cascade != CascadeNone {
+
+		// collect the guids before modifying the collection the cursor is reading
+		var guids []string
+		err = b.Mongo.Iterate(context.Background(), affected, func(record []byte) error {
+			id, getErr := jsonparser.GetString(record, "_id")
+			guids = append(guids, id)
+			return getErr
+		})
+		if err != nil {
+			return
+		}
+
+		for _, id := range guids {
+			if cascade == CascadeRemove {
+				_, err = b.DeleteIdentifier(id, nil, true)
+			} else {
+				_, err = b.TombstoneIdentifier(id)
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to %s identifier %s: %w", cascade, id, err)
+			}
+		}
+	}
+
+	record, err := b.Mongo.DeleteOne(bson.D{{"_id", guid}})
+	if err != nil {
+		return
+	}
+
+	b.Cache.Invalidate(guid)
+
+	return json.Marshal(record)
+}
+
+func (b *Backend) CreateIdentifier(guid string, payload []byte, author User) (err error) {
+
+	metadata, err := b.prepareIdentifier(guid, payload, author)
+	if err != nil {
+		return
+	}
+
+	metadataMap := make(map[string]interface{})
+	if err = json.Unmarshal(metadata, &metadataMap); err != nil {
+		return
+	}
+
+	embargo, err := metadataEmbargo(metadataMap, author.ID, time.Now())
+	if err != nil {
+		return
+	}
 
-	// add to stardog
-	err = b.Stardog.AddIdentifier(metadata)
+	// check the identifiers the metadata refers to, the references are stored to find the identifiers referring to one
+	references, err := b.checkReferences(guid, nil, metadataMap, author)
 	if err != nil {
-		return fmt.Errorf("Stardog Failed to Create Identifier: %s", err.Error())
+		return
+	}
+
+	// an identifier that exists can only be created again to fill in its reservation, which is checked before
+	// anything is written
+	if existing, foundErr := b.Mongo.FindOne(bson.D{{"_id", guid}}); foundErr == nil {
+		if err = mayFillRecord(existing, author); err != nil {
+			return
+		}
+	}
+
+	// add the expanded form to stardog, embargoed identifiers are added once the embargo lifts
+	if embargo == nil {
+		err = b.Stardog.AddIdentifier(graphForm(metadata))
+		if err != nil {
+			return fmt.Errorf("Stardog Failed to Create Identifier: %s", err.Error())
+		}
 	}
 
 	// store identifier in Mongo
@@ -121,16 +321,91 @@ func (b *Backend) CreateIdentifier(guid string, payload []byte, author User) (er
 		return fmt.Errorf("Failed to Unmarshal JSON to BSON\tError: %s", err.Error())
 	}
 
+	// record the modification time as a BSON date so exports can filter on it, and start counting revisions
+	bsonRecord = append(bsonRecord, bson.E{"_modified", time.Now().UTC()}, bson.E{"_rev", int64(1)}, bson.E{"_references", references})
+	if embargo != nil {
+		bsonRecord = append(bsonRecord, bson.E{"_embargo", embargo})
+	}
+	if setExpires(metadataMap); metadataMap["expires"] != nil {
+		bsonRecord = append(bsonRecord, bson.E{"_expires", metadataMap["_expires"]})
+	}
+
 	err = b.Mongo.InsertOne(bsonRecord)
+	b.Cache.Invalidate(guid)
 
-	// if insert fails check that identifier doesn't already exist
+	// if insert fails check that identifier doesn't already exist, other than as a reservation to fill in
 	if err != nil {
-		_, foundErr := b.Mongo.FindOne(bson.D{{"_id", guid}})
+		existing, foundErr := b.Mongo.FindOne(bson.D{{"_id", guid}})
 		if foundErr == nil {
-			err = ErrAlreadyExists
+			err = b.fillReservation(guid, existing, bsonRecord, author)
+		}
+	}
+	if err != nil {
+		// the identifier was created by someone else since it was checked, or couldn't be stored
+		if embargo == nil {
+			if graphErr := b.removeUnstored(guid, metadata); graphErr != nil {
+				return fmt.Errorf("%w, and its triples were left in stardog: %s", err, graphErr.Error())
+			}
+		}
+		return
+	}
+
+	b.createStubs(guid, nil, metadataMap, author)
+
+	// list the new identifier in the organization or project it belongs to
+	return b.syncMembership(guid, nil, metadata)
+}
+
+// prepareIdentifier checks that the namespace of guid exists and that author may mint in it, then processes
+// the payload into the metadata record that will be written and validates it against the namespace policy,
+// without writing anything
+func (b *Backend) prepareIdentifier(guid string, payload []byte, author User) (metadata []byte, err error) {
+
+	guidSplit := strings.Split(guid, "/")
+	namespace, err := b.GetNamespace(guidSplit[0])
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoNamespace
+	}
+	if err != nil {
+		return
+	}
+
+	policy, err := parseNamespacePolicy(namespace)
+	if err != nil {
+		return
+	}
+
+	if !policy.MayMint(author) {
+		return nil, ErrNotPermitted
+	}
+
+	// merge namespace defaults into the payload before the system properties are set
+	if len(policy.Defaults) > 0 {
+		payloadMap := make(map[string]interface{})
+		if err = json.Unmarshal(payload, &payloadMap); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMetadata, err.Error())
 		}
+
+		policy.ApplyDefaults(payloadMap)
+
+		if payload, err = json.Marshal(payloadMap); err != nil {
+			return
+		}
+	}
+
+	metadata, err = processMetadataWrite(payload, guid, author, b.identifierURL(policy, guid))
+	if err != nil {
+		return
+	}
+
+	metadataMap := make(map[string]interface{})
+	if err = json.Unmarshal(metadata, &metadataMap); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMetadata, err.Error())
 	}
 
+	err = policy.Validate(metadataMap)
+
 	return
 }
 
@@ -147,18 +422,41 @@ func (b *Backend) GetIdentifier(guid string) (response []byte, err error) {
 	return
 }
 
-func (b *Backend) DeleteIdentifier(guid string) (response []byte, err error) {
+// DeleteIdentifier removes an identifier, on condition it is at one of the revisions match allows. Unless forced, an
+// identifier other identifiers refer to isn't removed, and ErrReferenced is returned.
+func (b *Backend) DeleteIdentifier(guid string, match Revisions, force bool) (response []byte, err error) {
 
-	record, err := b.Mongo.DeleteOne(bson.D{{"_id", guid}})
+	if !force {
+		if err = b.checkReferrers(guid); err != nil {
+			return
+		}
+	}
+
+	record, err := b.Mongo.DeleteOne(match.filter(bson.D{{"_id", guid}}))
+
+	// tell a revision that doesn't match apart from an identifier that doesn't exist
+	if err == mongo.ErrNoDocuments && match != nil {
+		if _, foundErr := b.Mongo.FindOne(bson.D{{"_id", guid}}); foundErr == nil {
+			err = ErrPreconditionFailed
+		}
+	}
 
 	if err != nil {
 		return
 	}
 
+	b.Cache.Invalidate(guid)
+
 	response, err = json.Marshal(record)
 
 	// remove identifier from stardog
-	err = b.Stardog.RemoveIdentifier(response)
+	err = b.Stardog.RemoveIdentifier(graphForm(response))
+	if err != nil {
+		return
+	}
+
+	// and from the organization or project it belonged to
+	err = b.syncMembership(guid, response, nil)
 
 	//response = processMetadataRead(response)
 
@@ -166,60 +464,364 @@ func (b *Backend) DeleteIdentifier(guid string) (response []byte, err error) {
 
 }
 
-func (b *Backend) UpdateIdentifier(guid string, update []byte) (response []byte, err error) {
+// TombstoneIdentifier replaces the metadata of an identifier with a minimal tombstone record and removes it from stardog.
+// The ARK continues to resolve, to the tombstone, so it is never reassigned.
+func (b *Backend) TombstoneIdentifier(guid string) (response []byte, err error) {
 
-	// before update
-	originalIdentifier, err := b.Mongo.FindOne(bson.D{{"_id", guid}})
+	original, err := b.Mongo.FindOne(bson.D{{"_id", guid}})
 	if err != nil {
 		return
 	}
 
-	updatedIdentifier, err := b.Mongo.UpdateOne(bson.D{{"_id", guid}}, update)
+	originalMap := make(map[string]interface{})
+	err = json.Unmarshal(original, &originalMap)
 	if err != nil {
 		return
 	}
 
-	// update identifier in stardog
-	transactionID, err := b.Stardog.NewTransaction()
+	tombstone := bson.D{
+		{"_id", guid},
+		{"@id", guid},
+	}
+
+	// keep the properties needed to describe what the identifier used to point at
+	for _, prop := range []string{"@context", "@type", "name", "namespace", "url"} {
+		if value, ok := originalMap[prop]; ok {
+			tombstone = append(tombstone, bson.E{prop, value})
+		}
+	}
+
+	tombstone = append(tombstone,
+		bson.E{"creativeWorkStatus", StatusTombstone},
+		bson.E{"_modified", time.Now().UTC()},
+		bson.E{"_rev", recordRevision(original) + 1},
+	)
+
+	err = b.Mongo.ReplaceOne(bson.D{{"_id", guid}}, tombstone)
+	if err != nil {
+		return
+	}
+
+	b.Cache.Invalidate(guid)
+
+	err = b.Stardog.RemoveIdentifier(graphForm(original))
+	if err != nil {
+		return
+	}
+
+	// a tombstone is no longer a member of the organization or project it belonged to
+	err = b.syncMembership(guid, original, nil)
+	if err != nil {
+		return
+	}
+
+	record, err := b.Mongo.FindOne(bson.D{{"_id", guid}})
+	if err != nil {
+		return
+	}
+
+	response = processMetadataRead(record)
+	return
+}
+
+// UpdateIdentifier replaces the metadata of an identifier with update on behalf of author, keeping the properties the
+// service maintains. It fails with ErrPreconditionFailed unless the identifier is at one of the revisions match allows.
+func (b *Backend) UpdateIdentifier(guid string, update []byte, author User, match Revisions) (response []byte, err error) {
+
+	replacement := make(map[string]interface{})
+	if err = json.Unmarshal(update, &replacement); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMetadata, err.Error())
+	}
+
+	return b.editIdentifier(guid, author, func(map[string]interface{}) (map[string]interface{}, error) {
+		return replacement, nil
+	}, match)
+}
+
+// PatchIdentifier applies a JSON Merge Patch or a JSON Patch by author, as mediaType selects, to the metadata of an identifier
+func (b *Backend) PatchIdentifier(guid string, patch []byte, mediaType string, author User, match Revisions) (response []byte, err error) {
+
+	edit, err := parsePatch(patch, mediaType)
+	if err != nil {
+		return
+	}
+
+	return b.editIdentifier(guid, author, edit, match)
+}
+
+// editIdentifier applies an edit by author to the metadata of an identifier at one of the revisions match allows,
+// then updates the membership links pointing back at the identifier
+func (b *Backend) editIdentifier(guid string, author User, edit metadataEdit, match Revisions) (response []byte, err error) {
+
+	original, response, err := b.editRecord(guid, author, edit, match)
+	if response == nil {
+		return
+	}
+
+	// once the edit is stored the membership links follow it, even when stardog couldn't be updated
+	if syncErr := b.syncMembership(guid, original, response); err == nil {
+		err = syncErr
+	}
+
+	return
+}
+
+// editRecord applies an edit by author to the metadata of an identifier at one of the revisions match allows,
+// returning the record before and after the edit. An unconditional edit is retried when the identifier changes
+// while it is being applied.
+func (b *Backend) editRecord(guid string, author User, edit metadataEdit, match Revisions) (original []byte, response []byte, err error) {
+
+	for attempt := 1; ; attempt++ {
+		original, response, err = b.applyEdit(guid, author, edit, match)
+		if err != errRevisionChanged {
+			return
+		}
+		if match != nil || attempt == maxEditAttempts {
+			return nil, nil, ErrPreconditionFailed
+		}
+	}
+}
+
+// applyEdit writes the changes an edit makes to mongo as update operators, on condition the identifier is still at
+// the revision the edit was applied to, and swaps the identifier's triples in stardog
+func (b *Backend) applyEdit(guid string, author User, edit metadataEdit, match Revisions) (originalIdentifier []byte, response []byte, err error) {
 
+	// before update
+	originalIdentifier, err = b.Mongo.FindOne(bson.D{{"_id", guid}})
 	if err != nil {
 		return
 	}
 
-	err = b.Stardog.RemoveData(transactionID, originalIdentifier, "")
+	rev := recordRevision(originalIdentifier)
+	if !match.allows(rev) {
+		return nil, nil, ErrPreconditionFailed
+	}
+
+	original := make(map[string]interface{})
+	if err = json.Unmarshal(originalIdentifier, &original); err != nil {
+		return
+	}
+
+	metadata := make(map[string]interface{})
+	if err = json.Unmarshal(processMetadataRead(originalIdentifier), &metadata); err != nil {
+		return
+	}
 
-	err = b.Stardog.AddData(transactionID, updatedIdentifier, "")
+	edited, err := edit(metadata)
 	if err != nil {
 		return
 	}
 
-	err = b.Stardog.Commit(transactionID)
+	// the updated record must still satisfy the policy of its namespace
+	updated, err := b.prepareUpdate(guid, original, edited, author)
 	if err != nil {
 		return
 	}
 
-	// if failure in stardog rollback mongo transaction
+	// editing a reservation fills it in
+	if err = clearReservation(originalIdentifier, updated, author); err != nil {
+		return
+	}
+
+	if err = setEmbargo(updated, time.Now()); err != nil {
+		return
+	}
+
+	resetExpiry(original, updated)
+
+	// check the identifiers the edit newly refers to
+	if updated["_references"], err = b.checkReferences(guid, original, updated, author); err != nil {
+		return
+	}
+
+	query := Revisions{rev}.filter(bson.D{{"_id", guid}})
+
+	var updatedIdentifier []byte
+
+	if update, ok := diffUpdate(original, updated); ok {
+		updatedIdentifier, err = b.Mongo.ModifyOne(query, update)
+	} else {
+		// top level properties that can't be named in a dot notation path are written by replacing the record
+		updated["_modified"] = time.Now().UTC()
+		updated["_rev"] = rev + 1
+		if err = b.Mongo.ReplaceOne(query, updated); err == nil {
+			updatedIdentifier, err = b.Mongo.FindOne(bson.D{{"_id", guid}})
+		}
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, errRevisionChanged
+	}
+	if err != nil {
+		return
+	}
+
+	b.Cache.Invalidate(guid)
+
+	// the record is stored, the response and stubs follow it even when stardog can't be updated
 	response = updatedIdentifier
+	b.createStubs(guid, original, updated, author)
+
+	// update identifier in stardog
+	err = b.replaceInGraph(originalIdentifier, updatedIdentifier)
 
 	return
 }
 
-func processMetadataWrite(inputMetadata []byte, guid string, author User) (metadata []byte, err error) {
+// replaceInGraph swaps the original triples of an identifier for its updated ones in a single stardog transaction,
+// an embargoed or withdrawn identifier only has its original triples removed
+func (b *Backend) replaceInGraph(original []byte, updated []byte) (err error) {
+
+	transactionID, err := b.Stardog.NewTransaction()
 
-	// set @id
-	metadata, err = jsonparser.Set(inputMetadata, []byte(`"`+guid+`"`), "@id")
 	if err != nil {
 		return
 	}
 
-	metadata, err = jsonparser.Set(metadata, []byte(`"`+guid+`"`), "_id")
+	err = b.Stardog.RemoveData(transactionID, graphForm(original), "")
+
+	// embargoed records are added once the embargo lifts, withdrawn ones are left out
+	status, _ := jsonparser.GetString(updated, "creativeWorkStatus")
+	if embargoed, _ := recordEmbargoed(updated, time.Now()); !embargoed && status != StatusWithdrawn {
+		err = b.Stardog.AddData(transactionID, graphForm(updated), "")
+		if err != nil {
+			return
+		}
+	}
+
+	return b.Stardog.Commit(transactionID)
+}
+
+// removeUnstored takes the triples of metadata that couldn't be stored under guid out of stardog again. When
+// another record was stored under guid in the meantime, its own triples are restored in the same transaction, in
+// case they were also part of metadata.
+func (b *Backend) removeUnstored(guid string, metadata []byte) error {
+
+	current, err := b.Mongo.FindOne(bson.D{{"_id", guid}})
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	if err == mongo.ErrNoDocuments || !inGraph(current, time.Now()) {
+		return b.Stardog.RemoveIdentifier(graphForm(metadata))
+	}
+
+	return b.replaceInGraph(metadata, current)
+}
+
+// inGraph reports whether a stored record has its triples in stardog, reservations, embargoed, withdrawn and
+// tombstoned identifiers don't
+func inGraph(record []byte, now time.Time) bool {
+
+	if _, reserved := reservationOwner(record); reserved {
+		return false
+	}
+
+	if embargoed, _ := recordEmbargoed(record, now); embargoed {
+		return false
+	}
+
+	status, _ := jsonparser.GetString(record, "creativeWorkStatus")
+
+	return status != StatusWithdrawn && status != StatusTombstone
+}
+
+// managedFields are maintained by the service, values clients send for them are dropped when an identifier is minted
+// and replaced with the stored values when it is edited
+var managedFields = []string{"_id", "@id", "namespace", "url", "sdPublisher", "sdPublicationDate", "dateModified", "modifiedBy"}
+
+// protectFields returns the edited metadata with the internal and managed properties of the original record,
+// recording author and the time as the last modification
+func protectFields(original map[string]interface{}, edited map[string]interface{}, author User) map[string]interface{} {
+
+	updated := make(map[string]interface{}, len(edited)+len(internalFields)+len(managedFields))
+	for k, v := range edited {
+		updated[k] = v
+	}
+
+	for _, fields := range [][]string{internalFields, managedFields} {
+		for _, field := range fields {
+			if value, ok := original[field]; ok {
+				updated[field] = value
+			} else {
+				delete(updated, field)
+			}
+		}
+	}
+
+	updated["dateModified"] = time.Now().Format(time.RFC3339Nano)
+
+	delete(updated, "modifiedBy")
+	if modifier := userReference(author); len(modifier) > 0 {
+		updated["modifiedBy"] = modifier
+	}
+
+	return updated
+}
+
+// userReference describes a user the way sdPublisher does, by their @id and name when they are known
+func userReference(u User) map[string]interface{} {
+
+	ref := make(map[string]interface{}, 2)
+	if u.ID != "" {
+		ref["@id"] = u.ID
+	}
+	if u.Name != "" {
+		ref["name"] = u.Name
+	}
+
+	return ref
+}
+
+// prepareUpdate builds the record an edit of the metadata of guid by author results in. The properties the service
+// maintains are protected, the context is merged with the default vocabulary, the expanded form is recomputed, and
+// the record is checked against the namespace policy.
+func (b *Backend) prepareUpdate(guid string, original map[string]interface{}, edited map[string]interface{}, author User) (updated map[string]interface{}, err error) {
+
+	guidSplit := strings.Split(guid, "/")
+	namespace, err := b.GetNamespace(guidSplit[0])
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoNamespace
+	}
 	if err != nil {
 		return
 	}
 
-	// set the default context
-	// TODO: if object add property "@vocab": "http://schema.org"
-	metadata, err = jsonparser.Set(metadata, []byte(`{"@vocab": "http://schema.org/"}`), "@context")
+	policy, err := parseNamespacePolicy(namespace)
+	if err != nil {
+		return
+	}
+
+	updated = protectFields(original, edited, author)
+	updated["@context"] = mergeContext(updated["@context"])
+
+	if updated["_expanded"], err = expandRecord(updated); err != nil {
+		return nil, err
+	}
+
+	if err = policy.Validate(updated); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func processMetadataWrite(inputMetadata []byte, guid string, author User, url string) (metadata []byte, err error) {
+
+	// properties the service maintains can't be set by the caller
+	metadata = inputMetadata
+	for _, fields := range [][]string{internalFields, managedFields} {
+		for _, field := range fields {
+			metadata = jsonparser.Delete(metadata, field)
+		}
+	}
+
+	// set @id
+	metadata, err = jsonparser.Set(metadata, []byte(`"`+guid+`"`), "@id")
+	if err != nil {
+		return
+	}
+
+	metadata, err = jsonparser.Set(metadata, []byte(`"`+guid+`"`), "_id")
 	if err != nil {
 		return
 	}
@@ -232,7 +834,7 @@ func processMetadataWrite(inputMetadata []byte, guid string, author User) (metad
 	}
 
 	// set url
-	metadata, err = jsonparser.Set(metadata, []byte(`"http://ors.uvadcos.io/`+guid+`"`), "url")
+	metadata, err = jsonparser.Set(metadata, []byte(strconv.Quote(url)), "url")
 	if err != nil {
 		return
 	}
@@ -255,6 +857,12 @@ func processMetadataWrite(inputMetadata []byte, guid string, author User) (metad
 	// set sdPublicationDate
 	now, err := time.Now().MarshalJSON()
 	metadata, err = jsonparser.Set(metadata, now, "sdPublicationDate")
+	if err != nil {
+		return
+	}
+
+	// merge the caller's context with the default vocabulary and store the expanded form of the record
+	metadata, err = processContext(metadata)
 
 	// TODO if not set default to "version": 1
 	// metadata["version"] = 1
@@ -264,11 +872,11 @@ func processMetadataWrite(inputMetadata []byte, guid string, author User) (metad
 
 // Replace with buger/jsonparser
 func processMetadataRead(metadata []byte) []byte {
-	// delete _id property
-	metadata = jsonparser.Delete(metadata, "_id")
 
-	// delete namespace properties namespace
-	metadata = jsonparser.Delete(metadata, "namespace")
+	// delete _id, namespace and the other internal properties
+	for _, field := range internalFields {
+		metadata = jsonparser.Delete(metadata, field)
+	}
 
 	return metadata
 }
@@ -0,0 +1,444 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// Conflict policies for ImportNamespace, applied when an imported identifier already exists
+const (
+	ImportSkip      = "skip"
+	ImportOverwrite = "overwrite"
+	ImportFail      = "fail"
+)
+
+var ErrImportPolicy = errors.New("Unsupported Import Conflict Policy")
+var ErrImportConflict = errors.New("Imported Identifiers Already Exist")
+
+// ImportResult records what happened, or would happen on a dry run, to a single imported record
+type ImportResult struct {
+	ID     string `json:"@id"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportReport summarizes an import of a namespace
+type ImportReport struct {
+	Namespace   string         `json:"namespace"`
+	Policy      string         `json:"policy"`
+	DryRun      bool           `json:"dryRun"`
+	Created     int            `json:"created"`
+	Overwritten int            `json:"overwritten"`
+	Skipped     int            `json:"skipped"`
+	Failed      int            `json:"failed"`
+	Results     []ImportResult `json:"results"`
+}
+
+func (report *ImportReport) add(result ImportResult) {
+
+	switch result.Action {
+	case "create":
+		report.Created++
+	case "overwrite":
+		report.Overwritten++
+	case "skip":
+		report.Skipped++
+	default:
+		report.Failed++
+	}
+
+	report.Results = append(report.Results, result)
+}
+
+type importRecord struct {
+	guid    string
+	payload []byte
+	err     error
+}
+
+// ImportNamespace loads identifiers into the namespace guid from r, keeping the ARK in each record's @id.
+// The input is either newline delimited JSON or JSON-LD documents whose @graph holds the records, as written
+// by ExportNamespace, and is read a record at a time. Each record is processed through the same path as
+// CreateIdentifier. Existing identifiers are skipped, overwritten or, with ImportFail, abort the import before
+// anything is written. With dryRun set every record is validated and the report describes what would happen,
+// but nothing is written.
+func (b *Backend) ImportNamespace(guid string, r io.Reader, policy string, dryRun bool, author User) (report ImportReport, err error) {
+
+	report = ImportReport{Namespace: guid, Policy: policy, DryRun: dryRun, Results: []ImportResult{}}
+
+	if policy != ImportSkip && policy != ImportOverwrite && policy != ImportFail {
+		return report, ErrImportPolicy
+	}
+
+	_, err = b.GetNamespace(guid)
+	if err == mongo.ErrNoDocuments {
+		return report, ErrNoNamespace
+	}
+	if err != nil {
+		return
+	}
+
+	if policy == ImportFail {
+		// every conflict is found before anything is written, so the input is kept in a temporary file to be read twice
+		spool, spoolErr := ioutil.TempFile("", "mds-import-")
+		if spoolErr != nil {
+			return report, spoolErr
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		if _, err = io.Copy(spool, r); err != nil {
+			return
+		}
+		if _, err = spool.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+
+		conflict := false
+		err = readImportRecords(spool, guid, func(rec importRecord) error {
+			if rec.err != nil {
+				return nil
+			}
+
+			exists, existsErr := b.identifierExists(rec.guid)
+			if exists {
+				report.add(ImportResult{ID: rec.guid, Action: "fail", Error: ErrAlreadyExists.Error()})
+				conflict = true
+			}
+			return existsErr
+		})
+		if err != nil {
+			return
+		}
+		if conflict {
+			return report, ErrImportConflict
+		}
+
+		if _, err = spool.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		r = spool
+	}
+
+	err = readImportRecords(r, guid, func(rec importRecord) error {
+		report.add(b.importRecord(rec, policy, dryRun, author))
+		return nil
+	})
+
+	return
+}
+
+// importRecord writes a single imported record, or only validates it on a dry run, and reports what happened
+func (b *Backend) importRecord(rec importRecord, policy string, dryRun bool, author User) ImportResult {
+
+	if rec.err != nil {
+		return ImportResult{ID: rec.guid, Action: "fail", Error: rec.err.Error()}
+	}
+
+	exists, err := b.identifierExists(rec.guid)
+	if err != nil {
+		return ImportResult{ID: rec.guid, Action: "fail", Error: err.Error()}
+	}
+
+	// with the fail policy conflicts were checked before importing, an identifier that exists by now was created
+	// since, or earlier in the same import, and is never overwritten
+	action := "create"
+	if exists {
+		switch policy {
+		case ImportSkip:
+			return ImportResult{ID: rec.guid, Action: "skip"}
+		case ImportOverwrite:
+			action = "overwrite"
+		default:
+			return ImportResult{ID: rec.guid, Action: "fail", Error: ErrAlreadyExists.Error()}
+		}
+	}
+
+	switch {
+	case dryRun:
+		_, _, err = b.prepareImport(rec.guid, rec.payload, author)
+	case exists:
+		err = b.overwriteIdentifier(rec.guid, rec.payload, author)
+	default:
+		err = b.CreateIdentifier(rec.guid, rec.payload, author)
+	}
+
+	if err != nil {
+		return ImportResult{ID: rec.guid, Action: "fail", Error: err.Error()}
+	}
+
+	return ImportResult{ID: rec.guid, Action: action}
+}
+
+func (b *Backend) identifierExists(guid string) (bool, error) {
+
+	_, err := b.Mongo.FindOne(bson.D{{"_id", guid}}, "_id")
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// prepareImport reads the identifier an imported record would replace, nil when it doesn't exist, and validates
+// the record the same way a create or an update would, down to the owner of a reservation and the reference check,
+// without writing anything
+func (b *Backend) prepareImport(guid string, payload []byte, author User) (originalIdentifier []byte, updated map[string]interface{}, err error) {
+
+	originalIdentifier, err = b.Mongo.FindOne(bson.D{{"_id", guid}})
+	if err == mongo.ErrNoDocuments {
+		originalIdentifier, err = nil, nil
+	}
+	if err != nil {
+		return
+	}
+
+	var original map[string]interface{}
+	if originalIdentifier != nil {
+		if err = json.Unmarshal(originalIdentifier, &original); err != nil {
+			return
+		}
+	}
+
+	metadata, err := b.prepareIdentifier(guid, payload, author)
+	if err != nil {
+		return
+	}
+
+	updated = make(map[string]interface{})
+	if err = json.Unmarshal(metadata, &updated); err != nil {
+		return
+	}
+
+	embargo, err := metadataEmbargo(updated, author.ID, time.Now())
+	if err != nil {
+		return
+	}
+	if embargo != nil {
+		updated["_embargo"] = embargo
+	}
+
+	setExpires(updated)
+
+	// only the owner of a reservation may fill it in, the same as with PUT
+	if err = clearReservation(originalIdentifier, updated, author); err != nil {
+		return
+	}
+
+	if updated["_references"], err = b.checkReferences(guid, original, updated, author); err != nil {
+		return
+	}
+
+	return originalIdentifier, updated, nil
+}
+
+// overwriteIdentifier replaces an existing identifier with an imported record in a single write. The record is
+// validated before anything changes, and replaces the identifier on condition it is still at the revision read,
+// as its next revision, so entity tags of the overwritten metadata no longer match.
+func (b *Backend) overwriteIdentifier(guid string, payload []byte, author User) (err error) {
+
+	originalIdentifier, updated, err := b.prepareImport(guid, payload, author)
+	if err != nil {
+		return
+	}
+	if originalIdentifier == nil {
+		return mongo.ErrNoDocuments
+	}
+	rev := recordRevision(originalIdentifier)
+
+	updated["_modified"] = time.Now().UTC()
+	updated["_rev"] = rev + 1
+
+	err = b.Mongo.ReplaceOne(Revisions{rev}.filter(bson.D{{"_id", guid}}), updated)
+	if err == mongo.ErrNoDocuments {
+		return ErrPreconditionFailed
+	}
+	if err != nil {
+		return
+	}
+
+	b.Cache.Invalidate(guid)
+
+	updatedIdentifier, err := b.Mongo.FindOne(bson.D{{"_id", guid}})
+	if err != nil {
+		return
+	}
+
+	// the record is stored, its stubs and membership links follow it even when stardog can't be updated
+	graphErr := b.replaceInGraph(originalIdentifier, updatedIdentifier)
+
+	b.createStubs(guid, recordMap(originalIdentifier), updated, author)
+
+	if err = b.syncMembership(guid, originalIdentifier, updatedIdentifier); err != nil {
+		return
+	}
+
+	return graphErr
+}
+
+// readImportRecords decodes the records of an import stream one at a time, passing each to fn, expanding JSON-LD
+// @graph documents and arrays as they are read. Records that cannot be imported into namespace are passed with
+// err set so they are reported individually. An error from fn ends the import.
+func readImportRecords(r io.Reader, namespace string, fn func(importRecord) error) error {
+
+	reader := importReader{dec: json.NewDecoder(r), namespace: namespace, fn: fn}
+
+	for {
+		tok, err := reader.dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrJSONUnmarshal, err.Error())
+		}
+
+		if err = reader.value(tok, nil); err != nil {
+			return err
+		}
+	}
+}
+
+// importReader walks the JSON values of an import stream token by token, so that only one record of a large
+// @graph is decoded at a time
+type importReader struct {
+	dec       *json.Decoder
+	namespace string
+	fn        func(importRecord) error
+}
+
+// value reads the JSON value starting at tok. Members of a @graph inherit the @context of the enclosing document
+// when they have none of their own.
+func (ir *importReader) value(tok json.Token, context json.RawMessage) error {
+
+	switch tok {
+	case json.Delim('['):
+		for ir.dec.More() {
+			member, err := ir.token()
+			if err != nil {
+				return err
+			}
+			if err = ir.value(member, context); err != nil {
+				return err
+			}
+		}
+		_, err := ir.token()
+		return err
+	case json.Delim('{'):
+		return ir.object(context)
+	default:
+		return ir.fn(importRecord{err: ErrInvalidMetadata})
+	}
+}
+
+// object reads an object whose opening brace has been read. An object whose @graph comes before any @id is a
+// document holding records, its @context must come before the @graph for the records to inherit it, as it does in
+// an export. Any other object is a record.
+func (ir *importReader) object(context json.RawMessage) error {
+
+	node := make(map[string]json.RawMessage)
+	document := false
+
+	for ir.dec.More() {
+		tok, err := ir.token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+
+		if _, hasID := node["@id"]; key == "@graph" && !hasID {
+			document = true
+
+			inherited := context
+			if nodeContext, ok := node["@context"]; ok {
+				inherited = nodeContext
+			}
+
+			member, err := ir.token()
+			if err != nil {
+				return err
+			}
+			if err = ir.value(member, inherited); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var raw json.RawMessage
+		if err = ir.dec.Decode(&raw); err != nil {
+			return fmt.Errorf("%w: %s", ErrJSONUnmarshal, err.Error())
+		}
+		node[key] = raw
+	}
+
+	if _, err := ir.token(); err != nil {
+		return err
+	}
+
+	if document {
+		return nil
+	}
+
+	return ir.fn(importNode(node, ir.namespace, context))
+}
+
+func (ir *importReader) token() (json.Token, error) {
+
+	tok, err := ir.dec.Token()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrJSONUnmarshal, err.Error())
+	}
+
+	return tok, nil
+}
+
+// importNode converts a decoded record into an import record, with the @context it inherits when it has none
+func importNode(node map[string]json.RawMessage, namespace string, context json.RawMessage) importRecord {
+
+	if _, ok := node["@context"]; !ok && context != nil {
+		node["@context"] = context
+	}
+
+	var id string
+	if err := json.Unmarshal(node["@id"], &id); err != nil || id == "" {
+		return importRecord{err: fmt.Errorf("%w: record has no @id", ErrInvalidMetadata)}
+	}
+
+	guid := normalizeArk(id)
+	rec := importRecord{guid: guid}
+
+	if !strings.HasPrefix(guid, namespace+"/") {
+		rec.err = fmt.Errorf("%w: %s is not an identifier in namespace %s", ErrInvalidMetadata, id, namespace)
+		return rec
+	}
+
+	rec.payload, rec.err = json.Marshal(node)
+	return rec
+}
+
+// normalizeArk rewrites an ARK in the ark:/NAAN/name form, or as a resolver URL, into the ark:NAAN/name form used for guids
+func normalizeArk(id string) string {
+
+	if i := strings.Index(id, "ark:"); i > 0 {
+		id = id[i:]
+	}
+
+	return strings.Replace(id, "ark:/", "ark:", 1)
+}
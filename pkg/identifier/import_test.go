@@ -0,0 +1,135 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"github.com/buger/jsonparser"
+	"strings"
+	"testing"
+)
+
+// collectImportRecords reads every record of an import stream
+func collectImportRecords(dump string, namespace string) (records []importRecord, err error) {
+
+	err = readImportRecords(strings.NewReader(dump), namespace, func(rec importRecord) error {
+		records = append(records, rec)
+		return nil
+	})
+
+	return
+}
+
+func TestImportRecords(t *testing.T) {
+
+	t.Run("NDJSON", func(t *testing.T) {
+
+		dump := `{"@id": "ark:99999/one", "name": "one"}
+{"@id": "ark:/99999/two", "name": "two"}
+{"@id": "ark:12345/three", "name": "three"}
+{"name": "no id"}
+`
+		records, err := collectImportRecords(dump, "ark:99999")
+		if err != nil {
+			t.Fatalf("Failed to Read Import Records: %s", err.Error())
+		}
+
+		if len(records) != 4 {
+			t.Fatalf("Expected 4 Records Found %d", len(records))
+		}
+
+		if records[0].guid != "ark:99999/one" || records[0].err != nil {
+			t.Fatalf("Incorrect First Record: %+v", records[0])
+		}
+
+		if records[1].guid != "ark:99999/two" || records[1].err != nil {
+			t.Fatalf("ark:/ form was not normalized: %+v", records[1])
+		}
+
+		if records[2].err == nil {
+			t.Fatalf("Record from another namespace was accepted: %+v", records[2])
+		}
+
+		if records[3].err == nil {
+			t.Fatalf("Record without @id was accepted: %+v", records[3])
+		}
+	})
+
+	t.Run("JSONLD", func(t *testing.T) {
+
+		dump := `{"@context": {"@vocab": "http://schema.org/"}, "@graph": [
+			{"@id": "ark:99999/one", "name": "one"},
+			{"@id": "ark:99999/two", "@context": "https://schema.org/", "name": "two"}
+		]}`
+
+		records, err := collectImportRecords(dump, "ark:99999")
+		if err != nil {
+			t.Fatalf("Failed to Read Import Records: %s", err.Error())
+		}
+
+		if len(records) != 2 {
+			t.Fatalf("Expected 2 Records Found %d", len(records))
+		}
+
+		vocab, err := jsonparser.GetString(records[0].payload, "@context", "@vocab")
+		if err != nil || vocab != "http://schema.org/" {
+			t.Fatalf("Graph member did not inherit the document @context: %s", string(records[0].payload))
+		}
+
+		context, err := jsonparser.GetString(records[1].payload, "@context")
+		if err != nil || context != "https://schema.org/" {
+			t.Fatalf("Graph member @context was overwritten: %s", string(records[1].payload))
+		}
+	})
+
+	t.Run("Array", func(t *testing.T) {
+
+		dump := `[{"@id": "ark:99999/one", "@graph": [{"name": "nested"}]}, "text", {"@graph": [{"@id": "ark:99999/two"}]}]`
+
+		records, err := collectImportRecords(dump, "ark:99999")
+		if err != nil {
+			t.Fatalf("Failed to Read Import Records: %s", err.Error())
+		}
+
+		if len(records) != 3 {
+			t.Fatalf("Expected 3 Records Found %d", len(records))
+		}
+
+		if records[0].guid != "ark:99999/one" || records[0].err != nil {
+			t.Fatalf("Record with an @id before its @graph was not read as a record: %+v", records[0])
+		}
+
+		if records[1].err == nil {
+			t.Fatalf("Scalar was accepted as a record: %+v", records[1])
+		}
+
+		if records[2].guid != "ark:99999/two" || records[2].err != nil {
+			t.Fatalf("Nested @graph member was not read: %+v", records[2])
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+
+		read := 0
+		err := readImportRecords(strings.NewReader(`{"@id": "ark:99999/one"} {"@id": "ark:99999/two"}`), "ark:99999", func(rec importRecord) error {
+			read++
+			return ErrImportConflict
+		})
+
+		if err != ErrImportConflict || read != 1 {
+			t.Fatalf("Import did not stop at the first error: %d records read, %v", read, err)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		for _, dump := range []string{`{"@id": "ark:99999/one",`, `{"@graph": [{"@id": "ark:99999/one"}`} {
+			if _, err := collectImportRecords(dump, "ark:99999"); err == nil {
+				t.Fatalf("Malformed Dump was Accepted: %s", dump)
+			}
+		}
+	})
+
+}
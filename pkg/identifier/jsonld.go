@@ -0,0 +1,241 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ClarkLabUVA/mds/pkg/jsonld"
+	"github.com/buger/jsonparser"
+)
+
+// DefaultVocab is the vocabulary used for every term the caller's @context doesn't define
+const DefaultVocab = "http://schema.org/"
+
+// internalFields are stored on identifier records in mongo but are never part of their metadata
+var internalFields = []string{"_id", "namespace", "_modified", "_expanded", "_rev", "_reservation", "_embargo", "_expired", "_expires", "_references"}
+
+// contextLoader resolves remote contexts, schema.org is answered locally as the default vocabulary
+var contextLoader = newContextLoader()
+
+func newContextLoader() *jsonld.CachingLoader {
+
+	loader := jsonld.NewCachingLoader()
+	loader.Preload(
+		map[string]interface{}{"@context": map[string]interface{}{"@vocab": DefaultVocab}},
+		"http://schema.org", "http://schema.org/", "https://schema.org", "https://schema.org/",
+		"http://schema.org/docs/jsonldcontext.json", "https://schema.org/docs/jsonldcontext.json",
+	)
+
+	return loader
+}
+
+// AllowRemoteContexts lets metadata use the remote contexts at urls, schema.org is always allowed and no other
+// context is fetched
+func AllowRemoteContexts(urls ...string) {
+
+	for _, url := range urls {
+		if url = strings.TrimSpace(url); url != "" {
+			contextLoader.Allow(url)
+		}
+	}
+}
+
+// isSchemaContext reports whether a remote context is schema.org, which only contributes the default vocabulary
+func isSchemaContext(ctx string) bool {
+	ctx = strings.TrimPrefix(strings.TrimPrefix(ctx, "https://"), "http://")
+	return strings.HasPrefix(ctx, "schema.org")
+}
+
+// mergeContext adds the default vocabulary to the caller's @context unless it already provides one.
+// Definitions made by the caller always take precedence over the default.
+func mergeContext(ctx interface{}) interface{} {
+
+	defaultContext := map[string]interface{}{"@vocab": DefaultVocab}
+
+	switch c := ctx.(type) {
+
+	case nil:
+		return defaultContext
+
+	case string:
+		if isSchemaContext(c) {
+			return c
+		}
+		return []interface{}{defaultContext, c}
+
+	case map[string]interface{}:
+		if _, ok := c["@vocab"]; ok {
+			return c
+		}
+
+		merged := make(map[string]interface{}, len(c)+1)
+		for k, v := range c {
+			merged[k] = v
+		}
+		merged["@vocab"] = DefaultVocab
+
+		return merged
+
+	case []interface{}:
+		for _, item := range c {
+			switch i := item.(type) {
+			case string:
+				if isSchemaContext(i) {
+					return c
+				}
+			case map[string]interface{}:
+				if _, ok := i["@vocab"]; ok {
+					return c
+				}
+			}
+		}
+
+		return append([]interface{}{defaultContext}, c...)
+	}
+
+	return ctx
+}
+
+// expandRecord returns the expanded JSON-LD of an identifier record, which is what is written to the graph.
+// Records that can't be expanded, such as ones using undefined prefixes or unreachable contexts, are invalid metadata.
+func expandRecord(record map[string]interface{}) (expanded string, err error) {
+
+	metadata := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		metadata[k] = v
+	}
+
+	for _, field := range internalFields {
+		delete(metadata, field)
+	}
+
+	doc, err := jsonld.Expand(metadata, &jsonld.Options{Loader: contextLoader})
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidMetadata, err.Error())
+	}
+
+	// relative node identifiers and types have no meaning in the graph
+	if err = checkExpandedIRIs(doc); err != nil {
+		return
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return
+	}
+
+	return string(out), nil
+}
+
+// checkExpandedIRIs rejects node identifiers and types that are neither absolute IRIs nor blank nodes
+func checkExpandedIRIs(value interface{}) error {
+
+	switch v := value.(type) {
+
+	case []interface{}:
+		for _, item := range v {
+			if err := checkExpandedIRIs(item); err != nil {
+				return err
+			}
+		}
+
+	case map[string]interface{}:
+		if _, ok := v["@value"]; ok {
+			return nil
+		}
+
+		if id, ok := v["@id"].(string); ok && !strings.Contains(id, ":") {
+			return fmt.Errorf("%w: @id %s is not an absolute IRI", ErrInvalidMetadata, id)
+		}
+
+		for _, t := range metadataTypes(v["@type"]) {
+			if !strings.Contains(t, ":") {
+				return fmt.Errorf("%w: @type %s is not an absolute IRI", ErrInvalidMetadata, t)
+			}
+		}
+
+		for key, item := range v {
+			if key == "@id" || key == "@type" {
+				continue
+			}
+			if err := checkExpandedIRIs(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// processContext merges the default vocabulary into the @context of a new record and stores its expanded form
+func processContext(metadata []byte) (processed []byte, err error) {
+
+	record := make(map[string]interface{})
+	if err = json.Unmarshal(metadata, &record); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMetadata, err.Error())
+	}
+
+	record["@context"] = mergeContext(record["@context"])
+
+	ctx, err := json.Marshal(record["@context"])
+	if err != nil {
+		return
+	}
+
+	processed, err = jsonparser.Set(metadata, ctx, "@context")
+	if err != nil {
+		return
+	}
+
+	expanded, err := expandRecord(record)
+	if err != nil {
+		return
+	}
+
+	expandedJSON, err := json.Marshal(expanded)
+	if err != nil {
+		return
+	}
+
+	return jsonparser.Set(processed, expandedJSON, "_expanded")
+}
+
+// expandUpdate applies update to a copy of the original record, merging the default vocabulary into its context,
+// and adds the expanded form of the result to update so the stored expansion is rewritten with the properties
+func expandUpdate(original map[string]interface{}, update map[string]interface{}) (merged map[string]interface{}, err error) {
+
+	merged = mergeUpdate(original, update)
+	merged["@context"] = mergeContext(merged["@context"])
+
+	if _, ok := update["@context"]; ok {
+		update["@context"] = merged["@context"]
+	}
+
+	expanded, err := expandRecord(merged)
+	if err != nil {
+		return
+	}
+
+	update["_expanded"] = expanded
+	merged["_expanded"] = expanded
+
+	return
+}
+
+// graphForm returns what was written to the graph for a record, its stored expansion,
+// records created before expansions were stored were written as they are
+func graphForm(record []byte) []byte {
+
+	if expanded, err := jsonparser.GetString(record, "_expanded"); err == nil {
+		return []byte(expanded)
+	}
+
+	return record
+}
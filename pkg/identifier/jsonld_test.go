@@ -0,0 +1,124 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buger/jsonparser"
+)
+
+func TestContext(t *testing.T) {
+
+	t.Run("Merge", func(t *testing.T) {
+
+		if ctx, ok := mergeContext(nil).(map[string]interface{}); !ok || ctx["@vocab"] != DefaultVocab {
+			t.Fatalf("Missing Context should be the Default: %+v", ctx)
+		}
+
+		if ctx := mergeContext("https://schema.org/"); ctx != "https://schema.org/" {
+			t.Fatalf("schema.org Context should be Kept: %+v", ctx)
+		}
+
+		prov := map[string]interface{}{"prov": "http://www.w3.org/ns/prov#"}
+		ctx := mergeContext(prov).(map[string]interface{})
+		if ctx["@vocab"] != DefaultVocab || ctx["prov"] != "http://www.w3.org/ns/prov#" {
+			t.Fatalf("Default Vocab was not Merged: %+v", ctx)
+		}
+		if _, ok := prov["@vocab"]; ok {
+			t.Fatal("Caller's Context was Modified")
+		}
+
+		dcat := map[string]interface{}{"@vocab": "http://www.w3.org/ns/dcat#"}
+		if ctx := mergeContext(dcat).(map[string]interface{}); ctx["@vocab"] != "http://www.w3.org/ns/dcat#" {
+			t.Fatalf("Caller's Vocab was Replaced: %+v", ctx)
+		}
+
+		if ctx := mergeContext("https://w3id.org/EVI").([]interface{}); len(ctx) != 2 || ctx[1] != "https://w3id.org/EVI" {
+			t.Fatalf("Remote Context should follow the Default: %+v", ctx)
+		}
+	})
+
+	t.Run("Write", func(t *testing.T) {
+
+		payload := []byte(`{
+			"@context": {"prov": "http://www.w3.org/ns/prov#"},
+			"@type": "Dataset",
+			"name": "test",
+			"prov:wasGeneratedBy": {"@id": "ark:99999/computation"}
+		}`)
+
+		metadata, err := processMetadataWrite(payload, "ark:99999/test", User{}, "http://ors.uvadcos.io/ark:99999/test")
+		if err != nil {
+			t.Fatalf("Failed to Process Metadata: %s", err.Error())
+		}
+
+		if prefix, _ := jsonparser.GetString(metadata, "@context", "prov"); prefix != "http://www.w3.org/ns/prov#" {
+			t.Fatalf("Caller's Context was not Kept: %s", metadata)
+		}
+
+		expanded := graphForm(metadata)
+
+		var doc []map[string]interface{}
+		if err = json.Unmarshal(expanded, &doc); err != nil || len(doc) != 1 {
+			t.Fatalf("Stored Expansion is not Expanded JSON-LD: %s", expanded)
+		}
+
+		if _, ok := doc[0]["http://www.w3.org/ns/prov#wasGeneratedBy"]; !ok {
+			t.Fatalf("Prefixed Property was not Expanded: %s", expanded)
+		}
+		if _, ok := doc[0]["http://schema.org/name"]; !ok {
+			t.Fatalf("Default Vocab was not Applied: %s", expanded)
+		}
+		if strings.Contains(string(expanded), "namespace") {
+			t.Fatalf("Internal Fields were Expanded: %s", expanded)
+		}
+
+		if read := processMetadataRead(metadata); strings.Contains(string(read), "_expanded") {
+			t.Fatalf("Expanded Form was not Removed on Read: %s", read)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+
+		invalid := []string{
+			`{"@context": {"name": {"@type": 5}}, "name": "test"}`,
+			`{"@context": {"@vocab": "http://schema.org/"}, "author": {"@id": 5}}`,
+			`{"@context": {"@vocab": null}, "@type": "Dataset"}`,
+		}
+
+		for _, payload := range invalid {
+			_, err := processMetadataWrite([]byte(payload), "ark:99999/test", User{}, "")
+			if !errors.Is(err, ErrInvalidMetadata) {
+				t.Fatalf("Invalid JSON-LD was Accepted %s: %v", payload, err)
+			}
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+
+		original := map[string]interface{}{
+			"@context": map[string]interface{}{"@vocab": DefaultVocab},
+			"@id":      "ark:99999/test",
+			"name":     "test",
+		}
+		update := map[string]interface{}{"@context": map[string]interface{}{"evi": "https://w3id.org/EVI#"}, "evi:status": "done"}
+
+		if _, err := expandUpdate(original, update); err != nil {
+			t.Fatalf("Failed to Expand Update: %s", err.Error())
+		}
+
+		expanded, _ := update["_expanded"].(string)
+		if !strings.Contains(expanded, "https://w3id.org/EVI#status") || !strings.Contains(expanded, "http://schema.org/name") {
+			t.Fatalf("Expanded Form does not Reflect the Update: %s", expanded)
+		}
+	})
+
+}
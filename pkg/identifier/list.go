@@ -0,0 +1,135 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// Page sizes for listing namespaces and identifiers
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 1000
+)
+
+var (
+	ErrInvalidPageOption = errors.New("Invalid Paging Option")
+	ErrInvalidFields     = errors.New("Invalid Fields")
+)
+
+// Page is one page of a listing, Next is the cursor for the following page and is empty on the last page
+type Page struct {
+	Results []json.RawMessage `json:"results"`
+	Next    string            `json:"next,omitempty"`
+}
+
+// ListNamespaces returns a page of namespace records
+func (b *Backend) ListNamespaces(opt FindOptions) (page Page, err error) {
+
+	// namespaces are stored alongside identifiers, but have no namespace of their own
+	query := bson.D{{"namespace", bson.D{{"$exists", false}}}}
+
+	return b.listPage(query, opt)
+}
+
+// ListIdentifiers returns a page of the identifiers in the namespace guid.
+// When types is not empty only identifiers with one of those @type values are returned.
+// Embargoed identifiers are not listed.
+func (b *Backend) ListIdentifiers(guid string, types []string, opt FindOptions) (page Page, err error) {
+
+	_, err = b.GetNamespace(guid)
+	if err == mongo.ErrNoDocuments {
+		return page, ErrNoNamespace
+	}
+	if err != nil {
+		return
+	}
+
+	// embargoed identifiers are only resolved, by those who may see them
+	query := publicRecords(bson.D{{"namespace", guid}}, time.Now())
+	if len(types) > 0 {
+		query = append(query, bson.E{"@type", bson.D{{"$in", types}}})
+	}
+
+	return b.listPage(query, opt)
+}
+
+func (b *Backend) listPage(query bson.D, opt FindOptions) (page Page, err error) {
+
+	if opt.Limit <= 0 {
+		opt.Limit = DefaultPageLimit
+	}
+	if opt.Limit > MaxPageLimit {
+		opt.Limit = MaxPageLimit
+	}
+
+	records, next, err := b.Mongo.FindMany(query, opt)
+	if err != nil {
+		return
+	}
+
+	page.Next = next
+	page.Results = make([]json.RawMessage, 0, len(records))
+	for _, record := range records {
+		page.Results = append(page.Results, processMetadataRead(record))
+	}
+
+	return
+}
+
+// ParseFindOptions reads the paging parameters of a listing from a query string,
+// limit, cursor, sort (prefixed with - for descending order) and fields (comma separated dot notation paths)
+func ParseFindOptions(limit, cursor, sort, fields string) (opt FindOptions, err error) {
+
+	if limit != "" {
+		opt.Limit, err = strconv.ParseInt(limit, 10, 64)
+		if err != nil || opt.Limit < 1 {
+			return opt, ErrInvalidPageOption
+		}
+	}
+
+	opt.Cursor = cursor
+
+	if strings.HasPrefix(sort, "-") {
+		opt.Descending = true
+		sort = strings.TrimPrefix(sort, "-")
+	}
+	if strings.HasPrefix(sort, "$") {
+		return opt, ErrInvalidPageOption
+	}
+	opt.Sort = sort
+
+	if opt.Fields, err = ParseFields(fields); err != nil {
+		return opt, ErrInvalidPageOption
+	}
+
+	return
+}
+
+// ParseFields reads a comma separated list of dot notation paths, such as name,@type,author.name
+func ParseFields(fields string) (paths []string, err error) {
+
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if strings.HasPrefix(field, "$") || strings.Contains(field, ".$") || strings.Contains(field, "..") {
+			return nil, fmt.Errorf("%w: %q is not a valid path", ErrInvalidFields, field)
+		}
+		if field != "" {
+			paths = append(paths, field)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,102 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	bson "go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+)
+
+func TestPaging(t *testing.T) {
+
+	t.Run("Cursor", func(t *testing.T) {
+
+		cursor, err := encodeCursor("test identifier", "ark:99999/test")
+		if err != nil {
+			t.Fatalf("Failed to Encode Cursor: %s", err.Error())
+		}
+
+		value, id, err := decodeCursor(cursor)
+		if err != nil {
+			t.Fatalf("Failed to Decode Cursor: %s", err.Error())
+		}
+
+		if value.StringValue() != "test identifier" || id.StringValue() != "ark:99999/test" {
+			t.Fatalf("Cursor Round Trip Failed: %s %s", value, id)
+		}
+
+		if _, _, err = decodeCursor("not a cursor"); err != ErrInvalidCursor {
+			t.Fatalf("Invalid Cursor was Accepted: %v", err)
+		}
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+
+		cursor, _ := encodeCursor("test identifier", "ark:99999/test")
+
+		filter, err := cursorFilter(FindOptions{Cursor: cursor, Sort: "name"})
+		if err != nil {
+			t.Fatalf("Failed to Build Cursor Filter: %s", err.Error())
+		}
+
+		or, ok := filter.Map()["$or"].(bson.A)
+		if !ok || len(or) != 2 {
+			t.Fatalf("Ascending Filter should have 2 Clauses: %+v", filter)
+		}
+
+		filter, _ = cursorFilter(FindOptions{Cursor: cursor, Sort: "name", Descending: true})
+		if or := filter.Map()["$or"].(bson.A); len(or) != 3 {
+			t.Fatalf("Descending Filter should include Missing Values: %+v", filter)
+		}
+
+		filter, _ = cursorFilter(FindOptions{Cursor: cursor, Sort: "_id"})
+		if _, ok := filter.Map()["_id"]; !ok {
+			t.Fatalf("_id Filter should Compare _id Only: %+v", filter)
+		}
+	})
+
+	t.Run("Options", func(t *testing.T) {
+
+		opt, err := ParseFindOptions("10", "", "-name", "name, @type,author.name")
+		if err != nil {
+			t.Fatalf("Failed to Parse Options: %s", err.Error())
+		}
+
+		if opt.Limit != 10 || opt.Sort != "name" || !opt.Descending || len(opt.Fields) != 3 {
+			t.Fatalf("Incorrect Options: %+v", opt)
+		}
+
+		if _, err = ParseFindOptions("0", "", "", ""); err != ErrInvalidPageOption {
+			t.Fatalf("Invalid Limit was Accepted: %v", err)
+		}
+
+		if _, err = ParseFindOptions("", "", "$where", ""); err != ErrInvalidPageOption {
+			t.Fatalf("Operator Sort was Accepted: %v", err)
+		}
+	})
+
+	t.Run("Projection", func(t *testing.T) {
+
+		if _, err := ParseFields("name,$where"); !errors.Is(err, ErrInvalidFields) {
+			t.Fatalf("Operator Field was Accepted: %v", err)
+		}
+
+		if _, err := ParseFindOptions("", "", "", "author.$"); err != ErrInvalidPageOption {
+			t.Fatalf("Positional Field was Accepted: %v", err)
+		}
+
+		// author.name collides with author, mongo rejects projections naming both
+		proj := projection([]string{"author.name", "name", "@type", "author", "name"})
+		expected := bson.D{{"@id", 1}, {"name", 1}, {"@type", 1}, {"author", 1}}
+		if !reflect.DeepEqual(proj, expected) {
+			t.Fatalf("Incorrect Projection: %+v", proj)
+		}
+	})
+
+}
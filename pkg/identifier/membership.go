@@ -0,0 +1,277 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// membershipLink is a property by which an identifier names the identifier it is a member of, and the property of
+// that identifier listing its members
+type membershipLink struct {
+	property string
+	inverse  string
+	// parentTypes restricts the @type of the identifiers that list their members, any type does when empty
+	parentTypes []string
+}
+
+// membershipLinks are maintained on every write. A Project names the Organization it belongs to by
+// parentOrganization, and an identifier the Project it belongs to by isPartOf.
+var membershipLinks = []membershipLink{
+	{property: "parentOrganization", inverse: "subOrganization"},
+	{property: "isPartOf", inverse: "identifiers", parentTypes: []string{"Project"}},
+}
+
+// memberFields are copied from a member into the list of members of its parent
+var memberFields = []string{"@id", "@type", "name", "author"}
+
+// errLinkUnchanged ends an edit of a parent whose list of members needs no change
+var errLinkUnchanged = errors.New("Link Unchanged")
+
+// maxMembershipAttempts is how many times an edit of a list of members is retried when the parent changes under
+// it, each attempt reading the latest parent and member
+const maxMembershipAttempts = 10
+
+// syncMembership updates the lists of members of the identifiers guid belongs to, after a write of original to
+// updated. original is nil for a new identifier, updated for a removed one. Each parent guid belonged to or belongs
+// to is brought in line with the record of guid as it is stored when the parent is written, rather than as it was
+// written, so the lists converge on the latest write when writes of guid race. Parents that don't exist, or aren't
+// of a type that lists members, are skipped.
+func (b *Backend) syncMembership(guid string, original []byte, updated []byte) error {
+
+	before := recordMap(original)
+	after := recordMap(updated)
+
+	for _, link := range membershipLinks {
+
+		parents := localReferences(append(asList(before[link.property]), asList(after[link.property])...))
+
+		for _, parent := range parents {
+			if parent == guid {
+				continue
+			}
+			if err := b.editMembers(parent, link, guid); err != nil {
+				return fmt.Errorf("Failed to Update %s in the %s of %s: %w", guid, link.inverse, parent, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// editMembers brings the entry of guid in the list of members of parent in line with the stored record of guid.
+// Only the list, and the references stored with it, are written, the parent keeps its own dateModified and
+// modifiedBy. The write is conditioned on the revision of parent it was read at, and retried when that changed.
+func (b *Backend) editMembers(parent string, link membershipLink, guid string) error {
+
+	for attempt := 1; attempt <= maxMembershipAttempts; attempt++ {
+
+		err := b.applyMembers(parent, link, guid)
+		if err == errLinkUnchanged || err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != errRevisionChanged {
+			return err
+		}
+	}
+
+	return ErrPreconditionFailed
+}
+
+// applyMembers makes one attempt of editMembers. The member is read after the parent, so a write of the member
+// that isn't seen has its own sync conflict with this one, or follow it.
+func (b *Backend) applyMembers(parent string, link membershipLink, guid string) error {
+
+	parentRecord, err := b.Mongo.FindOne(bson.D{{"_id", parent}})
+	if err != nil {
+		return err
+	}
+
+	memberRecord, err := b.Mongo.FindOne(bson.D{{"_id", guid}})
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	update, err := membersUpdate(parent, recordMap(parentRecord), link, guid, recordMap(memberRecord), time.Now())
+	if err != nil {
+		return err
+	}
+
+	updatedRecord, err := b.Mongo.ModifyOne(Revisions{recordRevision(parentRecord)}.filter(bson.D{{"_id", parent}}), update)
+	if err == mongo.ErrNoDocuments {
+		return errRevisionChanged
+	}
+	if err != nil {
+		return err
+	}
+
+	b.Cache.Invalidate(parent)
+
+	return b.replaceInGraph(parentRecord, updatedRecord)
+}
+
+// membersUpdate returns the update operators that list member, the stored metadata of guid, in the link.inverse of
+// the parent metadata, or take guid out of it when member is nil or no longer names parent by link.property.
+// errLinkUnchanged is returned when the list needs no change.
+func membersUpdate(parent string, metadata map[string]interface{}, link membershipLink, guid string, member map[string]interface{}, now time.Time) (bson.D, error) {
+
+	if len(link.parentTypes) > 0 && !hasType(metadata["@type"], link.parentTypes) {
+		return nil, errLinkUnchanged
+	}
+
+	// reservations and tombstones don't list members, editing a reservation would fill it in
+	switch metadata["creativeWorkStatus"] {
+	case StatusReserved, StatusReservationExpired, StatusStub, StatusTombstone:
+		return nil, errLinkUnchanged
+	}
+
+	// tombstones keep some of their metadata, but are no longer members
+	var summary map[string]interface{}
+	if member != nil && member["creativeWorkStatus"] != StatusTombstone && containsString(localReferences(member[link.property]), parent) {
+		summary = memberSummary(member, now)
+	}
+
+	members := replaceMember(metadata[link.inverse], guid, summary)
+	if reflect.DeepEqual(members, asList(metadata[link.inverse])) {
+		return nil, errLinkUnchanged
+	}
+
+	update := bson.D{
+		{"$currentDate", bson.D{{"_modified", true}}},
+		{"$inc", bson.D{{"_rev", 1}}},
+	}
+
+	set := bson.D{}
+	if len(members) == 0 {
+		delete(metadata, link.inverse)
+		update = append(update, bson.E{"$unset", bson.D{{link.inverse, ""}}})
+	} else {
+		metadata[link.inverse] = members
+		set = append(set, bson.E{link.inverse, members})
+	}
+
+	// the parent now refers to guid, or no longer does, in mongo and in the triples written to stardog
+	expanded, err := expandRecord(metadata)
+	if err != nil {
+		return nil, err
+	}
+	set = append(set, bson.E{"_references", metadataReferences(parent, metadata)}, bson.E{"_expanded", expanded})
+
+	return append(update, bson.E{"$set", set}), nil
+}
+
+// memberSummary is the entry of a member in the list of members of its parent, an embargoed member is only listed
+// by its @id and @type
+func memberSummary(metadata map[string]interface{}, now time.Time) map[string]interface{} {
+
+	fields := memberFields
+	if embargo, _ := metadataEmbargo(metadata, "", now); embargo != nil {
+		fields = memberFields[:2]
+	}
+
+	summary := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, ok := metadata[field]; ok {
+			summary[field] = value
+		}
+	}
+
+	return summary
+}
+
+// localReferences returns the sorted ARKs of identifiers a property value refers to, as a string or an object with
+// an @id, or a list of those
+func localReferences(value interface{}) []string {
+
+	var refs []string
+	for _, item := range asList(value) {
+
+		value, _ := item.(string)
+		if node, ok := item.(map[string]interface{}); ok {
+			value, _ = node["@id"].(string)
+		}
+
+		if id, ok := localARK(value); ok && !containsString(refs, id) {
+			refs = append(refs, id)
+		}
+	}
+
+	sort.Strings(refs)
+
+	return refs
+}
+
+// replaceMember copies a list of members, with the entry for guid replaced by member in place, or appended when
+// there is none, and left out when member is nil
+func replaceMember(value interface{}, guid string, member map[string]interface{}) []interface{} {
+
+	members := []interface{}{}
+	replaced := false
+	for _, item := range asList(value) {
+		if refs := localReferences(item); len(refs) == 1 && refs[0] == guid {
+			if member != nil && !replaced {
+				members = append(members, member)
+				replaced = true
+			}
+			continue
+		}
+		members = append(members, item)
+	}
+
+	if member != nil && !replaced {
+		members = append(members, member)
+	}
+
+	return members
+}
+
+func asList(value interface{}) []interface{} {
+
+	switch v := value.(type) {
+	case nil:
+		return []interface{}{}
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+func hasType(value interface{}, types []string) bool {
+
+	for _, t := range asList(value) {
+		if name, ok := t.(string); ok && (containsString(types, name) || containsString(types, strings.TrimPrefix(name, "http://schema.org/"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordMap decodes a stored record, nil decodes to nil
+func recordMap(record []byte) map[string]interface{} {
+
+	if record == nil {
+		return nil
+	}
+
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(processMetadataRead(record), &doc); err != nil {
+		return nil
+	}
+
+	return doc
+}
@@ -0,0 +1,138 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	bson "go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMembership(t *testing.T) {
+
+	t.Run("References", func(t *testing.T) {
+
+		value := []interface{}{
+			"ark:99999/project",
+			map[string]interface{}{"@id": "https://n2t.net/ark:99999/org"},
+			map[string]interface{}{"@id": "ark:99999/project"},
+			map[string]interface{}{"name": "No Identifier"},
+			"ark:99999",
+			"https://example.org/elsewhere",
+		}
+
+		refs := localReferences(value)
+		if !reflect.DeepEqual(refs, []string{"ark:99999/org", "ark:99999/project"}) {
+			t.Fatalf("Incorrect References: %v", refs)
+		}
+
+		if refs := localReferences(nil); len(refs) != 0 {
+			t.Fatalf("Missing Property Has References: %v", refs)
+		}
+	})
+
+	t.Run("Summary", func(t *testing.T) {
+
+		metadata := map[string]interface{}{
+			"@id":         "ark:99999/dataset",
+			"@type":       "Dataset",
+			"name":        "Dataset",
+			"author":      map[string]interface{}{"name": "Author"},
+			"description": "Left Out",
+		}
+
+		summary := memberSummary(metadata, time.Now())
+		if len(summary) != 4 || summary["description"] != nil || summary["name"] != "Dataset" {
+			t.Fatalf("Incorrect Summary: %v", summary)
+		}
+
+		metadata["embargoDate"] = "2099-01-01"
+		summary = memberSummary(metadata, time.Now())
+		if len(summary) != 2 || summary["@id"] != "ark:99999/dataset" || summary["@type"] != "Dataset" {
+			t.Fatalf("Embargoed Summary Lists More Than @id and @type: %v", summary)
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+
+		other := map[string]interface{}{"@id": "ark:99999/other"}
+		stale := map[string]interface{}{"@id": "ark:99999/dataset", "name": "Old"}
+		member := map[string]interface{}{"@id": "ark:99999/dataset", "name": "New"}
+
+		members := replaceMember([]interface{}{stale, other}, "ark:99999/dataset", member)
+		if !reflect.DeepEqual(members, []interface{}{member, other}) {
+			t.Fatalf("Member Not Replaced In Place: %v", members)
+		}
+
+		members = replaceMember(other, "ark:99999/dataset", member)
+		if !reflect.DeepEqual(members, []interface{}{other, member}) {
+			t.Fatalf("Member Not Appended: %v", members)
+		}
+
+		members = replaceMember([]interface{}{stale, other, "ark:99999/dataset"}, "ark:99999/dataset", nil)
+		if !reflect.DeepEqual(members, []interface{}{other}) {
+			t.Fatalf("Member Not Removed: %v", members)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+
+		link := membershipLinks[1]
+		project := map[string]interface{}{
+			"@context":   map[string]interface{}{"@vocab": "http://schema.org/"},
+			"@id":        "ark:99999/project",
+			"@type":      "Project",
+			"modifiedBy": "https://orcid.org/0000-0000-0000-0000",
+		}
+		member := map[string]interface{}{"@id": "ark:99999/dataset", "@type": "Dataset", "name": "Dataset", "isPartOf": "ark:99999/project"}
+
+		update, err := membersUpdate("ark:99999/project", project, link, "ark:99999/dataset", member, time.Now())
+		if err != nil {
+			t.Fatalf("Member was not Listed: %s", err.Error())
+		}
+
+		set, _ := update.Map()["$set"].(bson.D)
+		if len(set) != 3 || set[0].Key != "identifiers" || set[1].Key != "_references" || set[2].Key != "_expanded" {
+			t.Fatalf("Update Sets More than the Members, References and Expansion: %+v", update)
+		}
+
+		// the graph form of the parent carries the link to the new member
+		graph := string(graphForm([]byte(`{"_expanded": ` + strconv.Quote(set[2].Value.(string)) + `}`)))
+		if !strings.Contains(graph, "http://schema.org/identifiers") || !strings.Contains(graph, "ark:99999/dataset") {
+			t.Fatalf("Graph Form of the Parent doesn't List the Member: %s", graph)
+		}
+
+		// the stored record of the member decides, so a stale sync can't list a member that moved
+		moved := map[string]interface{}{"@id": "ark:99999/dataset", "isPartOf": "ark:99999/other"}
+		if _, err = membersUpdate("ark:99999/project", map[string]interface{}{"@type": "Project"}, link, "ark:99999/dataset", moved, time.Now()); err != errLinkUnchanged {
+			t.Fatalf("Member that Moved was Listed: %v", err)
+		}
+
+		project["identifiers"] = []interface{}{map[string]interface{}{"@id": "ark:99999/dataset"}}
+		update, err = membersUpdate("ark:99999/project", project, link, "ark:99999/dataset", nil, time.Now())
+		if _, ok := update.Map()["$unset"]; err != nil || !ok {
+			t.Fatalf("Removed Member was not Unlisted: %+v %v", update, err)
+		}
+
+		if _, err = membersUpdate("ark:99999/org", map[string]interface{}{"@type": "Organization"}, link, "ark:99999/dataset", member, time.Now()); err != errLinkUnchanged {
+			t.Fatalf("Parent that doesn't List Members was Edited: %v", err)
+		}
+	})
+
+	t.Run("Type", func(t *testing.T) {
+
+		if !hasType([]interface{}{"Dataset", "http://schema.org/Project"}, []string{"Project"}) {
+			t.Fatalf("Project Type Not Matched")
+		}
+		if hasType("Dataset", []string{"Project"}) || hasType(nil, []string{"Project"}) {
+			t.Fatalf("Other Type Matched")
+		}
+	})
+}
@@ -0,0 +1,119 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/buger/jsonparser"
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// URLChange is an identifier whose url is rewritten by MigrateURLs
+type URLChange struct {
+	ID  string `json:"@id"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// MigrateURLs rewrites the url of every identifier whose url no longer matches the one built from the current
+// base url and url templates, in mongo and in stardog. When namespace is empty identifiers in every namespace are
+// migrated. With dryRun set the changes are returned without being written.
+func (b *Backend) MigrateURLs(ctx context.Context, namespace string, dryRun bool) (changes []URLChange, err error) {
+
+	query := bson.D{{"namespace", bson.D{{"$exists", true}}}}
+	if namespace != "" {
+		query = bson.D{{"namespace", namespace}}
+	}
+
+	policies := make(map[string]NamespacePolicy)
+
+	// collect the changes before writing so the cursor isn't reading documents as they are updated
+	err = b.Mongo.Iterate(ctx, query, func(record []byte) (iterErr error) {
+
+		guid, _ := jsonparser.GetString(record, "_id")
+		ns, _ := jsonparser.GetString(record, "namespace")
+		current, _ := jsonparser.GetString(record, "url")
+
+		policy, ok := policies[ns]
+		if !ok {
+			nsRecord, nsErr := b.GetNamespace(ns)
+
+			// identifiers left behind by a deleted namespace keep the default template
+			if nsErr != nil && nsErr != mongo.ErrNoDocuments {
+				return nsErr
+			}
+
+			if nsErr == nil {
+				if policy, iterErr = parseNamespacePolicy(nsRecord); iterErr != nil {
+					return fmt.Errorf("namespace %s: %w", ns, iterErr)
+				}
+			}
+
+			policies[ns] = policy
+		}
+
+		if expected := b.identifierURL(policy, guid); expected != current {
+			changes = append(changes, URLChange{ID: guid, Old: current, New: expected})
+		}
+
+		return
+	})
+
+	if err != nil || dryRun {
+		return
+	}
+
+	for i, change := range changes {
+		if err = b.migrateURL(change); err != nil {
+			return changes[:i], fmt.Errorf("Failed to migrate url of %s: %w", change.ID, err)
+		}
+	}
+
+	return
+}
+
+func (b *Backend) migrateURL(change URLChange) (err error) {
+
+	original, err := b.Mongo.FindOne(bson.D{{"_id", change.ID}})
+	if err != nil {
+		return
+	}
+
+	originalMap := make(map[string]interface{})
+	if err = json.Unmarshal(original, &originalMap); err != nil {
+		return
+	}
+
+	// the url is part of the expanded form, so it's rewritten along with the url
+	updateMap := map[string]interface{}{"url": change.New}
+	if _, err = expandUpdate(originalMap, updateMap); err != nil {
+		return
+	}
+
+	update, err := json.Marshal(updateMap)
+	if err != nil {
+		return
+	}
+
+	updated, err := b.Mongo.UpdateOne(bson.D{{"_id", change.ID}}, update)
+	if err != nil {
+		return
+	}
+
+	b.Cache.Invalidate(change.ID)
+
+	// tombstones were removed from the graph, so only their mongo record changes
+	if status, _ := jsonparser.GetString(original, "creativeWorkStatus"); status == StatusTombstone {
+		return
+	}
+
+	return b.replaceInGraph(original, updated)
+}
@@ -8,11 +8,15 @@ package identifier
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 	bson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	mongo "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"os"
@@ -89,15 +93,21 @@ func (ms MongoServer) InsertOne(record interface{}) (err error) {
 	return
 }
 
-func (ms MongoServer) FindOne(query bson.D) (record []byte, err error) {
+// FindOne returns the first document matching query as JSON, restricted to the dot notation paths in fields if any are given
+func (ms MongoServer) FindOne(query bson.D, fields ...string) (record []byte, err error) {
 
     // create a new context for the operation
     mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
 
+	opt := options.FindOne()
+	if len(fields) > 0 {
+		opt.SetProjection(projection(fields))
+	}
+
 	recordMap := make(map[string]interface{})
 	col := ms.Client.Database(ms.Database).Collection(ms.Collection)
-	err = col.FindOne(mongoCtx, query).Decode(&recordMap)
+	err = col.FindOne(mongoCtx, query, opt).Decode(&recordMap)
 
 	if err != nil {
 		mongoLogger.Error().
@@ -120,14 +130,56 @@ func (ms MongoServer) FindOne(query bson.D) (record []byte, err error) {
 	return
 }
 
-func (ms MongoServer) FindMany(query bson.D, results interface{}) (err error) {
+// FindOptions controls the paging, ordering and projection of FindMany
+type FindOptions struct {
+	// Limit is the maximum number of documents in a page
+	Limit int64
+	// Cursor is the opaque next cursor returned with the previous page, empty for the first page
+	Cursor string
+	// Sort is the field documents are ordered by, _id breaks ties between equal values, defaults to _id
+	Sort       string
+	Descending bool
+	// Fields restricts the properties returned to these dot notation paths, all properties are returned when empty
+	Fields []string
+}
+
+// FindMany returns one page of the documents matching query as JSON, along with the cursor of the next page.
+// next is empty when there are no more documents.
+func (ms MongoServer) FindMany(query bson.D, page FindOptions) (records [][]byte, next string, err error) {
 
     // create a new context for the operation
     mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
 
+	if page.Sort == "" {
+		page.Sort = "_id"
+	}
+
+	direction := 1
+	if page.Descending {
+		direction = -1
+	}
+
+	if page.Cursor != "" {
+		var after bson.D
+		after, err = cursorFilter(page)
+		if err != nil {
+			return
+		}
+		query = append(query, after...)
+	}
+
+	// fetch an extra document to find out whether there is another page
+	opt := options.Find().
+		SetSort(bson.D{{page.Sort, direction}, {"_id", direction}}).
+		SetLimit(page.Limit + 1)
+
+	if len(page.Fields) > 0 {
+		opt.SetProjection(projection(append(page.Fields, page.Sort)))
+	}
+
 	col := ms.Client.Database(ms.Database).Collection(ms.Collection)
-	cur, err := col.Find(mongoCtx, query)
+	cur, err := col.Find(mongoCtx, query, opt)
 
 	if err != nil {
 
@@ -140,6 +192,7 @@ func (ms MongoServer) FindMany(query bson.D, results interface{}) (err error) {
 		return
 	}
 
+	var results []map[string]interface{}
 	err = cur.All(mongoCtx, &results)
 
 	if err != nil {
@@ -153,13 +206,486 @@ func (ms MongoServer) FindMany(query bson.D, results interface{}) (err error) {
 		return
 	}
 
+	if int64(len(results)) > page.Limit {
+		results = results[:page.Limit]
+		last := results[len(results)-1]
+		next, err = encodeCursor(valueAtPath(last, page.Sort), last["_id"])
+		if err != nil {
+			return
+		}
+	}
+
+	requested := false
+	for _, field := range page.Fields {
+		if field == page.Sort {
+			requested = true
+		}
+	}
+
+	records = make([][]byte, 0, len(results))
+	for _, result := range results {
+
+		// the sort field is always projected to build the cursor, drop it if it wasn't asked for
+		if len(page.Fields) > 0 && !requested && page.Sort != "_id" && !strings.Contains(page.Sort, ".") {
+			delete(result, page.Sort)
+		}
+
+		var record []byte
+		record, err = json.Marshal(result)
+		if err != nil {
+			return
+		}
+		records = append(records, record)
+	}
+
 	mongoLogger.Info().
 		Str("operation", "FindMany").
 		Interface("query", query).
+		Int("count", len(records)).
+		Msg("success")
+
+	return
+
+}
+
+// valueAtPath returns the value at a dot notation path in a decoded document, or nil if it is unset
+func valueAtPath(doc map[string]interface{}, path string) interface{} {
+
+	var current interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+
+	return current
+}
+
+// projection converts dot notation paths into a mongo projection, @id is always included.
+// Paths inside another requested path are left out, mongo rejects projections where they collide.
+func projection(fields []string) bson.D {
+
+	requested := map[string]bool{"@id": true}
+	for _, field := range fields {
+		if field != "" {
+			requested[field] = true
+		}
+	}
+
+	proj := bson.D{{"@id", 1}}
+	seen := map[string]bool{"@id": true}
+
+	for _, field := range fields {
+		if field == "" || seen[field] || coveredPath(field, requested) {
+			continue
+		}
+		seen[field] = true
+		proj = append(proj, bson.E{field, 1})
+	}
+
+	return proj
+}
+
+// coveredPath reports whether a parent of a dot notation path is in paths
+func coveredPath(path string, paths map[string]bool) bool {
+
+	for i := strings.LastIndex(path, "."); i > 0; i = strings.LastIndex(path[:i], ".") {
+		if paths[path[:i]] {
+			return true
+		}
+	}
+
+	return false
+}
+
+var ErrInvalidCursor = errors.New("Invalid Page Cursor")
+
+// encodeCursor serializes the sort value and _id of the last document of a page into an opaque string
+func encodeCursor(value interface{}, id interface{}) (cursor string, err error) {
+
+	b, err := bson.Marshal(bson.D{{"v", value}, {"id", id}})
+	if err != nil {
+		return
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor returns the sort value and _id encoded by encodeCursor
+func decodeCursor(cursor string) (value bson.RawValue, id bson.RawValue, err error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return value, id, ErrInvalidCursor
+	}
+
+	raw := bson.Raw(b)
+	if raw.Validate() != nil {
+		return value, id, ErrInvalidCursor
+	}
+
+	value = raw.Lookup("v")
+	id = raw.Lookup("id")
+
+	if id.Type == 0 {
+		return value, id, ErrInvalidCursor
+	}
+
+	return
+}
+
+// cursorFilter builds the query restricting results to documents after the cursor in the sort order.
+// Documents missing the sort field sort before every value ascending, and after every value descending.
+func cursorFilter(page FindOptions) (filter bson.D, err error) {
+
+	value, id, err := decodeCursor(page.Cursor)
+	if err != nil {
+		return
+	}
+
+	after := "$gt"
+	if page.Descending {
+		after = "$lt"
+	}
+
+	if page.Sort == "_id" {
+		return bson.D{{"_id", bson.D{{after, id}}}}, nil
+	}
+
+	if value.Type == 0 || value.Type == bsontype.Null {
+		sameValue := bson.D{{page.Sort, nil}, {"_id", bson.D{{after, id}}}}
+
+		if page.Descending {
+			return sameValue, nil
+		}
+
+		return bson.D{{"$or", bson.A{
+			sameValue,
+			bson.D{{page.Sort, bson.D{{"$ne", nil}}}},
+		}}}, nil
+	}
+
+	or := bson.A{
+		bson.D{{page.Sort, bson.D{{after, value}}}},
+		bson.D{{page.Sort, value}, {"_id", bson.D{{after, id}}}},
+	}
+
+	if page.Descending {
+		or = append(or, bson.D{{page.Sort, nil}})
+	}
+
+	return bson.D{{"$or", or}}, nil
+}
+
+// Iterate walks every document matching query in _id order, passing each one to fn as JSON.
+// Documents are decoded one at a time from the cursor so the full result set is never held in memory.
+// Iteration stops at the first error returned by fn.
+func (ms MongoServer) Iterate(ctx context.Context, query bson.D, fn func(record []byte) error) (err error) {
+
+	col := ms.Client.Database(ms.Database).Collection(ms.Collection)
+	opt := options.Find().SetSort(bson.D{{"_id", 1}})
+
+	cur, err := col.Find(ctx, query, opt)
+	if err != nil {
+
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "Iterate").
+			Interface("query", query).
+			Msg("failed to execute query")
+
+		return
+	}
+	defer cur.Close(ctx)
+
+	count := 0
+	for cur.Next(ctx) {
+
+		recordMap := make(map[string]interface{})
+		if err = cur.Decode(&recordMap); err != nil {
+			break
+		}
+
+		var record []byte
+		if record, err = json.Marshal(recordMap); err != nil {
+			break
+		}
+
+		if err = fn(record); err != nil {
+			break
+		}
+		count++
+	}
+
+	if err == nil {
+		err = cur.Err()
+	}
+
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "Iterate").
+			Interface("query", query).
+			Int("count", count).
+			Msg("failed iterating query cursor")
+
+		return
+	}
+
+	mongoLogger.Info().
+		Str("operation", "Iterate").
+		Interface("query", query).
+		Int("count", count).
 		Msg("success")
 
 	return
+}
+
+// WatchChanges calls fn with the _id of every document inserted, updated, replaced or deleted until ctx is done or
+// the change stream fails. fn is called with an empty _id when the stream is invalidated, such as when the
+// collection is dropped, and the stream then ends.
+func (ms MongoServer) WatchChanges(ctx context.Context, fn func(id string)) (err error) {
+
+	col := ms.Client.Database(ms.Database).Collection(ms.Collection)
+
+	stream, err := col.Watch(ctx, mongo.Pipeline{})
+	if err != nil {
+
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "WatchChanges").
+			Msg("failed to open change stream")
+
+		return
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+
+		var event struct {
+			OperationType string `bson:"operationType"`
+			DocumentKey   struct {
+				ID bson.RawValue `bson:"_id"`
+			} `bson:"documentKey"`
+		}
+
+		if err = stream.Decode(&event); err != nil {
+			return
+		}
+
+		switch event.OperationType {
+		case "insert", "update", "replace", "delete":
+			// every record is keyed by its ARK
+			if id, ok := event.DocumentKey.ID.StringValueOK(); ok {
+				fn(id)
+			}
+		case "drop", "dropDatabase", "rename", "invalidate":
+			fn("")
+		}
+	}
+
+	return stream.Err()
+}
+
+// idempotencyKeys is the collection idempotency keys are kept in, next to the collection of identifiers
+func (ms MongoServer) idempotencyKeys() *mongo.Collection {
+	return ms.Client.Database(ms.Database).Collection(ms.Collection + "_idempotency")
+}
+
+// EnsureIdempotencyIndex has mongo delete idempotency keys once window has passed since they were claimed,
+// replacing the index when the window changed
+func (ms MongoServer) EnsureIdempotencyIndex(window time.Duration) (err error) {
+
+    // create a new context for the operation
+    mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+	index := mongo.IndexModel{
+		Keys:    bson.D{{"claimed", 1}},
+		Options: options.Index().SetName("claimed_ttl").SetExpireAfterSeconds(int32(window / time.Second)),
+	}
+
+	indexes := ms.idempotencyKeys().Indexes()
+	_, err = indexes.CreateOne(mongoCtx, index)
+
+	// IndexOptionsConflict
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 85 {
+		if _, err = indexes.DropOne(mongoCtx, "claimed_ttl"); err == nil {
+			_, err = indexes.CreateOne(mongoCtx, index)
+		}
+	}
+
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "EnsureIdempotencyIndex").
+			Dur("window", window).
+			Msg("failed to create idempotency key index")
+	}
+
+	return
+}
+
+// EnsureReferenceIndex indexes the identifiers each record refers to, so the records referring to an identifier
+// can be looked up
+func (ms MongoServer) EnsureReferenceIndex() (err error) {
+
+    // create a new context for the operation
+    mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+	col := ms.Client.Database(ms.Database).Collection(ms.Collection)
+	_, err = col.Indexes().CreateOne(mongoCtx, mongo.IndexModel{
+		Keys:    bson.D{{"_references.id", 1}},
+		Options: options.Index().SetName("references_id"),
+	})
+
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "EnsureReferenceIndex").
+			Msg("failed to create reference index")
+	}
+
+	return
+}
+
+// EnsureExpiryIndex indexes the parsed expires of identifiers, so those that expired can be looked up
+func (ms MongoServer) EnsureExpiryIndex() (err error) {
+
+    // create a new context for the operation
+    mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+	col := ms.Client.Database(ms.Database).Collection(ms.Collection)
+	_, err = col.Indexes().CreateOne(mongoCtx, mongo.IndexModel{
+		Keys:    bson.D{{"_expires", 1}},
+		Options: options.Index().SetName("expires"),
+	})
+
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "EnsureExpiryIndex").
+			Msg("failed to create expiry index")
+	}
+
+	return
+}
+
+// ClaimIdempotencyKey stores claim unless its key is already claimed, in which case the claim holding the key is
+// returned instead. The held claim is empty when it was removed in the meantime.
+func (ms MongoServer) ClaimIdempotencyKey(claim IdempotencyClaim) (held IdempotencyClaim, claimed bool, err error) {
+
+    // create a new context for the operation
+    mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+	col := ms.idempotencyKeys()
+	_, err = col.InsertOne(mongoCtx, claim)
+	if err == nil {
+		return claim, true, nil
+	}
+
+	if !isDuplicateKey(err) {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "ClaimIdempotencyKey").
+			Str("key", claim.Key).
+			Msg("failed to claim idempotency key")
+
+		return
+	}
+
+	err = col.FindOne(mongoCtx, bson.D{{"_id", claim.Key}}).Decode(&held)
+	if err == mongo.ErrNoDocuments {
+		return IdempotencyClaim{}, false, nil
+	}
+
+	return
+}
+
+// CompleteIdempotencyKey marks that the identifier of claim was minted
+func (ms MongoServer) CompleteIdempotencyKey(claim IdempotencyClaim) (err error) {
+
+    // create a new context for the operation
+    mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+	query := bson.D{{"_id", claim.Key}, {"claimed", claim.Claimed}}
+	_, err = ms.idempotencyKeys().UpdateOne(mongoCtx, query, bson.D{{"$set", bson.D{{"completed", true}}}})
+
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "CompleteIdempotencyKey").
+			Str("key", claim.Key).
+			Msg("failed to complete idempotency key")
+	}
+
+	return
+}
+
+// ReleaseIdempotencyKey removes claim, a newer claim of the same key is left in place
+func (ms MongoServer) ReleaseIdempotencyKey(claim IdempotencyClaim) (err error) {
+
+    // create a new context for the operation
+    mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+	query := bson.D{{"_id", claim.Key}, {"claimed", claim.Claimed}}
+	_, err = ms.idempotencyKeys().DeleteOne(mongoCtx, query)
+
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "ReleaseIdempotencyKey").
+			Str("key", claim.Key).
+			Msg("failed to release idempotency key")
+	}
+
+	return
+}
+
+// RecordEvent appends an event to the collection events are kept in, next to the collection of identifiers
+func (ms MongoServer) RecordEvent(event interface{}) (err error) {
+
+    // create a new context for the operation
+    mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+	col := ms.Client.Database(ms.Database).Collection(ms.Collection + "_events")
+	_, err = col.InsertOne(mongoCtx, event)
+
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "RecordEvent").
+			Interface("event", event).
+			Msg("failed to record event in mongo")
+	}
+
+	return
+}
+
+// isDuplicateKey reports whether a write failed because a document with the same _id exists
+func isDuplicateKey(err error) bool {
+
+	var writeErr mongo.WriteException
+	if !errors.As(err, &writeErr) {
+		return false
+	}
 
+	for _, e := range writeErr.WriteErrors {
+		if e.Code == 11000 {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (ms MongoServer) DeleteOne(query bson.D) (record map[string]interface{}, err error) {
@@ -244,38 +770,124 @@ func (ms MongoServer) UpdateOne(query bson.D, update []byte) (record []byte, err
 	return
 }
 
-type tuple struct {
-	Key   string
-	Value interface{}
+// ModifyOne applies update operators to the first document matching query, returning the updated document as JSON
+func (ms MongoServer) ModifyOne(query bson.D, update bson.D) (record []byte, err error) {
+
+    // create a new context for the operation
+    mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+	col := ms.Client.Database(ms.Database).Collection(ms.Collection)
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	rec := make(map[string]interface{})
+	err = col.FindOneAndUpdate(mongoCtx, query, update, opt).Decode(&rec)
+
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "ModifyOne").
+			Interface("query", query).
+			Interface("update", update).
+			Msg("failed ModifyOne operation in mongo")
+
+		return
+	}
+
+	record, err = json.Marshal(rec)
+
+	mongoLogger.Info().
+		Str("operation", "ModifyOne").
+		Interface("query", query).
+		Interface("update", update).
+		Msg("succeeded ModifyOne operation in mongo")
+
+	return
+}
+
+func (ms MongoServer) ReplaceOne(query bson.D, record interface{}) (err error) {
+
+    // create a new context for the operation
+    mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+	col := ms.Client.Database(ms.Database).Collection(ms.Collection)
+	result, err := col.ReplaceOne(mongoCtx, query, record)
+
+	if err == nil && result.MatchedCount == 0 {
+		err = mongo.ErrNoDocuments
+	}
+
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "ReplaceOne").
+			Interface("query", query).
+			Interface("record", record).
+			Msg("failed ReplaceOne operation in mongo")
+
+		return
+	}
+
+	mongoLogger.Info().
+		Str("operation", "ReplaceOne").
+		Interface("query", query).
+		Interface("record", record).
+		Msg("succeeded ReplaceOne operation in mongo")
+
+	return
+}
+
+func (ms MongoServer) CountDocuments(query bson.D) (count int64, err error) {
+
+    // create a new context for the operation
+    mongoCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+	col := ms.Client.Database(ms.Database).Collection(ms.Collection)
+	count, err = col.CountDocuments(mongoCtx, query)
+
+	if err != nil {
+		mongoLogger.Error().
+			Err(err).
+			Str("operation", "CountDocuments").
+			Interface("query", query).
+			Msg("failed to count documents in mongo")
+
+		return
+	}
+
+	mongoLogger.Info().
+		Str("operation", "CountDocuments").
+		Interface("query", query).
+		Int64("count", count).
+		Msg("success")
+
+	return
 }
 
 func nestedUpdate(update []byte) (bsonUpdate []byte, err error) {
-	processedMap := make(map[string]interface{})
 	updateMap := make(map[string]interface{})
 	err = json.Unmarshal(update, &updateMap)
 	if err != nil {
 		return
 	}
 
-	resChan := make(chan tuple, 50)
-	dotConvert("", updateMap, resChan)
+	// collect every leaf value of the update under its path in dot notation
+	processedMap := make(map[string]interface{})
+	dotConvert("", updateMap, processedMap)
+
+	bsonUpdate, err = bson.Marshal(
+		map[string]interface{}{
+			"$set":         processedMap,
+			"$currentDate": map[string]interface{}{"_modified": true},
+			"$inc":         map[string]interface{}{"_rev": 1},
+		})
 
-	for {
-		select {
-		case elem := <-resChan:
-			processedMap[elem.Key] = elem.Value
-		default:
-			close(resChan)
-			bsonUpdate, err = bson.Marshal(
-				map[string]interface{}{
-					"$set": processedMap,
-				})
-			return
-		}
-	}
+	return
 }
 
-func dotConvert(base string, input map[string]interface{}, res chan tuple) {
+func dotConvert(base string, input map[string]interface{}, res map[string]interface{}) {
 	for key, val := range input {
 		var newBase string
 		if base == "" {
@@ -287,7 +899,7 @@ func dotConvert(base string, input map[string]interface{}, res chan tuple) {
 			dotConvert(newBase, val.(map[string]interface{}), res)
 		} else {
 			//log.Println("$set: ", newBase, " ", val)
-			res <- tuple{Key: newBase, Value: val}
+			res[newBase] = val
 		}
 	}
 
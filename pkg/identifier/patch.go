@@ -0,0 +1,457 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+// Media types of the patch documents accepted when patching an identifier
+const (
+	MediaTypeMergePatch = "application/merge-patch+json"
+	MediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+var (
+	ErrUnsupportedPatch = errors.New("Unsupported Patch Media Type")
+	ErrInvalidPatch     = errors.New("Invalid Patch")
+	ErrPatchConflict    = errors.New("Patch Cannot be Applied")
+)
+
+// metadataEdit turns the metadata of an identifier into its new metadata
+type metadataEdit func(metadata map[string]interface{}) (map[string]interface{}, error)
+
+// parsePatch reads a patch document of mediaType into the edit it makes
+func parsePatch(patch []byte, mediaType string) (metadataEdit, error) {
+
+	switch mediaType {
+
+	case MediaTypeMergePatch:
+		var doc interface{}
+		if err := json.Unmarshal(patch, &doc); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+		}
+
+		return func(metadata map[string]interface{}) (map[string]interface{}, error) {
+			patched, ok := mergePatch(metadata, doc).(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%w: metadata must be an object", ErrInvalidPatch)
+			}
+			return patched, nil
+		}, nil
+
+	case MediaTypeJSONPatch:
+		var ops []patchOperation
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+		}
+
+		return func(metadata map[string]interface{}) (map[string]interface{}, error) {
+			return applyJSONPatch(metadata, ops)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedPatch, mediaType)
+}
+
+// mergePatch applies a JSON Merge Patch (RFC 7396) to a copy of target, null removes a property
+func mergePatch(target interface{}, patch interface{}) interface{} {
+
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	merged := make(map[string]interface{}, len(t))
+	for k, v := range t {
+		merged[k] = v
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = mergePatch(merged[k], v)
+	}
+
+	return merged
+}
+
+// patchOperation is one operation of a JSON Patch (RFC 6902)
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies the operations in order to a copy of doc, if one fails none of them are applied
+func applyJSONPatch(doc map[string]interface{}, ops []patchOperation) (map[string]interface{}, error) {
+
+	var current interface{} = copyValue(doc)
+
+	for i, op := range ops {
+		var err error
+		if current, err = op.apply(current); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	patched, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata must be an object", ErrInvalidPatch)
+	}
+
+	return patched, nil
+}
+
+func (op patchOperation) apply(doc interface{}) (interface{}, error) {
+
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: %s is missing a path", ErrInvalidPatch, op.Op)
+	}
+
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var from []string
+	if op.Op == "move" || op.Op == "copy" {
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: %s is missing from", ErrInvalidPatch, op.Op)
+		}
+		if from, err = parsePointer(*op.From); err != nil {
+			return nil, err
+		}
+	}
+
+	var value interface{}
+	if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: %s is missing a value", ErrInvalidPatch, op.Op)
+		}
+		if err = json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+		}
+	}
+
+	switch op.Op {
+
+	case "add":
+		return addAt(doc, path, value)
+
+	case "remove":
+		doc, _, err = removeAt(doc, path)
+		return doc, err
+
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, _, err = removeAt(doc, path); err != nil {
+			return nil, err
+		}
+		return addAt(doc, path, value)
+
+	case "move":
+		if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+			return nil, fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPatch, *op.From)
+		}
+		if doc, value, err = removeAt(doc, from); err != nil {
+			return nil, err
+		}
+		return addAt(doc, path, value)
+
+	case "copy":
+		if value, err = valueAt(doc, from); err != nil {
+			return nil, err
+		}
+		return addAt(doc, path, copyValue(value))
+
+	case "test":
+		actual, err := valueAt(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(actual, value) {
+			return nil, fmt.Errorf("%w: %s does not have the tested value", ErrPatchConflict, *op.Path)
+		}
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: %q is not a JSON pointer", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex reads a reference token as an index into an array of length n, end allows the index n
+func arrayIndex(token string, n int, end bool) (int, error) {
+
+	if token == "-" && end {
+		return n, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrInvalidPatch, token)
+	}
+
+	if i > n || (i == n && !end) {
+		return 0, fmt.Errorf("%w: index %d is out of range", ErrPatchConflict, i)
+	}
+
+	return i, nil
+}
+
+func valueAt(doc interface{}, path []string) (interface{}, error) {
+
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrPatchConflict, token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", ErrPatchConflict, token)
+		}
+	}
+
+	return doc, nil
+}
+
+// editAt replaces the container holding the last token of path with the result of edit, returning the new document
+func editAt(doc interface{}, path []string, edit func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+
+	if len(path) == 1 {
+		return edit(doc, path[0])
+	}
+
+	switch node := doc.(type) {
+
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s does not exist", ErrPatchConflict, path[0])
+		}
+		child, err := editAt(child, path[1:], edit)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = child
+		return node, nil
+
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := editAt(node[i], path[1:], edit)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s does not exist", ErrPatchConflict, path[0])
+}
+
+func addAt(doc interface{}, path []string, value interface{}) (interface{}, error) {
+
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return editAt(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("%w: cannot add %s to a value", ErrPatchConflict, token)
+	})
+}
+
+func removeAt(doc interface{}, path []string) (interface{}, interface{}, error) {
+
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	var removed interface{}
+
+	doc, err := editAt(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrPatchConflict, token)
+			}
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: %s does not exist", ErrPatchConflict, token)
+	})
+
+	return doc, removed, err
+}
+
+// diffUpdate builds the mongo update turning the original record into the updated one and incrementing its revision.
+// Changed values are set, missing ones unset, and arrays that only gained items at the end are pushed to. Objects
+// with changed keys that can't be used in a dot notation path are set as a whole, ok is false when that is the
+// record itself.
+func diffUpdate(original map[string]interface{}, updated map[string]interface{}) (update bson.D, ok bool) {
+
+	var ops updateOperators
+	if !ops.diff("", original, updated) {
+		return nil, false
+	}
+
+	if len(ops.set) > 0 {
+		update = append(update, bson.E{"$set", ops.set})
+	}
+	if len(ops.unset) > 0 {
+		update = append(update, bson.E{"$unset", ops.unset})
+	}
+	if len(ops.push) > 0 {
+		update = append(update, bson.E{"$push", ops.push})
+	}
+
+	update = append(update,
+		bson.E{"$currentDate", bson.D{{"_modified", true}}},
+		bson.E{"$inc", bson.D{{"_rev", 1}}},
+	)
+
+	return update, true
+}
+
+type updateOperators struct {
+	set, unset, push bson.D
+}
+
+// diff adds the operators for the changes between two objects at path base, returning false without adding any
+// when a changed key can't be part of a path
+func (ops *updateOperators) diff(base string, original map[string]interface{}, updated map[string]interface{}) bool {
+
+	keys := make([]string, 0, len(original)+len(updated))
+	for key := range original {
+		keys = append(keys, key)
+	}
+	for key := range updated {
+		if _, ok := original[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes updateOperators
+
+	for _, key := range keys {
+		before, inOriginal := original[key]
+		after, inUpdated := updated[key]
+
+		if inOriginal && inUpdated && reflect.DeepEqual(before, after) {
+			continue
+		}
+
+		if key == "" || strings.Contains(key, ".") || strings.HasPrefix(key, "$") {
+			return false
+		}
+
+		path := key
+		if base != "" {
+			path = base + "." + key
+		}
+
+		switch {
+		case !inUpdated:
+			changes.unset = append(changes.unset, bson.E{path, ""})
+
+		case !inOriginal:
+			changes.set = append(changes.set, bson.E{path, after})
+
+		default:
+			beforeMap, beforeIsMap := before.(map[string]interface{})
+			afterMap, afterIsMap := after.(map[string]interface{})
+			if beforeIsMap && afterIsMap && changes.diff(path, beforeMap, afterMap) {
+				continue
+			}
+
+			beforeArray, beforeIsArray := before.([]interface{})
+			afterArray, afterIsArray := after.([]interface{})
+			if beforeIsArray && afterIsArray && len(afterArray) > len(beforeArray) && reflect.DeepEqual(beforeArray, afterArray[:len(beforeArray)]) {
+				changes.push = append(changes.push, bson.E{path, bson.D{{"$each", afterArray[len(beforeArray):]}}})
+				continue
+			}
+
+			changes.set = append(changes.set, bson.E{path, after})
+		}
+	}
+
+	ops.set = append(ops.set, changes.set...)
+	ops.unset = append(ops.unset, changes.unset...)
+	ops.push = append(ops.push, changes.push...)
+
+	return true
+}
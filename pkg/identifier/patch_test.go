@@ -0,0 +1,249 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPatch(t *testing.T) {
+
+	original := func() map[string]interface{} {
+		var doc map[string]interface{}
+		json.Unmarshal([]byte(`{
+			"@id": "ark:99999/test",
+			"name": "test",
+			"description": "an example",
+			"keywords": ["a", "b"],
+			"author": {"name": "M. Levinson", "affiliation": "UVA"}
+		}`), &doc)
+		return doc
+	}
+
+	patch := func(mediaType string, body string) (map[string]interface{}, error) {
+		edit, err := parsePatch([]byte(body), mediaType)
+		if err != nil {
+			return nil, err
+		}
+		return edit(original())
+	}
+
+	t.Run("MergePatch", func(t *testing.T) {
+
+		patched, err := patch(MediaTypeMergePatch, `{"description": null, "author": {"affiliation": null, "email": "m@example.org"}, "keywords": ["c"]}`)
+		if err != nil {
+			t.Fatalf("Failed to Apply Merge Patch: %s", err.Error())
+		}
+
+		expected := original()
+		delete(expected, "description")
+		expected["author"] = map[string]interface{}{"name": "M. Levinson", "email": "m@example.org"}
+		expected["keywords"] = []interface{}{"c"}
+
+		if !reflect.DeepEqual(patched, expected) {
+			t.Fatalf("Incorrect Merge Patch Result: %+v", patched)
+		}
+
+		if _, err = patch(MediaTypeMergePatch, `["not", "an", "object"]`); !errors.Is(err, ErrInvalidPatch) {
+			t.Fatalf("Merge Patch Replacing the Metadata was Accepted: %v", err)
+		}
+	})
+
+	t.Run("JSONPatch", func(t *testing.T) {
+
+		patched, err := patch(MediaTypeJSONPatch, `[
+			{"op": "test", "path": "/name", "value": "test"},
+			{"op": "add", "path": "/keywords/-", "value": "c"},
+			{"op": "add", "path": "/keywords/0", "value": "z"},
+			{"op": "remove", "path": "/description"},
+			{"op": "replace", "path": "/author/name", "value": "S. Al Manir"},
+			{"op": "move", "from": "/author/affiliation", "path": "/sourceOrganization"},
+			{"op": "copy", "from": "/keywords", "path": "/about"}
+		]`)
+		if err != nil {
+			t.Fatalf("Failed to Apply JSON Patch: %s", err.Error())
+		}
+
+		expected := original()
+		delete(expected, "description")
+		expected["keywords"] = []interface{}{"z", "a", "b", "c"}
+		expected["about"] = []interface{}{"z", "a", "b", "c"}
+		expected["author"] = map[string]interface{}{"name": "S. Al Manir"}
+		expected["sourceOrganization"] = "UVA"
+
+		if !reflect.DeepEqual(patched, expected) {
+			t.Fatalf("Incorrect JSON Patch Result: %+v", patched)
+		}
+
+		conflicts := []string{
+			`[{"op": "test", "path": "/name", "value": "other"}]`,
+			`[{"op": "remove", "path": "/version"}]`,
+			`[{"op": "replace", "path": "/keywords/2", "value": "c"}]`,
+			`[{"op": "add", "path": "/funder/name", "value": "NIH"}]`,
+		}
+		for _, body := range conflicts {
+			if _, err = patch(MediaTypeJSONPatch, body); !errors.Is(err, ErrPatchConflict) {
+				t.Fatalf("Conflicting Patch was Applied %s: %v", body, err)
+			}
+		}
+
+		invalid := []string{
+			`{"op": "add", "path": "/name", "value": "x"}`,
+			`[{"op": "add", "path": "/name"}]`,
+			`[{"op": "add", "path": "name", "value": "x"}]`,
+			`[{"op": "rename", "path": "/name", "value": "x"}]`,
+			`[{"op": "move", "from": "/author", "path": "/author/name"}]`,
+			`[{"op": "remove", "path": ""}]`,
+		}
+		for _, body := range invalid {
+			if _, err = patch(MediaTypeJSONPatch, body); !errors.Is(err, ErrInvalidPatch) {
+				t.Fatalf("Invalid Patch was Applied %s: %v", body, err)
+			}
+		}
+
+		// a failed operation leaves the metadata untouched
+		doc := original()
+		edit, _ := parsePatch([]byte(`[{"op": "remove", "path": "/name"}, {"op": "test", "path": "/name", "value": "test"}]`), MediaTypeJSONPatch)
+		if _, err = edit(doc); !errors.Is(err, ErrPatchConflict) || doc["name"] != "test" {
+			t.Fatalf("Failed Patch Changed the Metadata: %v %+v", err, doc)
+		}
+
+		if _, err = parsePatch([]byte(`{}`), "application/json"); !errors.Is(err, ErrUnsupportedPatch) {
+			t.Fatalf("Unknown Patch Media Type was Accepted: %v", err)
+		}
+	})
+
+	t.Run("Diff", func(t *testing.T) {
+
+		updated := original()
+		delete(updated, "description")
+		updated["keywords"] = []interface{}{"a", "b", "c"}
+		updated["author"] = map[string]interface{}{"name": "M. Levinson", "affiliation": "UVA", "email": "m@example.org"}
+		updated["version"] = "2"
+
+		update, ok := diffUpdate(original(), updated)
+		if !ok {
+			t.Fatalf("Update Should be Expressed as Operators")
+		}
+
+		expected := bson.D{
+			{"$set", bson.D{{"author.email", "m@example.org"}, {"version", "2"}}},
+			{"$unset", bson.D{{"description", ""}}},
+			{"$push", bson.D{{"keywords", bson.D{{"$each", []interface{}{"c"}}}}}},
+			{"$currentDate", bson.D{{"_modified", true}}},
+			{"$inc", bson.D{{"_rev", 1}}},
+		}
+		if !reflect.DeepEqual(update, expected) {
+			t.Fatalf("Incorrect Update Operators:\n%+v\nexpected\n%+v", update, expected)
+		}
+
+		// removing items from an array replaces it, as does a nested key that can't be a path
+		updated = original()
+		updated["keywords"] = []interface{}{"b"}
+		updated["author"] = map[string]interface{}{"name": "M. Levinson", "affiliation": "UVA", "http://schema.org/email": "m@example.org"}
+
+		update, _ = diffUpdate(original(), updated)
+		expected = bson.D{
+			{"$set", bson.D{{"author", updated["author"]}, {"keywords", []interface{}{"b"}}}},
+			{"$currentDate", bson.D{{"_modified", true}}},
+			{"$inc", bson.D{{"_rev", 1}}},
+		}
+		if !reflect.DeepEqual(update, expected) {
+			t.Fatalf("Incorrect Update Operators:\n%+v\nexpected\n%+v", update, expected)
+		}
+
+		// unchanged keys that can't be a path don't matter, changed ones at the top level need a replacement
+		doc := original()
+		doc["http://schema.org/version"] = "1"
+		updated = original()
+		updated["http://schema.org/version"] = "1"
+		updated["name"] = "renamed"
+
+		if _, ok = diffUpdate(doc, updated); !ok {
+			t.Fatalf("Unchanged Key Prevented an Update")
+		}
+
+		updated["http://schema.org/version"] = "2"
+		if _, ok = diffUpdate(doc, updated); ok {
+			t.Fatalf("Changed Top Level Key that can't be a Path was Expressed as Operators")
+		}
+	})
+
+}
+
+func TestManagedFields(t *testing.T) {
+
+	t.Run("Create", func(t *testing.T) {
+
+		payload := []byte(`{"name": "test", "@id": "ark:99999/other", "namespace": "ark:11111", "sdPublisher": {"name": "someone else"}, "dateModified": "2001-01-01", "modifiedBy": {"name": "someone else"}}`)
+
+		metadata, err := processMetadataWrite(payload, "ark:99999/test", User{}, "")
+		if err != nil {
+			t.Fatalf("Failed to Process Metadata: %s", err.Error())
+		}
+
+		record := make(map[string]interface{})
+		json.Unmarshal(metadata, &record)
+
+		if record["@id"] != "ark:99999/test" || record["namespace"] != "ark:99999" || record["name"] != "test" {
+			t.Fatalf("Managed Properties were not Set: %s", metadata)
+		}
+
+		for _, field := range []string{"sdPublisher", "dateModified", "modifiedBy"} {
+			if _, ok := record[field]; ok {
+				t.Fatalf("Caller Set Managed Property %s: %s", field, metadata)
+			}
+		}
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+
+		original := map[string]interface{}{
+			"_id":               "ark:99999/test",
+			"@id":               "ark:99999/test",
+			"namespace":         "ark:99999",
+			"name":              "test",
+			"sdPublicationDate": "2020-06-01T00:00:00Z",
+			"modifiedBy":        map[string]interface{}{"name": "M. Levinson"},
+		}
+		edited := map[string]interface{}{
+			"@id":               "ark:99999/other",
+			"name":              "renamed",
+			"url":               "https://example.org",
+			"sdPublicationDate": "2001-01-01",
+		}
+
+		updated := protectFields(original, edited, User{ID: "https://orcid.org/0000-0000-0000-0000", Name: "S. Al Manir"})
+
+		if updated["@id"] != "ark:99999/test" || updated["_id"] != "ark:99999/test" || updated["sdPublicationDate"] != "2020-06-01T00:00:00Z" {
+			t.Fatalf("Managed Properties were Overwritten: %+v", updated)
+		}
+
+		if _, ok := updated["url"]; ok || updated["name"] != "renamed" {
+			t.Fatalf("Incorrect Edited Metadata: %+v", updated)
+		}
+
+		if _, ok := updated["dateModified"].(string); !ok {
+			t.Fatalf("dateModified was not Set: %+v", updated)
+		}
+
+		modifier := map[string]interface{}{"@id": "https://orcid.org/0000-0000-0000-0000", "name": "S. Al Manir"}
+		if !reflect.DeepEqual(updated["modifiedBy"], modifier) {
+			t.Fatalf("Incorrect modifiedBy: %+v", updated["modifiedBy"])
+		}
+
+		if updated = protectFields(original, edited, User{}); updated["modifiedBy"] != nil {
+			t.Fatalf("Unknown Modifier Kept the Previous modifiedBy: %+v", updated["modifiedBy"])
+		}
+	})
+
+}
@@ -0,0 +1,233 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrNotPermitted = errors.New("User is not Permitted to Preform this Action")
+
+// Defaults for the url of identifiers when neither the backend nor the namespace policy configure one
+const (
+	DefaultBaseURL     = "http://ors.uvadcos.io/"
+	DefaultURLTemplate = "{base}{ark}"
+)
+
+// NamespacePolicy is read from the policy property of a namespace record,
+// and is enforced whenever an identifier in the namespace is created or updated
+//
+//	"policy": {
+//		"requiredProperties": ["name", "author"],
+//		"allowedTypes": ["Dataset", "Software"],
+//		"defaults": {"license": "https://creativecommons.org/licenses/by/4.0/"},
+//		"minters": ["https://orcid.org/0000-0002-1825-0097", "clarklab"],
+//		"urlTemplate": "https://example.org/landing/{prefix}/{suffix}",
+//		"cacheControl": "public, max-age=3600"
+//	}
+type NamespacePolicy struct {
+	// RequiredProperties must be present and non empty on every identifier
+	RequiredProperties []string `json:"requiredProperties,omitempty"`
+	// AllowedTypes restricts the @type of identifiers, any type is allowed when empty
+	AllowedTypes []string `json:"allowedTypes,omitempty"`
+	// Defaults are merged into new identifiers that don't set the property themselves
+	Defaults map[string]interface{} `json:"defaults,omitempty"`
+	// Minters are the user @ids and groups allowed to create identifiers, anyone may mint when empty
+	Minters []string `json:"minters,omitempty"`
+	// URLTemplate builds the url of an identifier, replacing {base}, {ark}, {prefix} and {suffix}
+	URLTemplate string `json:"urlTemplate,omitempty"`
+	// CacheControl is sent with resolved identifiers, DefaultCacheControl when empty
+	CacheControl string `json:"cacheControl,omitempty"`
+	// ExpiryAction is what happens to identifiers once their expires passes, one of the Expiry constants, the
+	// backend's when empty
+	ExpiryAction string `json:"expiryAction,omitempty"`
+	// ReferenceCheck is how references to identifiers of this service that don't exist are handled, one of the
+	// Reference constants, the backend's when empty
+	ReferenceCheck string `json:"referenceCheck,omitempty"`
+}
+
+// parseNamespacePolicy reads the policy from a namespace record, a namespace without a policy has the zero policy
+func parseNamespacePolicy(namespace []byte) (policy NamespacePolicy, err error) {
+
+	var ns struct {
+		Policy *NamespacePolicy `json:"policy"`
+	}
+
+	err = json.Unmarshal(namespace, &ns)
+	if err != nil {
+		return policy, fmt.Errorf("%w: namespace policy is malformed: %s", ErrInvalidMetadata, err.Error())
+	}
+
+	if ns.Policy != nil {
+		policy = *ns.Policy
+	}
+
+	if strings.ContainsAny(policy.CacheControl, "\r\n") {
+		return policy, fmt.Errorf("%w: cacheControl must be a single line", ErrInvalidMetadata)
+	}
+
+	if policy.ExpiryAction != "" && !validExpiryAction(policy.ExpiryAction) {
+		return policy, fmt.Errorf("%w: %s", ErrInvalidMetadata, ErrExpiryAction.Error())
+	}
+
+	if policy.ReferenceCheck != "" && !validReferenceCheck(policy.ReferenceCheck) {
+		return policy, fmt.Errorf("%w: %s", ErrInvalidMetadata, ErrReferenceCheck.Error())
+	}
+
+	return
+}
+
+// MayMint reports whether the user may create identifiers in the namespace
+func (p NamespacePolicy) MayMint(u User) bool {
+
+	if len(p.Minters) == 0 || u.Role == "admin" {
+		return true
+	}
+
+	for _, minter := range p.Minters {
+		if u.ID != "" && minter == u.ID {
+			return true
+		}
+
+		for _, group := range u.Groups {
+			if minter == group {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// expandURLTemplate builds the url of the identifier guid, replacing {base} with the base url
+// and {ark}, {prefix} and {suffix} with the full ARK, its NAAN and its name
+func expandURLTemplate(template string, base string, guid string) string {
+
+	prefix, suffix := guid, ""
+	if i := strings.Index(guid, "/"); i >= 0 {
+		prefix, suffix = guid[:i], guid[i+1:]
+	}
+
+	return strings.NewReplacer(
+		"{base}", base,
+		"{ark}", guid,
+		"{prefix}", strings.TrimPrefix(prefix, "ark:"),
+		"{suffix}", suffix,
+	).Replace(template)
+}
+
+// ApplyDefaults sets every default property that is missing from metadata
+func (p NamespacePolicy) ApplyDefaults(metadata map[string]interface{}) {
+
+	for prop, value := range p.Defaults {
+		if _, ok := metadata[prop]; !ok {
+			metadata[prop] = value
+		}
+	}
+}
+
+// Validate checks metadata against the required properties and allowed types of the namespace
+func (p NamespacePolicy) Validate(metadata map[string]interface{}) error {
+
+	var missing []string
+	for _, prop := range p.RequiredProperties {
+		if isEmptyValue(metadata[prop]) {
+			missing = append(missing, prop)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing required properties %s", ErrInvalidMetadata, strings.Join(missing, ", "))
+	}
+
+	if len(p.AllowedTypes) == 0 {
+		return nil
+	}
+
+	types := metadataTypes(metadata["@type"])
+	if len(types) == 0 {
+		return fmt.Errorf("%w: @type must be one of %s", ErrInvalidMetadata, strings.Join(p.AllowedTypes, ", "))
+	}
+
+	for _, t := range types {
+		if !containsString(p.AllowedTypes, t) {
+			return fmt.Errorf("%w: @type %s is not allowed, must be one of %s", ErrInvalidMetadata, t, strings.Join(p.AllowedTypes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// metadataTypes returns the values of @type, which may be a single type or a list
+func metadataTypes(value interface{}) (types []string) {
+
+	switch v := value.(type) {
+	case string:
+		types = append(types, v)
+	case []interface{}:
+		for _, t := range v {
+			if s, ok := t.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+
+	return
+}
+
+func isEmptyValue(value interface{}) bool {
+
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+
+	return false
+}
+
+func containsString(list []string, s string) bool {
+
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeUpdate applies an update to a copy of the original record the same way a $set of the update's
+// dot notation paths does, nested objects are merged and every other value is replaced
+func mergeUpdate(original map[string]interface{}, update map[string]interface{}) map[string]interface{} {
+
+	merged := make(map[string]interface{}, len(original))
+	for k, v := range original {
+		merged[k] = v
+	}
+
+	for k, v := range update {
+		updateMap, updateIsMap := v.(map[string]interface{})
+		originalMap, originalIsMap := merged[k].(map[string]interface{})
+
+		if updateIsMap && originalIsMap {
+			merged[k] = mergeUpdate(originalMap, updateMap)
+		} else {
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
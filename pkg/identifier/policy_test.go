@@ -0,0 +1,128 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+
+	namespace := []byte(`{
+		"@id": "ark:99999",
+		"name": "software namespace",
+		"policy": {
+			"requiredProperties": ["name", "author"],
+			"allowedTypes": ["SoftwareSourceCode", "SoftwareApplication"],
+			"defaults": {"license": "MIT"},
+			"minters": ["https://orcid.org/0000-0002-1825-0097", "clarklab"],
+			"urlTemplate": "https://example.org/{prefix}/{suffix}"
+		}
+	}`)
+
+	policy, err := parseNamespacePolicy(namespace)
+	if err != nil {
+		t.Fatalf("Failed to Parse Namespace Policy: %s", err.Error())
+	}
+
+	t.Run("Minters", func(t *testing.T) {
+
+		if !policy.MayMint(User{ID: "https://orcid.org/0000-0002-1825-0097"}) {
+			t.Fatal("Listed User was not Allowed to Mint")
+		}
+
+		if !policy.MayMint(User{ID: "someone", Groups: []string{"clarklab"}}) {
+			t.Fatal("Member of Listed Group was not Allowed to Mint")
+		}
+
+		if !policy.MayMint(User{Role: "admin"}) {
+			t.Fatal("Admin was not Allowed to Mint")
+		}
+
+		if policy.MayMint(User{}) {
+			t.Fatal("Anonymous User was Allowed to Mint")
+		}
+
+		if !(NamespacePolicy{}).MayMint(User{}) {
+			t.Fatal("Namespace without Minters should Allow Anyone")
+		}
+	})
+
+	t.Run("URL", func(t *testing.T) {
+
+		b := Backend{BaseURL: "https://clarklab.uvarc.io/mds"}
+
+		if url := b.identifierURL(policy, "ark:99999/test"); url != "https://example.org/99999/test" {
+			t.Fatalf("Incorrect URL from Namespace Template: %s", url)
+		}
+
+		if url := b.identifierURL(NamespacePolicy{}, "ark:99999/test"); url != "https://clarklab.uvarc.io/mds/ark:99999/test" {
+			t.Fatalf("Incorrect URL from Base: %s", url)
+		}
+
+		b.URLTemplate = "{base}landing/{suffix}"
+		if url := b.identifierURL(NamespacePolicy{}, "ark:99999/test"); url != "https://clarklab.uvarc.io/mds/landing/test" {
+			t.Fatalf("Incorrect URL from Backend Template: %s", url)
+		}
+
+		if url := (&Backend{}).identifierURL(NamespacePolicy{}, "ark:99999/test"); url != "http://ors.uvadcos.io/ark:99999/test" {
+			t.Fatalf("Incorrect Default URL: %s", url)
+		}
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+
+		metadata := map[string]interface{}{"name": "mds", "author": "Max Levinson", "@type": "SoftwareSourceCode"}
+		policy.ApplyDefaults(metadata)
+
+		if metadata["license"] != "MIT" {
+			t.Fatalf("Default was not Applied: %+v", metadata)
+		}
+
+		if err := policy.Validate(metadata); err != nil {
+			t.Fatalf("Valid Metadata was Rejected: %s", err.Error())
+		}
+
+		missing := map[string]interface{}{"name": "", "@type": "SoftwareSourceCode"}
+		if err := policy.Validate(missing); !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("Missing Required Properties were Accepted: %v", err)
+		}
+
+		wrongType := map[string]interface{}{"name": "data", "author": "Max Levinson", "@type": []interface{}{"SoftwareSourceCode", "Dataset"}}
+		if err := policy.Validate(wrongType); !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("Disallowed @type was Accepted: %v", err)
+		}
+	})
+
+	t.Run("MergeUpdate", func(t *testing.T) {
+
+		original := map[string]interface{}{
+			"name":   "mds",
+			"author": map[string]interface{}{"name": "Max Levinson", "email": "max@example.org"},
+		}
+
+		merged := mergeUpdate(original, map[string]interface{}{"author": map[string]interface{}{"name": "M. Levinson"}})
+
+		author := merged["author"].(map[string]interface{})
+		if author["name"] != "M. Levinson" || author["email"] != "max@example.org" {
+			t.Fatalf("Nested Update was not Merged: %+v", merged)
+		}
+
+		if original["author"].(map[string]interface{})["name"] != "Max Levinson" {
+			t.Fatalf("Original Record was Modified: %+v", original)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		_, err := parseNamespacePolicy([]byte(`{"policy": {"allowedTypes": "Dataset"}}`))
+		if !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("Malformed Policy was Accepted: %v", err)
+		}
+	})
+
+}
@@ -0,0 +1,191 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/ClarkLabUVA/mds/pkg/jsonld"
+	"github.com/ClarkLabUVA/mds/pkg/rdf"
+)
+
+// requestMetadata returns the JSON-LD metadata in a request body for guid. Bodies in an RDF serialization are
+// converted, anything else is taken to be JSON-LD and returned as is.
+func requestMetadata(contentType string, body []byte, guid string) ([]byte, error) {
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return body, nil
+	}
+
+	var (
+		quads    []rdf.Quad
+		prefixes map[string]string
+	)
+
+	// relative IRIs, such as <>, are resolved against the identifier
+	switch mediaType {
+	case rdf.MediaTypeTurtle, "application/x-turtle", rdf.MediaTypeNTriples:
+		quads, prefixes, err = rdf.ParseTurtle(bytes.NewReader(body), guid)
+	case rdf.MediaTypeRDFXML:
+		quads, prefixes, err = rdf.ParseRDFXML(bytes.NewReader(body), guid)
+	default:
+		return body, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMetadata, err.Error())
+	}
+
+	return metadataFromRDF(quads, prefixes, guid)
+}
+
+// metadataFromRDF converts statements about guid to a JSON-LD document compacted with the default vocabulary and
+// the given prefixes. Nodes the identifier refers to are nested in it. When nothing is said about guid the
+// statements must be about a single blank node, which is taken to be the identifier, so minted identifiers can be
+// described before their ARK is known.
+func metadataFromRDF(quads []rdf.Quad, prefixes map[string]string, guid string) ([]byte, error) {
+
+	if len(quads) == 0 {
+		return nil, fmt.Errorf("%w: no statements about %s", ErrInvalidMetadata, guid)
+	}
+
+	target := rdf.NewIRI(guid)
+	described := false
+	referenced := map[rdf.Term]bool{}
+
+	for _, q := range quads {
+		if !q.Graph.IsZero() {
+			return nil, fmt.Errorf("%w: named graphs are not supported", ErrInvalidMetadata)
+		}
+		if q.Subject == target {
+			described = true
+		}
+		referenced[q.Object] = true
+	}
+
+	if !described {
+		var roots []rdf.Term
+		for _, s := range rdf.Subjects(quads) {
+			if !referenced[s] {
+				roots = append(roots, s)
+			}
+		}
+
+		if len(roots) != 1 || roots[0].Kind != rdf.BlankNode {
+			return nil, fmt.Errorf("%w: statements must be about %s", ErrInvalidMetadata, guid)
+		}
+
+		renamed := make([]rdf.Quad, len(quads))
+		for i, q := range quads {
+			if q.Subject == roots[0] {
+				q.Subject = target
+			}
+			if q.Object == roots[0] {
+				q.Object = target
+			}
+			renamed[i] = q
+		}
+		quads = renamed
+	}
+
+	nodes := map[string]map[string]interface{}{}
+	for _, n := range jsonld.FromRDF(quads, true) {
+		node := n.(map[string]interface{})
+		nodes[node["@id"].(string)] = node
+	}
+
+	// count references so blank nodes referred to only once can drop their @id once nested
+	references := map[string]int{}
+	for _, node := range nodes {
+		countReferences(node, references)
+	}
+
+	embedded := map[string]bool{guid: true}
+	root := embedNodes(nodes[guid], nodes, references, embedded)
+
+	for id := range nodes {
+		if !embedded[id] {
+			return nil, fmt.Errorf("%w: statements about %s are not connected to %s", ErrInvalidMetadata, id, guid)
+		}
+	}
+
+	context := map[string]interface{}{"@vocab": DefaultVocab}
+	for name, ns := range prefixes {
+		if name == "" || ns == "" || jsonld.IsKeyword(name) || !strings.ContainsAny(ns[len(ns)-1:], "/#") || ns == DefaultVocab {
+			continue
+		}
+		context[name] = ns
+	}
+
+	compacted, err := jsonld.Compact([]interface{}{root}, context, &jsonld.Options{Loader: contextLoader})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMetadata, err.Error())
+	}
+
+	return json.Marshal(compacted)
+}
+
+func countReferences(value interface{}, references map[string]int) {
+
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			countReferences(item, references)
+		}
+	case map[string]interface{}:
+		if id, ok := v["@id"].(string); ok && len(v) == 1 {
+			references[id]++
+			return
+		}
+		for key, item := range v {
+			if key != "@id" {
+				countReferences(item, references)
+			}
+		}
+	}
+}
+
+// embedNodes replaces the first reference to each node in value with the node itself, later references are kept
+func embedNodes(value interface{}, nodes map[string]map[string]interface{}, references map[string]int, embedded map[string]bool) interface{} {
+
+	switch v := value.(type) {
+
+	case []interface{}:
+		for i, item := range v {
+			v[i] = embedNodes(item, nodes, references, embedded)
+		}
+		return v
+
+	case map[string]interface{}:
+		if id, ok := v["@id"].(string); ok && len(v) == 1 {
+			node, described := nodes[id]
+			if !described || embedded[id] {
+				return v
+			}
+
+			embedded[id] = true
+			if strings.HasPrefix(id, "_:") && references[id] == 1 {
+				delete(node, "@id")
+			}
+			return embedNodes(node, nodes, references, embedded)
+		}
+
+		for key, item := range v {
+			if key != "@id" && key != "@type" {
+				v[key] = embedNodes(item, nodes, references, embedded)
+			}
+		}
+		return v
+	}
+
+	return value
+}
@@ -0,0 +1,124 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRDFInput(t *testing.T) {
+
+	guid := "ark:99999/test"
+
+	convert := func(t *testing.T, contentType string, body string) map[string]interface{} {
+
+		metadata, err := requestMetadata(contentType, []byte(body), guid)
+		if err != nil {
+			t.Fatalf("Failed to Convert %s: %s", contentType, err.Error())
+		}
+
+		doc := make(map[string]interface{})
+		if err = json.Unmarshal(metadata, &doc); err != nil {
+			t.Fatalf("Converted Metadata is not JSON: %s", metadata)
+		}
+
+		// the converted document must be accepted by the normal write path
+		if _, err = processMetadataWrite(metadata, guid, User{}, ""); err != nil {
+			t.Fatalf("Converted Metadata was Rejected: %s\n%s", err.Error(), metadata)
+		}
+
+		return doc
+	}
+
+	t.Run("Turtle", func(t *testing.T) {
+
+		doc := convert(t, "text/turtle; charset=utf-8", `
+@prefix schema: <http://schema.org/> .
+@prefix prov: <http://www.w3.org/ns/prov#> .
+
+<> a schema:Dataset ;
+    schema:name "test" ;
+    schema:contentSize 10 ;
+    schema:author [ a schema:Person ; schema:name "Max" ] ;
+    prov:wasGeneratedBy <ark:99999/computation> .
+`)
+
+		expected := map[string]interface{}{
+			"@context":            map[string]interface{}{"@vocab": DefaultVocab, "prov": "http://www.w3.org/ns/prov#"},
+			"@id":                 guid,
+			"@type":               "Dataset",
+			"name":                "test",
+			"contentSize":         float64(10),
+			"author":              map[string]interface{}{"@type": "Person", "name": "Max"},
+			"prov:wasGeneratedBy": map[string]interface{}{"@id": "ark:99999/computation"},
+		}
+
+		if !reflect.DeepEqual(doc, expected) {
+			t.Fatalf("Incorrect Conversion\ngot:      %v\nexpected: %v", doc, expected)
+		}
+	})
+
+	t.Run("BlankSubject", func(t *testing.T) {
+
+		doc := convert(t, "application/n-triples", `_:a <http://schema.org/name> "minted" .
+_:a <http://schema.org/keywords> _:list .
+_:list <http://www.w3.org/1999/02/22-rdf-syntax-ns#first> "a" .
+_:list <http://www.w3.org/1999/02/22-rdf-syntax-ns#rest> <http://www.w3.org/1999/02/22-rdf-syntax-ns#nil> .
+`)
+
+		if doc["@id"] != guid || doc["name"] != "minted" {
+			t.Fatalf("Blank Node was not Taken as the Identifier: %v", doc)
+		}
+
+		if !reflect.DeepEqual(doc["keywords"], map[string]interface{}{"@list": []interface{}{"a"}}) {
+			t.Fatalf("List was not Converted: %v", doc["keywords"])
+		}
+	})
+
+	t.Run("RDFXML", func(t *testing.T) {
+
+		doc := convert(t, "application/rdf+xml", `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:schema="http://schema.org/">
+  <schema:Dataset rdf:about="">
+    <schema:name>xml</schema:name>
+  </schema:Dataset>
+</rdf:RDF>`)
+
+		if doc["@id"] != guid || doc["@type"] != "Dataset" || doc["name"] != "xml" {
+			t.Fatalf("Incorrect Conversion: %v", doc)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+
+		body := []byte(`{"name": "json"}`)
+		for _, contentType := range []string{"", "application/json", "application/ld+json"} {
+			if metadata, err := requestMetadata(contentType, body, guid); err != nil || string(metadata) != string(body) {
+				t.Fatalf("JSON Body was Converted for %q: %s %v", contentType, metadata, err)
+			}
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+
+		bodies := map[string]string{
+			"syntax":      `<> <http://schema.org/name> "unterminated .`,
+			"other":       `<http://example.org/x> <http://schema.org/name> "x" .`,
+			"unconnected": `<> <http://schema.org/name> "x" . <http://example.org/x> <http://schema.org/name> "y" .`,
+			"ambiguous":   `_:a <http://schema.org/name> "a" . _:b <http://schema.org/name> "b" .`,
+			"empty":       ``,
+		}
+
+		for name, body := range bodies {
+			if _, err := requestMetadata("text/turtle", []byte(body), guid); !errors.Is(err, ErrInvalidMetadata) {
+				t.Fatalf("Invalid Turtle (%s) was Accepted: %v", name, err)
+			}
+		}
+	})
+}
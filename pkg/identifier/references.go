@@ -0,0 +1,528 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buger/jsonparser"
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// ReferenceIgnore writes metadata without checking the identifiers it refers to, the default
+	ReferenceIgnore = "ignore"
+	// ReferenceWarn writes metadata that refers to identifiers that don't exist, with a Warning header
+	ReferenceWarn = "warn"
+	// ReferenceReject refuses metadata that newly refers to identifiers that don't exist
+	ReferenceReject = "reject"
+	// ReferenceStub creates a stub for each identifier that doesn't exist when metadata newly refers to it
+	ReferenceStub = "stub"
+)
+
+// StatusStub is the creativeWorkStatus of an identifier created because another one referred to it. A stub is a
+// reservation that doesn't expire, the user whose metadata referred to it fills it in.
+const StatusStub = "Stub"
+
+var (
+	ErrDanglingReference = errors.New("Referenced Identifier does not Exist")
+	ErrReferenced        = errors.New("Identifier is Referenced")
+	ErrReferenceCheck    = errors.New("Reference Check must be ignore, warn, reject or stub")
+)
+
+func validReferenceCheck(check string) bool {
+	return check == ReferenceIgnore || check == ReferenceWarn || check == ReferenceReject || check == ReferenceStub
+}
+
+// localARK reads a property value as the ARK of an identifier, written as an ARK or as a resolver URL ending in
+// one. Text that merely mentions an ARK, and namespaces, are not identifiers.
+func localARK(value string) (id string, ok bool) {
+
+	if strings.ContainsAny(value, " \t\r\n") {
+		return "", false
+	}
+
+	if !strings.HasPrefix(value, "ark:") && !(strings.HasPrefix(value, "http") && strings.Contains(value, "/ark:")) {
+		return "", false
+	}
+
+	id = normalizeArk(value)
+
+	return id, !isNamespace(id)
+}
+
+// metadataReferences lists the identifiers metadata refers to, each with the property that refers to it, sorted
+// so that unchanged references compare equal. References in nested nodes belong to the property of the node.
+// Properties the service maintains, and the identifier itself, are left out.
+func metadataReferences(guid string, metadata map[string]interface{}) []interface{} {
+
+	type reference struct{ predicate, id string }
+
+	seen := make(map[reference]bool)
+
+	var walk func(predicate string, value interface{})
+	walk = func(predicate string, value interface{}) {
+		switch v := value.(type) {
+		case string:
+			if id, ok := localARK(v); ok && id != guid {
+				seen[reference{predicate, id}] = true
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(predicate, item)
+			}
+		case map[string]interface{}:
+			for key, nested := range v {
+				switch {
+				case key == "@id":
+					walk(predicate, nested)
+				case !strings.HasPrefix(key, "@"):
+					walk(key, nested)
+				}
+			}
+		}
+	}
+
+	for key, value := range metadata {
+		if strings.HasPrefix(key, "@") || containsString(internalFields, key) || containsString(managedFields, key) {
+			continue
+		}
+		walk(key, value)
+	}
+
+	refs := make([]reference, 0, len(seen))
+	for ref := range seen {
+		refs = append(refs, ref)
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].id != refs[j].id {
+			return refs[i].id < refs[j].id
+		}
+		return refs[i].predicate < refs[j].predicate
+	})
+
+	references := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		references[i] = map[string]interface{}{"predicate": ref.predicate, "id": ref.id}
+	}
+
+	return references
+}
+
+// maintainedPredicates are the properties whose references the service writes itself, which are never checked
+func maintainedPredicates() []string {
+
+	predicates := make([]string, len(membershipLinks))
+	for i, link := range membershipLinks {
+		predicates[i] = link.inverse
+	}
+
+	return predicates
+}
+
+// addedTargets lists the identifiers updated refers to that original doesn't, by properties that aren't maintained
+func addedTargets(original []interface{}, updated []interface{}) []string {
+
+	maintained := maintainedPredicates()
+
+	var existing []string
+	for _, ref := range original {
+		existing = append(existing, ref.(map[string]interface{})["id"].(string))
+	}
+
+	var added []string
+	for _, ref := range updated {
+		r := ref.(map[string]interface{})
+		id := r["id"].(string)
+		if !containsString(maintained, r["predicate"].(string)) && !containsString(existing, id) && !containsString(added, id) {
+			added = append(added, id)
+		}
+	}
+
+	return added
+}
+
+// referenceCheck returns how references to identifiers that don't exist are handled in a namespace, as its policy or
+// else the backend sets
+func (b *Backend) referenceCheck(namespace string) (string, error) {
+
+	record, err := b.Mongo.FindOne(bson.D{{"_id", namespace}}, "policy")
+	if err != nil && err != mongo.ErrNoDocuments {
+		return "", err
+	}
+
+	if err == nil {
+		policy, err := parseNamespacePolicy(record)
+		if err != nil {
+			return "", err
+		}
+		if policy.ReferenceCheck != "" {
+			return policy.ReferenceCheck, nil
+		}
+	}
+
+	if b.ReferenceCheck == "" {
+		return ReferenceIgnore, nil
+	}
+	if !validReferenceCheck(b.ReferenceCheck) {
+		return "", ErrReferenceCheck
+	}
+
+	return b.ReferenceCheck, nil
+}
+
+// missingTargets returns the targets that don't exist, of those in a namespace of this service. Identifiers in
+// namespaces held elsewhere can't be checked.
+func (b *Backend) missingTargets(targets []string) (missing []string, err error) {
+
+	if len(targets) == 0 {
+		return
+	}
+
+	lookup := append([]string(nil), targets...)
+	for _, target := range targets {
+		if namespace := strings.Split(target, "/")[0]; !containsString(lookup, namespace) {
+			lookup = append(lookup, namespace)
+		}
+	}
+
+	found := make(map[string]bool)
+	err = b.Mongo.Iterate(context.Background(), bson.D{{"_id", bson.D{{"$in", lookup}}}}, func(record []byte) error {
+		id, getErr := jsonparser.GetString(record, "_id")
+		found[id] = true
+		return getErr
+	})
+	if err != nil {
+		return
+	}
+
+	for _, target := range targets {
+		if found[strings.Split(target, "/")[0]] && !found[target] {
+			missing = append(missing, target)
+		}
+	}
+
+	return
+}
+
+// checkReferences lists the references of the updated metadata of guid, to be stored with it, and applies the
+// reference check of its namespace to the identifiers original didn't refer to yet. original is nil for a new
+// identifier. References that don't exist reject the write, or, when they are to be created as stubs, reject it
+// unless author may mint them. The stubs are left to createStubs and warnings to referenceWarning, once the write
+// succeeded.
+func (b *Backend) checkReferences(guid string, original map[string]interface{}, updated map[string]interface{}, author User) (references []interface{}, err error) {
+
+	references = metadataReferences(guid, updated)
+
+	check, err := b.referenceCheck(strings.Split(guid, "/")[0])
+	if err != nil || (check != ReferenceReject && check != ReferenceStub) {
+		return
+	}
+
+	missing, err := b.missingTargets(addedTargets(metadataReferences(guid, original), references))
+	if err != nil || len(missing) == 0 {
+		return
+	}
+
+	if check == ReferenceReject {
+		return nil, fmt.Errorf("%w: %s", ErrDanglingReference, strings.Join(missing, ", "))
+	}
+
+	for _, target := range missing {
+		err = b.mayStub(target, author)
+		if err == ErrNotPermitted {
+			return nil, fmt.Errorf("%w: %s, which author may not create as a stub", ErrDanglingReference, target)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return references, nil
+}
+
+// mayStub checks that author may mint a stub for target in its namespace
+func (b *Backend) mayStub(target string, author User) error {
+
+	namespace, err := b.GetNamespace(strings.Split(target, "/")[0])
+	if err != nil {
+		return err
+	}
+
+	policy, err := parseNamespacePolicy(namespace)
+	if err != nil {
+		return err
+	}
+
+	if !policy.MayMint(author) {
+		return ErrNotPermitted
+	}
+
+	return nil
+}
+
+// createStubs creates a stub for author of each identifier the updated metadata of guid newly refers to that
+// doesn't exist, when the reference check of its namespace is ReferenceStub. It is called once the write of updated
+// is stored, so a write that fails leaves no stubs behind. The stubs were checked with the write, a stub that still
+// can't be created doesn't undo the write, it is logged, and reported by referenceWarning as a missing reference.
+func (b *Backend) createStubs(guid string, original map[string]interface{}, updated map[string]interface{}, author User) {
+
+	check, err := b.referenceCheck(strings.Split(guid, "/")[0])
+	if err != nil || check != ReferenceStub {
+		return
+	}
+
+	missing, err := b.missingTargets(addedTargets(metadataReferences(guid, original), metadataReferences(guid, updated)))
+
+	for _, target := range missing {
+		if _, err = b.insertPlaceholder(target, author, StatusStub, bson.D{{"owner", author.ID}}); err == ErrAlreadyExists {
+			err = nil
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		mongoLogger.Warn().
+			Err(err).
+			Str("operation", "createStubs").
+			Str("identifier", guid).
+			Msg("failed to create stubs for missing references")
+	}
+}
+
+// referenceWarning is the Warning header of a write to guid, when the reference check of its namespace warns and
+// it refers to identifiers that don't exist, and empty otherwise
+func (b *Backend) referenceWarning(guid string) string {
+
+	// with stubs, a reference that is missing after the write is a stub that couldn't be created
+	check, err := b.referenceCheck(strings.Split(guid, "/")[0])
+	if err != nil || (check != ReferenceWarn && check != ReferenceStub) {
+		return ""
+	}
+
+	record, err := b.Mongo.FindOne(bson.D{{"_id", guid}}, "_references")
+	if err != nil {
+		return ""
+	}
+
+	metadata := make(map[string]interface{})
+	if err = json.Unmarshal(record, &metadata); err != nil {
+		return ""
+	}
+
+	references, _ := metadata["_references"].([]interface{})
+	missing, err := b.missingTargets(addedTargets(nil, references))
+	if err != nil || len(missing) == 0 {
+		return ""
+	}
+
+	return `299 - ` + strconv.Quote("Referenced identifiers do not exist: "+strings.Join(missing, ", "))
+}
+
+// checkReferrers returns ErrReferenced when another identifier refers to guid, other than the references the
+// service maintains
+func (b *Backend) checkReferrers(guid string) error {
+
+	referrer, err := b.Mongo.FindOne(bson.D{
+		{"_references", bson.D{{"$elemMatch", bson.D{
+			{"id", guid},
+			{"predicate", bson.D{{"$nin", maintainedPredicates()}}},
+		}}}},
+		{"_id", bson.D{{"$ne", guid}}},
+	}, "_id")
+
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := jsonparser.GetString(referrer, "_id")
+
+	return fmt.Errorf("%w by %s", ErrReferenced, id)
+}
+
+// EnsureReferenceIndex indexes the references stored with identifiers, which are looked up to find the identifiers
+// referring to one
+func (b *Backend) EnsureReferenceIndex() error {
+	return b.Mongo.EnsureReferenceIndex()
+}
+
+// IndexReferences stores the references of the identifiers written before references were recorded, so they are
+// found when checking deletes. It returns how many identifiers were indexed.
+func (b *Backend) IndexReferences(ctx context.Context) (count int, err error) {
+
+	unindexed := bson.D{
+		{"namespace", bson.D{{"$exists", true}}},
+		{"_references", bson.D{{"$exists", false}}},
+	}
+
+	indexed := make(map[string][]interface{})
+	err = b.Mongo.Iterate(ctx, unindexed, func(record []byte) error {
+
+		guid, _ := jsonparser.GetString(record, "_id")
+
+		metadata := make(map[string]interface{})
+		if err := json.Unmarshal(processMetadataRead(record), &metadata); err != nil {
+			return fmt.Errorf("identifier %s: %w", guid, err)
+		}
+
+		indexed[guid] = metadataReferences(guid, metadata)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	for guid, references := range indexed {
+
+		// the references aren't part of the metadata, so recording them doesn't add a revision
+		_, err = b.Mongo.ModifyOne(append(bson.D{{"_id", guid}}, unindexed...), bson.D{
+			{"$set", bson.D{{"_references", references}}},
+		})
+		if err == mongo.ErrNoDocuments {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return count, fmt.Errorf("Failed to index references of %s: %w", guid, err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+const (
+	// ReferenceSourceGraph reports references found by querying stardog
+	ReferenceSourceGraph = "graph"
+	// ReferenceSourceMongo reports references found among those stored with identifiers, when stardog can't be queried
+	ReferenceSourceMongo = "mongo"
+)
+
+// InboundReferences are the identifiers referring to an identifier, grouped by the property that refers to it
+type InboundReferences struct {
+	ID         string              `json:"@id"`
+	References map[string][]string `json:"references"`
+	// Source is where the references were found, ReferenceSourceGraph or ReferenceSourceMongo
+	Source string `json:"source"`
+}
+
+func (in *InboundReferences) add(predicate string, referrer string) {
+	if !containsString(in.References[predicate], referrer) {
+		in.References[predicate] = append(in.References[predicate], referrer)
+	}
+}
+
+// referenceForms lists what an identifier is referred to by: its ARK in either form, its url, and its ARK at the
+// n2t.net resolver, so references written as resolver URLs are found as well
+func referenceForms(guid string, url string) []string {
+
+	forms := []string{guid, strings.Replace(guid, "ark:", "ark:/", 1), "https://n2t.net/" + guid}
+	if url != "" && !containsString(forms, url) {
+		forms = append(forms, url)
+	}
+
+	return forms
+}
+
+// referrersQuery builds a SELECT query for the identifiers with a statement whose object is one of forms, directly
+// or through a blank node such as an author without an @id. The forms are bound by VALUES, as IRIs and as strings,
+// the same values localARK reads references in, so the objects are looked up rather than scanned for.
+func referrersQuery(forms []string) (string, error) {
+
+	var targets, self []string
+	for _, form := range forms {
+		iri, err := sparqlIRI(form)
+		if err != nil {
+			return "", err
+		}
+		// checked as an IRI, the form is also safe to quote as a string
+		targets = append(targets, iri, `"`+form+`"`)
+		if strings.HasPrefix(form, "ark:") {
+			self = append(self, iri)
+		}
+	}
+
+	return "SELECT DISTINCT ?s ?p WHERE { VALUES ?target { " + strings.Join(targets, " ") + " } " +
+		"{ ?s ?p ?target } UNION { ?s ?q ?node . ?node ?p ?target . FILTER(isBlank(?node)) } " +
+		`FILTER(isIRI(?s) && STRSTARTS(STR(?s), "ark:") && ?s NOT IN (` + strings.Join(self, ", ") + ")) }", nil
+}
+
+// ReferencesTo finds the identifiers referring to guid by querying stardog, or among the references stored with
+// identifiers when stardog can't be queried. Properties of the default vocabulary are named by their term.
+func (b *Backend) ReferencesTo(guid string) (inbound InboundReferences, err error) {
+
+	record, err := b.Mongo.FindOne(bson.D{{"_id", guid}}, "_id", "url")
+	if err != nil {
+		return
+	}
+	url, _ := jsonparser.GetString(record, "url")
+
+	inbound = InboundReferences{ID: guid, References: make(map[string][]string), Source: ReferenceSourceGraph}
+
+	bindings, err := b.Stardog.Referrers(referenceForms(guid, url))
+	if err == nil {
+		for _, binding := range bindings {
+			inbound.add(strings.TrimPrefix(binding["p"], DefaultVocab), binding["s"])
+		}
+	} else {
+		stardogLogger.Warn().
+			Err(err).
+			Str("operation", "ReferencesTo").
+			Str("identifier", guid).
+			Msg("failed to query references, reading them from mongo")
+
+		inbound.Source = ReferenceSourceMongo
+		if err = b.storedReferencesTo(guid, &inbound); err != nil {
+			return
+		}
+	}
+
+	for _, referrers := range inbound.References {
+		sort.Strings(referrers)
+	}
+
+	return inbound, nil
+}
+
+// storedReferencesTo adds the identifiers whose stored references include guid, other than embargoed ones, which
+// aren't in the graph either
+func (b *Backend) storedReferencesTo(guid string, inbound *InboundReferences) error {
+
+	now := time.Now()
+
+	return b.Mongo.Iterate(context.Background(), bson.D{{"_references.id", guid}}, func(record []byte) error {
+
+		referrer, _ := jsonparser.GetString(record, "_id")
+		if embargoed, _ := recordEmbargoed(record, now); embargoed || referrer == guid {
+			return nil
+		}
+
+		_, err := jsonparser.ArrayEach(record, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+			if id, _ := jsonparser.GetString(value, "id"); id == guid {
+				predicate, _ := jsonparser.GetString(value, "predicate")
+				inbound.add(predicate, referrer)
+			}
+		}, "_references")
+
+		return err
+	})
+}
@@ -0,0 +1,171 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+
+	t.Run("ARK", func(t *testing.T) {
+
+		for value, expected := range map[string]string{
+			"ark:99999/dataset":                     "ark:99999/dataset",
+			"ark:/99999/dataset":                    "ark:99999/dataset",
+			"https://n2t.net/ark:/99999/dataset":    "ark:99999/dataset",
+			"http://ors.uvadcos.io/ark:99999/a/b/c": "ark:99999/a/b/c",
+		} {
+			if id, ok := localARK(value); !ok || id != expected {
+				t.Fatalf("Incorrect ARK for %s: %s", value, id)
+			}
+		}
+
+		for _, value := range []string{"ark:99999", "see ark:99999/dataset", "https://example.org/dataset", "Dataset"} {
+			if id, ok := localARK(value); ok {
+				t.Fatalf("%s Read as the ARK %s", value, id)
+			}
+		}
+	})
+
+	t.Run("Metadata", func(t *testing.T) {
+
+		metadata := map[string]interface{}{
+			"@id":         "ark:99999/computation",
+			"@context":    map[string]interface{}{"@vocab": "http://schema.org/"},
+			"identifier":  "ark:99999/computation",
+			"usedDataset": []interface{}{"ark:99999/input", map[string]interface{}{"@id": "ark:/99999/other"}},
+			"author": map[string]interface{}{
+				"@id":         "ark:99999/person",
+				"affiliation": map[string]interface{}{"@id": "ark:99999/org"},
+			},
+			"description": "derived from ark:99999/input",
+			"sdPublisher": map[string]interface{}{"@id": "ark:99999/publisher"},
+			"_references": []interface{}{map[string]interface{}{"predicate": "stale", "id": "ark:99999/stale"}},
+		}
+
+		expected := []interface{}{
+			map[string]interface{}{"predicate": "usedDataset", "id": "ark:99999/input"},
+			map[string]interface{}{"predicate": "affiliation", "id": "ark:99999/org"},
+			map[string]interface{}{"predicate": "usedDataset", "id": "ark:99999/other"},
+			map[string]interface{}{"predicate": "author", "id": "ark:99999/person"},
+		}
+
+		if references := metadataReferences("ark:99999/computation", metadata); !reflect.DeepEqual(references, expected) {
+			t.Fatalf("Incorrect References: %v", references)
+		}
+
+		if references := metadataReferences("ark:99999/computation", nil); len(references) != 0 {
+			t.Fatalf("Missing Metadata Has References: %v", references)
+		}
+	})
+
+	t.Run("Write", func(t *testing.T) {
+
+		payload := []byte(`{"name": "test", "_references": [{"predicate": "citation", "id": "ark:99999/forged"}], "_rev": 7}`)
+
+		metadata, err := processMetadataWrite(payload, "ark:99999/test", User{}, "")
+		if err != nil {
+			t.Fatalf("Failed to Process Metadata: %s", err.Error())
+		}
+
+		if strings.Contains(string(metadata), "forged") || strings.Contains(string(metadata), "_rev") {
+			t.Fatalf("Internal Fields Set by the Caller were Kept: %s", metadata)
+		}
+	})
+
+	t.Run("Added", func(t *testing.T) {
+
+		original := []interface{}{
+			map[string]interface{}{"predicate": "usedDataset", "id": "ark:99999/input"},
+		}
+		updated := []interface{}{
+			map[string]interface{}{"predicate": "usedDataset", "id": "ark:99999/input"},
+			map[string]interface{}{"predicate": "identifiers", "id": "ark:99999/member"},
+			map[string]interface{}{"predicate": "usedSoftware", "id": "ark:99999/software"},
+			map[string]interface{}{"predicate": "citation", "id": "ark:99999/software"},
+		}
+
+		if added := addedTargets(original, updated); !reflect.DeepEqual(added, []string{"ark:99999/software"}) {
+			t.Fatalf("Incorrect Added Targets: %v", added)
+		}
+	})
+
+	t.Run("Policy", func(t *testing.T) {
+
+		policy, err := parseNamespacePolicy([]byte(`{"policy": {"referenceCheck": "reject"}}`))
+		if err != nil || policy.ReferenceCheck != ReferenceReject {
+			t.Fatalf("Failed to Parse Reference Check: %v %s", err, policy.ReferenceCheck)
+		}
+
+		if _, err = parseNamespacePolicy([]byte(`{"policy": {"referenceCheck": "delete"}}`)); !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("Invalid Reference Check Accepted: %v", err)
+		}
+	})
+
+	t.Run("Inbound", func(t *testing.T) {
+
+		forms := referenceForms("ark:99999/data", "https://example.org/landing/data")
+		query, err := referrersQuery(forms)
+		if err != nil || !strings.Contains(query, `VALUES ?target { <ark:99999/data> "ark:99999/data" <ark:/99999/data> "ark:/99999/data"`) {
+			t.Fatalf("Incorrect Referrers Query: %s %v", query, err)
+		}
+
+		// resolver URLs are bound as values too, rather than matched by filtering every object
+		if !strings.Contains(query, "<https://n2t.net/ark:99999/data>") || !strings.Contains(query, "<https://example.org/landing/data>") || strings.Contains(query, "STRENDS") {
+			t.Fatalf("Referrers Query doesn't Bind Resolver URLs: %s", query)
+		}
+		for _, value := range forms[:3] {
+			if id, ok := localARK(value); !ok || id != "ark:99999/data" {
+				t.Fatalf("Stored References don't Match %s", value)
+			}
+		}
+
+		if _, err = referrersQuery([]string{"ark:99999/x> } DELETE {"}); !errors.Is(err, ErrInvalidMetadata) {
+			t.Fatalf("IRI was not Escaped: %v", err)
+		}
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Accept") != "application/sparql-results+json" || !strings.Contains(r.FormValue("query"), "SELECT") {
+				w.WriteHeader(400)
+				return
+			}
+			w.Write([]byte(`{"head": {"vars": ["s", "p"]}, "results": {"bindings": [
+				{"s": {"type": "uri", "value": "ark:99999/comp"}, "p": {"type": "uri", "value": "http://schema.org/usedDataset"}},
+				{"s": {"type": "uri", "value": "ark:99999/derived"}, "p": {"type": "uri", "value": "http://www.w3.org/ns/prov#wasDerivedFrom"}}
+			]}}`))
+		}))
+		defer srv.Close()
+
+		stardog := StardogServer{URI: srv.URL, Database: "ors"}
+
+		bindings, err := stardog.Referrers(referenceForms("ark:99999/data", ""))
+		if err != nil {
+			t.Fatalf("Failed to Query Referrers: %s", err.Error())
+		}
+
+		expected := []map[string]string{
+			{"s": "ark:99999/comp", "p": "http://schema.org/usedDataset"},
+			{"s": "ark:99999/derived", "p": "http://www.w3.org/ns/prov#wasDerivedFrom"},
+		}
+		if !reflect.DeepEqual(bindings, expected) {
+			t.Fatalf("Incorrect Bindings: %v", bindings)
+		}
+
+		inbound := InboundReferences{References: make(map[string][]string)}
+		inbound.add("usedDataset", "ark:99999/comp")
+		inbound.add("usedDataset", "ark:99999/comp")
+		if len(inbound.References["usedDataset"]) != 1 {
+			t.Fatalf("Referrer Listed Twice: %v", inbound.References)
+		}
+	})
+}
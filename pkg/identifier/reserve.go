@@ -0,0 +1,268 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/buger/jsonparser"
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// StatusReserved is the creativeWorkStatus of a reserved identifier that has no metadata yet
+	StatusReserved = "Reserved"
+	// StatusReservationExpired is the creativeWorkStatus of a reservation that expired and was flagged
+	StatusReservationExpired = "ReservationExpired"
+)
+
+const (
+	// ReservationRelease deletes reservations once they expire, the default
+	ReservationRelease = "release"
+	// ReservationFlag keeps expired reservations, flagged with StatusReservationExpired, and they can still be filled in
+	ReservationFlag = "flag"
+)
+
+// DefaultReservationTTL is how long reservations last when none is configured, and the longest one may be requested for
+const DefaultReservationTTL = 30 * 24 * time.Hour
+
+var (
+	ErrReserved                 = errors.New("Identifier is Reserved by Another User")
+	ErrInvalidReservationExpiry = errors.New("Invalid Reservation Expiry")
+	ErrReservationExpiryAction  = errors.New("Reservation Expiry must be release or flag")
+)
+
+func (b *Backend) reservationTTL() time.Duration {
+
+	if b.ReservationTTL > 0 {
+		return b.ReservationTTL
+	}
+
+	return DefaultReservationTTL
+}
+
+// ParseReservationExpiry reads the requested expiry of a reservation as an RFC 3339 time, which must be after now and
+// within the reservation TTL. A reservation lasts the TTL when none is requested.
+func (b *Backend) ParseReservationExpiry(requested string, now time.Time) (time.Time, error) {
+
+	latest := now.Add(b.reservationTTL())
+	if requested == "" {
+		return latest, nil
+	}
+
+	expires, err := time.Parse(time.RFC3339, requested)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidReservationExpiry, err.Error())
+	}
+
+	if !expires.After(now) || expires.After(latest) {
+		return time.Time{}, fmt.Errorf("%w: must be after now and no later than %s", ErrInvalidReservationExpiry, latest.Format(time.RFC3339))
+	}
+
+	return expires, nil
+}
+
+// ReserveIdentifier mints guid for author with placeholder metadata until expires. The owner fills the reservation
+// in by creating or updating the identifier, which keeps the ARK. Reservations are not added to stardog.
+func (b *Backend) ReserveIdentifier(guid string, author User, expires time.Time) (response []byte, err error) {
+	return b.insertPlaceholder(guid, author, StatusReserved, bson.D{{"owner", author.ID}, {"expires", expires.UTC()}})
+}
+
+// insertPlaceholder mints guid for author with only the managed properties and a creativeWorkStatus, as a
+// reservation that can be filled in
+func (b *Backend) insertPlaceholder(guid string, author User, status string, reservation bson.D) (response []byte, err error) {
+
+	namespace, err := b.GetNamespace(strings.Split(guid, "/")[0])
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoNamespace
+	}
+	if err != nil {
+		return
+	}
+
+	policy, err := parseNamespacePolicy(namespace)
+	if err != nil {
+		return
+	}
+
+	if !policy.MayMint(author) {
+		return nil, ErrNotPermitted
+	}
+
+	// the placeholder only has the managed properties, it isn't validated against the policy until filled in
+	metadata, err := processMetadataWrite([]byte(`{"creativeWorkStatus": "`+status+`"}`), guid, author, b.identifierURL(policy, guid))
+	if err != nil {
+		return
+	}
+
+	var bsonRecord bson.D
+	if err = bson.UnmarshalExtJSON(metadata, true, &bsonRecord); err != nil {
+		return nil, fmt.Errorf("Failed to Unmarshal JSON to BSON\tError: %s", err.Error())
+	}
+
+	bsonRecord = append(bsonRecord,
+		bson.E{"_modified", time.Now().UTC()},
+		bson.E{"_rev", int64(1)},
+		bson.E{"_reservation", reservation},
+	)
+
+	err = b.Mongo.InsertOne(bsonRecord)
+	b.Cache.Invalidate(guid)
+
+	if err != nil {
+		if isDuplicateKey(err) {
+			err = ErrAlreadyExists
+		}
+		return
+	}
+
+	return processMetadataRead(metadata), nil
+}
+
+// reservationOwner reads who reserved a record, reserved is false for records that aren't reservations
+func reservationOwner(record []byte) (owner string, reserved bool) {
+
+	if _, _, _, err := jsonparser.Get(record, "_reservation"); err != nil {
+		return "", false
+	}
+
+	owner, _ = jsonparser.GetString(record, "_reservation", "owner")
+
+	return owner, true
+}
+
+// mayFill reports whether author may fill in a reservation, anyone may fill in one reserved anonymously
+func mayFill(owner string, author User) bool {
+	return owner == "" || owner == author.ID
+}
+
+// mayFillRecord checks that author may mint a record in place of an existing one, which must be a reservation
+// author may fill in
+func mayFillRecord(existing []byte, author User) error {
+
+	owner, reserved := reservationOwner(existing)
+	if !reserved {
+		return ErrAlreadyExists
+	}
+	if !mayFill(owner, author) {
+		return ErrReserved
+	}
+
+	return nil
+}
+
+// fillReservation replaces the placeholder of a reserved identifier with a record minted for it by its owner.
+// Records that aren't reservations already exist.
+func (b *Backend) fillReservation(guid string, existing []byte, record bson.D, author User) error {
+
+	if err := mayFillRecord(existing, author); err != nil {
+		return err
+	}
+
+	rev := recordRevision(existing)
+	for i := range record {
+		if record[i].Key == "_rev" {
+			record[i].Value = rev + 1
+		}
+	}
+
+	// the reservation may have been filled in or released since it was read
+	err := b.Mongo.ReplaceOne(Revisions{rev}.filter(bson.D{{"_id", guid}}), record)
+	if err == mongo.ErrNoDocuments {
+		return ErrAlreadyExists
+	}
+
+	b.Cache.Invalidate(guid)
+
+	return err
+}
+
+// clearReservation turns the edit of a reservation into a full record, when author owns the reservation
+func clearReservation(original []byte, updated map[string]interface{}, author User) error {
+
+	owner, reserved := reservationOwner(original)
+	if !reserved {
+		return nil
+	}
+	if !mayFill(owner, author) {
+		return ErrReserved
+	}
+
+	delete(updated, "_reservation")
+	if status := updated["creativeWorkStatus"]; status == StatusReserved || status == StatusReservationExpired || status == StatusStub {
+		delete(updated, "creativeWorkStatus")
+	}
+
+	return nil
+}
+
+// ExpireReservations releases or flags, as the ReservationExpiry of the backend selects, the reservations that
+// expired by now and weren't filled in, returning how many were
+func (b *Backend) ExpireReservations(now time.Time) (count int, err error) {
+
+	action := b.ReservationExpiry
+	if action == "" {
+		action = ReservationRelease
+	}
+	if action != ReservationRelease && action != ReservationFlag {
+		return 0, ErrReservationExpiryAction
+	}
+
+	expired := bson.D{
+		{"_reservation.expires", bson.D{{"$lte", now}}},
+		{"_reservation.flagged", bson.D{{"$ne", true}}},
+	}
+
+	// collect the guids before modifying the collection the cursor is reading
+	var guids []string
+	err = b.Mongo.Iterate(context.Background(), expired, func(record []byte) error {
+		id, getErr := jsonparser.GetString(record, "_id")
+		guids = append(guids, id)
+		return getErr
+	})
+	if err != nil {
+		return
+	}
+
+	for _, guid := range guids {
+
+		// a reservation filled in since it was listed no longer matches
+		query := append(bson.D{{"_id", guid}}, expired...)
+
+		if action == ReservationRelease {
+			_, err = b.Mongo.DeleteOne(query)
+		} else {
+			_, err = b.Mongo.ModifyOne(query, bson.D{
+				{"$set", bson.D{{"creativeWorkStatus", StatusReservationExpired}, {"_reservation.flagged", true}}},
+				{"$currentDate", bson.D{{"_modified", true}}},
+				{"$inc", bson.D{{"_rev", 1}}},
+			})
+		}
+
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		b.Cache.Invalidate(guid)
+		count++
+	}
+
+	return count, nil
+}
+
+// ExpireReservationsEvery runs ExpireReservations every interval until ctx is done
+func (b *Backend) ExpireReservationsEvery(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, "ExpireReservations", b.ExpireReservations)
+}
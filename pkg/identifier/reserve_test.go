@@ -0,0 +1,101 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReservation(t *testing.T) {
+
+	owner := User{ID: "https://orcid.org/0000-0000-0000-0000"}
+	reservation := []byte(`{"_id": "ark:99999/test", "creativeWorkStatus": "Reserved", "_reservation": {"owner": "https://orcid.org/0000-0000-0000-0000", "expires": "2020-07-01T00:00:00Z"}}`)
+
+	t.Run("Expiry", func(t *testing.T) {
+
+		b := Backend{ReservationTTL: 24 * time.Hour}
+		now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+		if expires, err := b.ParseReservationExpiry("", now); err != nil || !expires.Equal(now.Add(24*time.Hour)) {
+			t.Fatalf("Default Expiry is not the Reservation TTL: %s %v", expires, err)
+		}
+
+		if expires, err := b.ParseReservationExpiry("2020-06-01T12:00:00Z", now); err != nil || expires.Hour() != 12 {
+			t.Fatalf("Requested Expiry was not Used: %s %v", expires, err)
+		}
+
+		for _, requested := range []string{"tomorrow", "2020-05-31T00:00:00Z", "2020-06-03T00:00:00Z"} {
+			if _, err := b.ParseReservationExpiry(requested, now); !errors.Is(err, ErrInvalidReservationExpiry) {
+				t.Fatalf("Invalid Expiry was Accepted %s: %v", requested, err)
+			}
+		}
+	})
+
+	t.Run("Fill", func(t *testing.T) {
+
+		updated := map[string]interface{}{
+			"name":               "test",
+			"creativeWorkStatus": StatusReserved,
+			"_reservation":       map[string]interface{}{"owner": owner.ID},
+		}
+
+		if err := clearReservation(reservation, updated, User{ID: "https://orcid.org/1111-1111-1111-1111"}); err != ErrReserved {
+			t.Fatalf("Another User Filled in the Reservation: %v", err)
+		}
+
+		if err := clearReservation(reservation, updated, owner); err != nil {
+			t.Fatalf("Owner Failed to Fill in the Reservation: %s", err.Error())
+		}
+
+		if _, ok := updated["_reservation"]; ok || updated["creativeWorkStatus"] != nil || updated["name"] != "test" {
+			t.Fatalf("Filled in Reservation is Still Reserved: %+v", updated)
+		}
+
+		// edits of records that were never reserved are left alone
+		edited := map[string]interface{}{"creativeWorkStatus": "Draft"}
+		if err := clearReservation([]byte(`{"_id": "ark:99999/test"}`), edited, User{}); err != nil || edited["creativeWorkStatus"] != "Draft" {
+			t.Fatalf("Record that isn't Reserved was Changed: %v %+v", err, edited)
+		}
+
+		if _, reserved := reservationOwner([]byte(`{"_reservation": {"expires": "2020-07-01T00:00:00Z"}}`)); !reserved || !mayFill("", User{ID: owner.ID}) {
+			t.Fatalf("Anonymous Reservation can't be Filled in")
+		}
+	})
+
+	t.Run("Create", func(t *testing.T) {
+
+		// creates are checked against the record they would fill in before any triples are written
+		if err := mayFillRecord(reservation, User{ID: "https://orcid.org/1111-1111-1111-1111"}); err != ErrReserved {
+			t.Fatalf("Another User may Fill in the Reservation: %v", err)
+		}
+
+		if err := mayFillRecord(reservation, owner); err != nil {
+			t.Fatalf("Owner may not Fill in the Reservation: %v", err)
+		}
+
+		if err := mayFillRecord([]byte(`{"_id": "ark:99999/test", "name": "test"}`), owner); err != ErrAlreadyExists {
+			t.Fatalf("Existing Identifier may be Created Again: %v", err)
+		}
+
+		// the triples of a create that lost to a reservation are removed rather than restored
+		now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+		if inGraph(reservation, now) || !inGraph([]byte(`{"_id": "ark:99999/test", "name": "test"}`), now) {
+			t.Fatalf("Records in the Graph are Misreported")
+		}
+	})
+
+	t.Run("Read", func(t *testing.T) {
+
+		if read := processMetadataRead(reservation); strings.Contains(string(read), "_reservation") {
+			t.Fatalf("Reservation Details were Returned: %s", read)
+		}
+	})
+
+}
@@ -0,0 +1,108 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/buger/jsonparser"
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrPreconditionFailed = errors.New("Precondition Failed")
+
+// errRevisionChanged is returned when a record changed between being read and being written
+var errRevisionChanged = errors.New("Revision Changed")
+
+// maxEditAttempts is how many times an unconditional edit is retried when the record changes underneath it
+const maxEditAttempts = 3
+
+// Revisions are the revisions of an identifier a change may be applied to, nil allows any revision.
+// Each change to an identifier increments its revision, records stored before revisions were counted are at 0.
+type Revisions []int64
+
+// ParseIfMatch reads the revisions an If-Match header allows. Weak and unrecognised entity tags never match,
+// so a header with only those allows none.
+func ParseIfMatch(header string) Revisions {
+
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil
+	}
+
+	revs := Revisions{}
+	for _, tag := range strings.Split(header, ",") {
+		if rev, ok := parseETag(strings.TrimSpace(tag)); ok {
+			revs = append(revs, rev)
+		}
+	}
+
+	return revs
+}
+
+// ETag is the entity tag of an identifier at revision rev
+func ETag(rev int64) string {
+	return `"` + strconv.FormatInt(rev, 10) + `"`
+}
+
+func parseETag(tag string) (int64, bool) {
+
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	rev, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+
+	return rev, err == nil && rev >= 0
+}
+
+func (r Revisions) allows(rev int64) bool {
+
+	if r == nil {
+		return true
+	}
+
+	for _, allowed := range r {
+		if allowed == rev {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filter restricts query to records at one of the revisions
+func (r Revisions) filter(query bson.D) bson.D {
+
+	if r == nil {
+		return query
+	}
+
+	in := bson.A{}
+	for _, rev := range r {
+		// a missing revision matches null
+		if rev == 0 {
+			in = append(in, nil)
+		}
+		in = append(in, rev)
+	}
+
+	return append(query, bson.E{"_rev", bson.D{{"$in", in}}})
+}
+
+// recordRevision reads the revision of a stored record
+func recordRevision(record []byte) int64 {
+
+	rev, err := jsonparser.GetInt(record, "_rev")
+	if err != nil {
+		return 0
+	}
+
+	return rev
+}
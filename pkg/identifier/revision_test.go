@@ -0,0 +1,62 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"reflect"
+	"testing"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRevisions(t *testing.T) {
+
+	t.Run("IfMatch", func(t *testing.T) {
+
+		if revs := ParseIfMatch(""); revs != nil || !revs.allows(7) {
+			t.Fatalf("Missing If-Match should Allow any Revision: %v", revs)
+		}
+
+		if revs := ParseIfMatch("*"); revs != nil {
+			t.Fatalf("If-Match * should Allow any Revision: %v", revs)
+		}
+
+		revs := ParseIfMatch(ETag(3) + `, W/"4", "5"`)
+		if !reflect.DeepEqual(revs, Revisions{3, 5}) || !revs.allows(5) || revs.allows(4) {
+			t.Fatalf("Incorrect Revisions: %v", revs)
+		}
+
+		// a header with no usable entity tag allows nothing
+		if revs = ParseIfMatch(`W/"4", "four"`); revs == nil || revs.allows(4) {
+			t.Fatalf("Weak and Invalid Entity Tags should Never Match: %v", revs)
+		}
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+
+		query := bson.D{{"_id", "ark:99999/test"}}
+
+		if filter := Revisions(nil).filter(query); !reflect.DeepEqual(filter, query) {
+			t.Fatalf("Unconditional Filter Changed the Query: %+v", filter)
+		}
+
+		filter := Revisions{0, 2}.filter(query)
+		expected := bson.D{{"_id", "ark:99999/test"}, {"_rev", bson.D{{"$in", bson.A{nil, int64(0), int64(2)}}}}}
+		if !reflect.DeepEqual(filter, expected) {
+			t.Fatalf("Incorrect Revision Filter: %+v", filter)
+		}
+
+		if rev := recordRevision([]byte(`{"@id": "ark:99999/test", "_rev": 4}`)); rev != 4 {
+			t.Fatalf("Incorrect Record Revision: %d", rev)
+		}
+
+		if rev := recordRevision([]byte(`{"@id": "ark:99999/test"}`)); rev != 0 {
+			t.Fatalf("Record without a Revision should be at 0: %d", rev)
+		}
+	})
+
+}
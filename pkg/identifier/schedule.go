@@ -0,0 +1,50 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package identifier
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var scheduleLogger = zerolog.New(os.Stderr).With().Timestamp().Str("backend", "schedule").Logger()
+
+// runPeriodically runs job every interval, and once immediately, until ctx is done. job returns how many records
+// it changed, which is logged along with any error. Every replica may run the same job, jobs only change records
+// on condition they still need changing.
+func runPeriodically(ctx context.Context, interval time.Duration, operation string, job func(now time.Time) (int, error)) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := job(time.Now().UTC())
+
+		switch {
+		case err != nil:
+			scheduleLogger.Error().
+				Err(err).
+				Str("operation", operation).
+				Int("count", count).
+				Msg("scheduled job failed")
+		case count > 0:
+			scheduleLogger.Info().
+				Str("operation", operation).
+				Int("count", count).
+				Msg("scheduled job succeeded")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -8,13 +8,20 @@ package identifier
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClarkLabUVA/mds/pkg/rdf"
 
-	//"encoding/json"
 	"github.com/rs/zerolog"
 	"os"
 )
@@ -25,6 +32,7 @@ var (
 	errFailedPost = errors.New("Failed Stardog Post")
 	errTXFailed   = errors.New("Transaction Failed")
     errStardogPingFail = errors.New("Stardog Ping failed to return status 200")
+	errStardogQuery    = errors.New("Stardog Query Failed")
 )
 
 var jsonLD = "application/ld+json"
@@ -35,6 +43,18 @@ type StardogServer struct {
 	Username      string
 	Database      string
 	ValidationURI string
+	// QueryTimeout bounds how long a query runs, defaultQueryTimeout when zero
+	QueryTimeout time.Duration
+}
+
+// defaultQueryTimeout is how long a query runs when the server sets no QueryTimeout
+const defaultQueryTimeout = 30 * time.Second
+
+func (s *StardogServer) queryTimeout() time.Duration {
+	if s.QueryTimeout > 0 {
+		return s.QueryTimeout
+	}
+	return defaultQueryTimeout
 }
 
 // Ping simply checks the health of the stardog server
@@ -358,8 +378,6 @@ func (s *StardogServer) AddData(txId string, data []byte, namedGraphURI string)
 
 	return
 
-	return
-
 }
 
 // POST /{db}/transaction/commit/{txId}/ -> void | text/plain
@@ -407,3 +425,159 @@ func (s *StardogServer) Commit(txId string) (err error) {
 	return
 
 }
+
+// POST /{db}/query -> results in the accepted media type
+func (s *StardogServer) Query(query string, accept string) (response []byte, err error) {
+
+	endpoint := s.URI + "/" + s.Database + "/query"
+
+	// stardog stops the query once the timeout passes, and the request gives up shortly after
+	timeout := s.queryTimeout()
+	form := url.Values{"query": {query}, "timeout": {strconv.FormatInt(timeout.Milliseconds(), 10)}}
+
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		stardogLogger.Error().
+			Err(err).
+			Str("operation", "query").
+			Str("url", endpoint).
+			Msg("failed to acquire http request")
+		return
+	}
+
+	req.SetBasicAuth(s.Username, s.Password)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Accept", accept)
+
+	client := &http.Client{Timeout: timeout + 5*time.Second}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		stardogLogger.Error().
+			Err(err).
+			Str("operation", "query").
+			Str("url", endpoint).
+			Str("query", query).
+			Msg("failed to preform request")
+
+		return
+	}
+	defer resp.Body.Close()
+
+	response, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("%w: %d %s", errStardogQuery, resp.StatusCode, string(response))
+
+		stardogLogger.Error().
+			Err(err).
+			Str("operation", "query").
+			Str("url", endpoint).
+			Str("query", query).
+			Int("statusCode", resp.StatusCode).
+			Msg("query failed")
+
+		return nil, err
+	}
+
+	stardogLogger.Info().
+		Str("operation", "query").
+		Str("url", endpoint).
+		Str("query", query).
+		Int("statusCode", resp.StatusCode).
+		Msg("preformed query")
+
+	return
+}
+
+// Subgraph returns the statements about the roots and the nodes up to FrameDepth properties away from them, one more
+// than MaxFrameStatements at most so a graph that is cut short can be told apart
+func (s *StardogServer) Subgraph(roots []string) (quads []rdf.Quad, err error) {
+
+	query, err := subgraphQuery(roots, "", FrameDepth, MaxFrameStatements+1)
+	if err != nil {
+		return
+	}
+
+	return s.construct(query)
+}
+
+// NamespaceSubgraph returns the statements about the identifiers in a namespace and the nodes up to FrameDepth
+// properties away from them, one more than MaxFrameStatements at most
+func (s *StardogServer) NamespaceSubgraph(namespace string) (quads []rdf.Quad, err error) {
+
+	query, err := subgraphQuery(nil, namespace, FrameDepth, MaxFrameStatements+1)
+	if err != nil {
+		return
+	}
+
+	return s.construct(query)
+}
+
+// Referrers returns the identifiers with a statement whose object is one of the forms of a target, directly or
+// through a blank node, and the properties of those statements
+func (s *StardogServer) Referrers(forms []string) (bindings []map[string]string, err error) {
+
+	query, err := referrersQuery(forms)
+	if err != nil {
+		return
+	}
+
+	return s.selectBindings(query)
+}
+
+// Edges returns the statements by one of the properties from the nodes to other IRIs, or with inbound set to the
+// nodes from other IRIs, binding the subject to s, the property to p and the object to o
+func (s *StardogServer) Edges(nodes []string, properties []string, inbound bool) (bindings []map[string]string, err error) {
+
+	query, err := edgesQuery(nodes, properties, inbound)
+	if err != nil {
+		return
+	}
+
+	return s.selectBindings(query)
+}
+
+// selectBindings runs a SELECT query, returning the value bound to each variable of every solution
+func (s *StardogServer) selectBindings(query string) (bindings []map[string]string, err error) {
+
+	response, err := s.Query(query, "application/sparql-results+json")
+	if err != nil {
+		return
+	}
+
+	var results struct {
+		Results struct {
+			Bindings []map[string]struct {
+				Value string `json:"value"`
+			} `json:"bindings"`
+		} `json:"results"`
+	}
+
+	if err = json.Unmarshal(response, &results); err != nil {
+		return nil, fmt.Errorf("%w: %s", errStardogQuery, err.Error())
+	}
+
+	for _, solution := range results.Results.Bindings {
+		binding := make(map[string]string, len(solution))
+		for variable, term := range solution {
+			binding[variable] = term.Value
+		}
+		bindings = append(bindings, binding)
+	}
+
+	return
+}
+
+func (s *StardogServer) construct(query string) (quads []rdf.Quad, err error) {
+
+	response, err := s.Query(query, rdf.MediaTypeNTriples)
+	if err != nil {
+		return
+	}
+
+	return rdf.ParseNTriples(bytes.NewReader(response))
+}
@@ -1,3 +1,6 @@
+//go:build integration
+// +build integration
+
 //© 2020 By The Rector And Visitors Of The University Of Virginia
 
 //Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
@@ -45,7 +48,7 @@ func TestStardog(t *testing.T) {
 		})
 	})
 
-	s.createDatabase(s.Database)
+	s.CreateDatabase(s.Database)
 	identifier := []byte(`{"@id": "ark:/99999/identifier-test", "@context": {"@vocab": "http://schema.org/"}, "name": "identifier-test"}`)
 	t.Run("Identifier", func(t *testing.T) {
 		t.Run("Transaction", func(t *testing.T) {
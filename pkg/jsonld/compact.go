@@ -0,0 +1,397 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"sort"
+	"strings"
+)
+
+// Compact shortens an expanded document using a context, the value of an @context entry.
+// A document with more than one top level node is returned in @graph.
+func Compact(expanded []interface{}, context interface{}, opts *Options) (map[string]interface{}, error) {
+
+	active, err := NewContext(opts).Parse(context, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	compacted := active.compact("", expanded)
+
+	result, ok := compacted.(map[string]interface{})
+	if !ok {
+		result = map[string]interface{}{}
+
+		if items := asArray(compacted); len(items) > 0 {
+			result["@graph"] = items
+		}
+	}
+
+	if !isEmptyContext(context) {
+		result["@context"] = context
+	}
+
+	return result, nil
+}
+
+func isEmptyContext(context interface{}) bool {
+
+	switch c := context.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(c) == 0
+	case []interface{}:
+		return len(c) == 0
+	}
+
+	return false
+}
+
+func (c *Context) compact(activeProperty string, element interface{}) interface{} {
+
+	def := c.Terms[activeProperty]
+
+	switch e := element.(type) {
+
+	case []interface{}:
+		result := []interface{}{}
+		for _, item := range e {
+			if compacted := c.compact(activeProperty, item); compacted != nil {
+				result = append(result, compacted)
+			}
+		}
+
+		if len(result) == 1 && (def == nil || (def.Container != "@set" && def.Container != "@list")) {
+			return result[0]
+		}
+		return result
+
+	case map[string]interface{}:
+		if _, ok := e["@value"]; ok {
+			return c.compactValue(def, e)
+		}
+
+		if id, ok := e["@id"].(string); ok && len(e) == 1 {
+			switch {
+			case def != nil && def.Type == "@id":
+				return c.compactIRI(id, nil, false)
+			case def != nil && def.Type == "@vocab":
+				return c.compactIRI(id, nil, true)
+			}
+			return map[string]interface{}{"@id": c.compactIRI(id, nil, false)}
+		}
+
+		if list, ok := e["@list"]; ok {
+			items := []interface{}{}
+			for _, item := range asArray(list) {
+				if compacted := c.compact(activeProperty, item); compacted != nil {
+					items = append(items, compacted)
+				}
+			}
+
+			if def != nil && def.Container == "@list" {
+				return items
+			}
+
+			result := map[string]interface{}{"@list": items}
+			if index, ok := e["@index"]; ok {
+				result["@index"] = index
+			}
+			return result
+		}
+
+		return c.compactNode(e)
+	}
+
+	return element
+}
+
+func (c *Context) compactNode(node map[string]interface{}) map[string]interface{} {
+
+	result := map[string]interface{}{}
+
+	for _, property := range sortedKeys(node) {
+		value := node[property]
+
+		switch property {
+
+		case "@id":
+			id, _ := value.(string)
+			result["@id"] = c.compactIRI(id, nil, false)
+			continue
+
+		case "@type":
+			var types []interface{}
+			for _, t := range asArray(value) {
+				s, _ := t.(string)
+				types = append(types, c.compactIRI(s, nil, true))
+			}
+			if len(types) == 1 {
+				result["@type"] = types[0]
+			} else {
+				result["@type"] = types
+			}
+			continue
+
+		case "@index", "@language":
+			result[property] = value
+			continue
+
+		case "@graph":
+			result["@graph"] = asArray(c.compact("@graph", value))
+			continue
+
+		case "@reverse":
+			reverse, _ := value.(map[string]interface{})
+			remaining := map[string]interface{}{}
+
+			for _, prop := range sortedKeys(reverse) {
+				if term := c.reverseTerm(prop); term != "" {
+					c.addCompacted(result, term, reverse[prop])
+				} else {
+					remaining[c.compactIRI(prop, nil, true)] = c.compact("", reverse[prop])
+				}
+			}
+
+			if len(remaining) > 0 {
+				result["@reverse"] = remaining
+			}
+			continue
+		}
+
+		if IsKeyword(property) {
+			continue
+		}
+
+		items := asArray(value)
+		if len(items) == 0 {
+			result[c.compactIRI(property, nil, true)] = []interface{}{}
+			continue
+		}
+
+		for _, item := range items {
+			c.addCompacted(result, c.compactIRI(property, item, true), item)
+		}
+	}
+
+	return result
+}
+
+// addCompacted compacts the expanded values of a property and adds them to result under term
+func (c *Context) addCompacted(result map[string]interface{}, term string, values interface{}) {
+
+	def := c.Terms[term]
+
+	for _, item := range asArray(values) {
+		compacted := c.compact(term, item)
+
+		if def != nil && def.Container == "@list" {
+			result[term] = compacted
+			continue
+		}
+
+		existing, exists := result[term]
+		switch {
+		case !exists && (def == nil || def.Container != "@set"):
+			result[term] = compacted
+		case !exists:
+			result[term] = []interface{}{compacted}
+		default:
+			result[term] = append(asArray(existing), compacted)
+		}
+	}
+}
+
+// compactValue returns the scalar of a value object when the term's type and language imply the rest of it
+func (c *Context) compactValue(def *TermDefinition, value map[string]interface{}) interface{} {
+
+	typ, hasType := value["@type"].(string)
+	lang, hasLang := value["@language"].(string)
+	_, hasIndex := value["@index"]
+
+	termType, termLang := "", c.Language
+	if def != nil {
+		termType = def.Type
+		if def.Language != nil {
+			termLang = *def.Language
+		}
+	}
+
+	if !hasIndex {
+		switch {
+		case hasType && typ == termType:
+			return value["@value"]
+		case !hasType && termType == "" && hasLang && lang == termLang:
+			return value["@value"]
+		case !hasType && !hasLang && (termType == "" || termType == "@none"):
+			if _, isString := value["@value"].(string); !isString || termLang == "" {
+				return value["@value"]
+			}
+		}
+	}
+
+	result := map[string]interface{}{"@value": value["@value"]}
+	if hasType {
+		result["@type"] = c.compactIRI(typ, nil, true)
+	}
+	if hasLang {
+		result["@language"] = lang
+	}
+	if hasIndex {
+		result["@index"] = value["@index"]
+	}
+
+	return result
+}
+
+// compactIRI returns the shortest form of iri, a term that matches value, a vocabulary relative IRI, or a compact IRI.
+// value is the expanded value the IRI is a property of, when compacting a property.
+func (c *Context) compactIRI(iri string, value interface{}, vocab bool) string {
+
+	if iri == "" || IsKeyword(iri) {
+		return iri
+	}
+
+	if vocab {
+		if term := c.selectTerm(iri, value); term != "" {
+			return term
+		}
+
+		if c.Vocab != "" && strings.HasPrefix(iri, c.Vocab) && len(iri) > len(c.Vocab) {
+			suffix := iri[len(c.Vocab):]
+			if _, defined := c.Terms[suffix]; !defined && !strings.Contains(suffix, ":") {
+				return suffix
+			}
+		}
+	}
+
+	// the shortest compact IRI, ties broken alphabetically
+	best := ""
+	for _, term := range sortedTermNames(c.Terms) {
+		def := c.Terms[term]
+		if def.ID == "" || def.ID == iri || def.Reverse || !strings.HasPrefix(iri, def.ID) || strings.Contains(term, ":") {
+			continue
+		}
+		if !def.Prefix && !strings.ContainsAny(def.ID[len(def.ID)-1:], ":/?#[]@") {
+			continue
+		}
+
+		candidate := term + ":" + iri[len(def.ID):]
+
+		// a candidate that is itself a term would expand to something else
+		if other, ok := c.Terms[candidate]; ok && (value != nil || other.ID != iri) {
+			continue
+		}
+
+		if best == "" || len(candidate) < len(best) {
+			best = candidate
+		}
+	}
+
+	if best != "" {
+		return best
+	}
+
+	return iri
+}
+
+// selectTerm returns the term defined for iri whose type, language and container match the value
+func (c *Context) selectTerm(iri string, value interface{}) string {
+
+	fallback := ""
+
+	for _, term := range sortedTermNames(c.Terms) {
+		def := c.Terms[term]
+		if def.ID != iri || def.Reverse {
+			continue
+		}
+
+		switch {
+		case value == nil:
+			if def.Container == "" && def.Type == "" {
+				return term
+			}
+			if fallback == "" {
+				fallback = term
+			}
+
+		case c.termMatches(def, value):
+			return term
+		}
+	}
+
+	return fallback
+}
+
+func (c *Context) termMatches(def *TermDefinition, value interface{}) bool {
+
+	v, _ := value.(map[string]interface{})
+
+	if _, isList := v["@list"]; isList {
+		return def.Container == "@list"
+	}
+
+	switch def.Container {
+	case "", "@set":
+	default:
+		return false
+	}
+
+	if _, isValue := v["@value"]; isValue {
+		typ, hasType := v["@type"].(string)
+		lang, hasLang := v["@language"].(string)
+
+		switch {
+		case hasType:
+			return def.Type == typ || (def.Type == "" && def.Language == nil)
+		case hasLang:
+			return def.Type == "" && (def.Language == nil || *def.Language == lang)
+		}
+
+		if def.Type != "" && def.Type != "@none" {
+			return false
+		}
+		if _, isString := v["@value"].(string); isString && def.Language != nil {
+			return *def.Language == ""
+		}
+		return true
+	}
+
+	// node objects and references
+	return def.Type == "" || def.Type == "@id" || def.Type == "@vocab"
+}
+
+// reverseTerm returns a term defined as the reverse of iri
+func (c *Context) reverseTerm(iri string) string {
+
+	for _, term := range sortedTermNames(c.Terms) {
+		if def := c.Terms[term]; def.Reverse && def.ID == iri {
+			return term
+		}
+	}
+
+	return ""
+}
+
+func sortedTermNames(terms map[string]*TermDefinition) []string {
+
+	names := make([]string, 0, len(terms))
+	for name := range terms {
+		names = append(names, name)
+	}
+
+	// shorter terms first, so the first match is the shortest
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	return names
+}
@@ -0,0 +1,301 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ClarkLabUVA/mds/pkg/rdf"
+)
+
+// The conformance tests run the manifests of the W3C JSON-LD 1.1 API test suite,
+// https://github.com/w3c/json-ld-api, when JSONLD_TEST_SUITE is the tests directory of a checkout.
+// Tests of features the package refuses with ErrUnsupported, and of options it doesn't have, are skipped.
+
+// jsonldTestOptions are the test options that are run, any other option skips the test
+var jsonldTestOptions = map[string]bool{"specVersion": true, "processingMode": true, "base": true, "useNativeTypes": true}
+
+type jsonldManifest struct {
+	BaseIri  string `json:"baseIri"`
+	Sequence []struct {
+		ID              string                 `json:"@id"`
+		Type            []string               `json:"@type"`
+		Name            string                 `json:"name"`
+		Input           string                 `json:"input"`
+		Context         string                 `json:"context"`
+		Expect          string                 `json:"expect"`
+		ExpectErrorCode string                 `json:"expectErrorCode"`
+		Option          map[string]interface{} `json:"option"`
+	} `json:"sequence"`
+}
+
+// suiteLoader serves the documents of the test suite from the checkout
+type suiteLoader struct {
+	dir  string
+	base string
+}
+
+func (l suiteLoader) LoadDocument(url string) (interface{}, error) {
+
+	if !strings.HasPrefix(url, l.base) {
+		return nil, fmt.Errorf("%s is not part of the test suite", url)
+	}
+
+	return readJSON(filepath.Join(l.dir, filepath.FromSlash(strings.TrimPrefix(url, l.base))))
+}
+
+func readJSON(path string) (interface{}, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+func readNQuads(path string) ([]rdf.Quad, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return rdf.ParseNQuads(f)
+}
+
+// jsonldEqual compares documents as the test suite does, arrays are unordered except for the values of @list.
+// Blank node identifiers are only compared as being blank nodes, labelling isn't checked.
+func jsonldEqual(a interface{}, b interface{}, ordered bool) bool {
+
+	switch av := a.(type) {
+
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			other, ok := bv[key]
+			if !ok || !jsonldEqual(value, other, key == "@list") {
+				return false
+			}
+		}
+		return true
+
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+
+		if ordered {
+			for i := range av {
+				if !jsonldEqual(av[i], bv[i], false) {
+					return false
+				}
+			}
+			return true
+		}
+
+		used := make([]bool, len(bv))
+		for _, item := range av {
+			found := false
+			for j, other := range bv {
+				if !used[j] && jsonldEqual(item, other, false) {
+					used[j], found = true, true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+
+	case string:
+		bv, ok := b.(string)
+		return ok && (av == bv || strings.HasPrefix(av, "_:") && strings.HasPrefix(bv, "_:"))
+	}
+
+	return a == b
+}
+
+// normalize gives a document the types encoding/json decodes to, so results compare with expectations
+func normalize(doc interface{}) (interface{}, error) {
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalized interface{}
+	err = json.Unmarshal(data, &normalized)
+	return normalized, err
+}
+
+func TestConformance(t *testing.T) {
+
+	suite := os.Getenv("JSONLD_TEST_SUITE")
+	if suite == "" {
+		t.Skip("JSONLD_TEST_SUITE is not set")
+	}
+
+	for _, name := range []string{"expand", "compact", "flatten", "toRdf", "fromRdf"} {
+		name := name
+
+		t.Run(name, func(t *testing.T) {
+
+			var manifest jsonldManifest
+			data, err := ioutil.ReadFile(filepath.Join(suite, name+"-manifest.jsonld"))
+			if err != nil {
+				t.Skipf("No Manifest for %s: %s", name, err.Error())
+			}
+			if err = json.Unmarshal(data, &manifest); err != nil {
+				t.Fatalf("Failed to Parse Manifest: %s", err.Error())
+			}
+
+			loader := suiteLoader{dir: suite, base: manifest.BaseIri}
+
+			for _, test := range manifest.Sequence {
+				test := test
+
+				t.Run(strings.TrimPrefix(test.ID, "#"), func(t *testing.T) {
+
+					for option, value := range test.Option {
+						if !jsonldTestOptions[option] {
+							t.Skipf("Option %s is not supported", option)
+						}
+						if (option == "specVersion" || option == "processingMode") && value != "json-ld-1.1" {
+							t.Skipf("%s is not supported", value)
+						}
+					}
+
+					if ext := filepath.Ext(test.Input); ext != ".jsonld" && ext != ".nq" {
+						t.Skipf("%s input is not supported", ext)
+					}
+
+					opts := &Options{Base: manifest.BaseIri + test.Input, Loader: loader}
+					if base, ok := test.Option["base"].(string); ok {
+						opts.Base = base
+					}
+
+					result, err := runConformanceTest(name, suite, test.Input, test.Context, opts, test.Option["useNativeTypes"] == true)
+
+					if errors.Is(err, ErrUnsupported) {
+						t.Skipf("%s: %s", test.Name, err.Error())
+					}
+
+					negative := false
+					for _, typ := range test.Type {
+						negative = negative || strings.HasSuffix(typ, "NegativeEvaluationTest")
+					}
+
+					switch {
+					case negative:
+						if err == nil {
+							t.Fatalf("%s Succeeded, Expected %s", test.Name, test.ExpectErrorCode)
+						}
+						return
+					case err != nil:
+						t.Fatalf("%s Failed: %s", test.Name, err.Error())
+					case test.Expect == "":
+						return
+					}
+
+					expected := filepath.Join(suite, filepath.FromSlash(test.Expect))
+
+					if quads, ok := result.([]rdf.Quad); ok {
+						expectedQuads, err := readNQuads(expected)
+						if err != nil {
+							t.Fatalf("Failed to Read Expected Result: %s", err.Error())
+						}
+
+						if !rdf.Isomorphic(quads, expectedQuads) {
+							var out bytes.Buffer
+							rdf.WriteNQuads(&out, quads)
+							t.Fatalf("Incorrect Quads for %s\n%s", test.Name, out.String())
+						}
+						return
+					}
+
+					expectedDoc, err := readJSON(expected)
+					if err != nil {
+						t.Fatalf("Failed to Read Expected Result: %s", err.Error())
+					}
+
+					if !jsonldEqual(expectedDoc, result, false) {
+						out, _ := json.MarshalIndent(result, "", "  ")
+						t.Fatalf("Incorrect Result for %s\n%s", test.Name, string(out))
+					}
+				})
+			}
+		})
+	}
+}
+
+// runConformanceTest runs the algorithm a manifest tests, the result is a normalized document or quads
+func runConformanceTest(name string, suite string, input string, context string, opts *Options, useNativeTypes bool) (interface{}, error) {
+
+	path := filepath.Join(suite, filepath.FromSlash(input))
+
+	if name == "fromRdf" {
+		quads, err := readNQuads(path)
+		if err != nil {
+			return nil, err
+		}
+		return normalize(FromRDF(quads, useNativeTypes))
+	}
+
+	doc, err := readJSON(path)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded, err := Expand(doc, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{} = expanded
+
+	switch name {
+	case "toRdf":
+		return ToRDF(expanded), nil
+	case "flatten":
+		result = Flatten(expanded)
+	}
+
+	if context != "" {
+		contextDoc, err := readJSON(filepath.Join(suite, filepath.FromSlash(context)))
+		if err != nil {
+			return nil, err
+		}
+
+		contextMap, ok := contextDoc.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("context %s is not an object", context)
+		}
+
+		if result, err = Compact(asArray(result), contextMap["@context"], opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return normalize(result)
+}
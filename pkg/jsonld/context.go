@@ -0,0 +1,606 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package jsonld implements the parts of JSON-LD 1.1 processing that MDS relies on: context processing,
+// expansion, compaction, flattening, framing and conversion to and from RDF.
+// Documents are the generic values produced by encoding/json, numbers may be float64 or json.Number.
+//
+// Contexts may set @base, @vocab, @language, @version and @protected, and define terms by @id, @reverse, @type,
+// @language, @prefix, @protected and a @container of @list, @set, @language or @index, or @set with @language or
+// @index. Documents may use @graph, @list, @set, @index and @reverse. Anything else JSON-LD 1.1 adds is refused
+// with an error instead of being processed differently than the specification says: @import, @propagate and
+// @direction in contexts, scoped contexts, @nest, @index and @type @json in term definitions, @id, @type and
+// @graph containers, lists of lists, and @included, @nest and @json in documents.
+package jsonld
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrInvalidContext    = errors.New("jsonld: invalid context")
+	ErrInvalidIRI        = errors.New("jsonld: invalid IRI mapping")
+	ErrCyclicDefinition  = errors.New("jsonld: cyclic term definition")
+	ErrRemoteContext     = errors.New("jsonld: failed to load remote context")
+	ErrInvalidValue      = errors.New("jsonld: invalid value object")
+	ErrInvalidKeywordUse = errors.New("jsonld: invalid use of keyword")
+	ErrContextOverflow   = errors.New("jsonld: too many nested remote contexts")
+	// ErrUnsupported is matched by the errors refusing parts of JSON-LD 1.1 that aren't implemented
+	ErrUnsupported = errors.New("jsonld: feature is not supported")
+)
+
+// unsupportedError refuses a feature that isn't implemented, it unwraps to the error of the same kind of invalid input
+type unsupportedError struct {
+	kind    error
+	feature string
+}
+
+func (e *unsupportedError) Error() string {
+	return fmt.Sprintf("%s: %s is not supported", e.kind.Error(), e.feature)
+}
+
+func (e *unsupportedError) Unwrap() error {
+	return e.kind
+}
+
+func (e *unsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+func unsupported(kind error, feature string) error {
+	return &unsupportedError{kind: kind, feature: feature}
+}
+
+// maxRemoteContextDepth limits how deeply remote contexts may include other remote contexts
+const maxRemoteContextDepth = 10
+
+// Context is a processed JSON-LD context
+type Context struct {
+	Base     string
+	Vocab    string
+	Language string
+	Terms    map[string]*TermDefinition
+}
+
+// TermDefinition is the processed definition of a term.
+// A term defined as null has an empty ID and is ignored during expansion.
+type TermDefinition struct {
+	ID        string
+	Type      string
+	Container string
+	Language  *string
+	Reverse   bool
+	Prefix    bool
+	// Protected terms can only be defined again the same way
+	Protected bool
+}
+
+// Options configure processing
+type Options struct {
+	// Base is the document IRI relative @id values are resolved against
+	Base string
+	// Loader retrieves remote contexts, DefaultLoader is used when nil
+	Loader DocumentLoader
+}
+
+func (o *Options) loader() DocumentLoader {
+	if o == nil || o.Loader == nil {
+		return DefaultLoader
+	}
+	return o.Loader
+}
+
+// NewContext returns an empty active context
+func NewContext(opts *Options) *Context {
+
+	c := &Context{Terms: map[string]*TermDefinition{}}
+	if opts != nil {
+		c.Base = opts.Base
+	}
+
+	return c
+}
+
+func (c *Context) clone() *Context {
+
+	n := &Context{Base: c.Base, Vocab: c.Vocab, Language: c.Language, Terms: make(map[string]*TermDefinition, len(c.Terms))}
+	for k, v := range c.Terms {
+		n.Terms[k] = v
+	}
+
+	return n
+}
+
+// Parse processes a local context, the value of an @context entry, on top of the active context
+func (c *Context) Parse(local interface{}, opts *Options) (*Context, error) {
+	return c.parse(local, opts, map[string]bool{})
+}
+
+func (c *Context) parse(local interface{}, opts *Options, remotes map[string]bool) (*Context, error) {
+
+	result := c.clone()
+
+	contexts, ok := local.([]interface{})
+	if !ok {
+		contexts = []interface{}{local}
+	}
+
+	for _, ctx := range contexts {
+		switch v := ctx.(type) {
+
+		case nil:
+			for term, def := range result.Terms {
+				if def.Protected {
+					return nil, fmt.Errorf("%w: protected term %s can not be cleared", ErrInvalidContext, term)
+				}
+			}
+			result = NewContext(opts)
+			result.Base = c.Base
+
+		case string:
+			iri := v
+			if base, err := url.Parse(result.Base); err == nil && result.Base != "" {
+				if ref, err := url.Parse(v); err == nil {
+					iri = base.ResolveReference(ref).String()
+				}
+			}
+
+			if remotes[iri] {
+				return nil, fmt.Errorf("%w: %s is included recursively", ErrInvalidContext, iri)
+			}
+			if len(remotes) >= maxRemoteContextDepth {
+				return nil, ErrContextOverflow
+			}
+
+			doc, err := opts.loader().LoadDocument(iri)
+			if err != nil {
+				return nil, fmt.Errorf("%w %s: %s", ErrRemoteContext, iri, err.Error())
+			}
+
+			docMap, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%w: %s is not a JSON object", ErrInvalidContext, iri)
+			}
+
+			remoteCtx, ok := docMap["@context"]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s has no @context", ErrInvalidContext, iri)
+			}
+
+			nested := make(map[string]bool, len(remotes)+1)
+			for k := range remotes {
+				nested[k] = true
+			}
+			nested[iri] = true
+
+			var err2 error
+			result, err2 = result.parse(remoteCtx, opts, nested)
+			if err2 != nil {
+				return nil, err2
+			}
+
+		case map[string]interface{}:
+			if err := result.parseDefinitions(v); err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("%w: %v", ErrInvalidContext, ctx)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *Context) parseDefinitions(local map[string]interface{}) error {
+
+	if base, ok := local["@base"]; ok {
+		switch b := base.(type) {
+		case nil:
+			c.Base = ""
+		case string:
+			c.Base = resolveIRI(c.Base, b)
+		default:
+			return fmt.Errorf("%w: @base must be a string", ErrInvalidContext)
+		}
+	}
+
+	if vocab, ok := local["@vocab"]; ok {
+		switch v := vocab.(type) {
+		case nil:
+			c.Vocab = ""
+		case string:
+			expanded, err := c.expandIRI(v, true, true, nil, nil)
+			if err != nil {
+				return err
+			}
+			c.Vocab = expanded
+		default:
+			return fmt.Errorf("%w: @vocab must be a string", ErrInvalidContext)
+		}
+	}
+
+	if lang, ok := local["@language"]; ok {
+		switch l := lang.(type) {
+		case nil:
+			c.Language = ""
+		case string:
+			c.Language = strings.ToLower(l)
+		default:
+			return fmt.Errorf("%w: @language must be a string", ErrInvalidContext)
+		}
+	}
+
+	if _, ok := local["@import"]; ok {
+		return unsupported(ErrInvalidContext, "@import")
+	}
+
+	if propagate, ok := local["@propagate"]; ok && propagate != true {
+		return unsupported(ErrInvalidContext, "@propagate")
+	}
+
+	if direction, ok := local["@direction"]; ok && direction != nil {
+		return unsupported(ErrInvalidContext, "@direction")
+	}
+
+	defined := map[string]bool{}
+
+	// sort the terms so errors are reported deterministically
+	terms := make([]string, 0, len(local))
+	for term := range local {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	for _, term := range terms {
+		switch term {
+		case "@base", "@vocab", "@language", "@version", "@protected", "@propagate", "@direction":
+			continue
+		}
+
+		if err := c.createTermDefinition(local, term, defined); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Context) createTermDefinition(local map[string]interface{}, term string, defined map[string]bool) error {
+
+	if done, ok := defined[term]; ok {
+		if done {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrCyclicDefinition, term)
+	}
+
+	if IsKeyword(term) {
+		return fmt.Errorf("%w: %s can not be redefined", ErrInvalidKeywordUse, term)
+	}
+
+	defined[term] = false
+	previous := c.Terms[term]
+	delete(c.Terms, term)
+
+	protected, _ := local["@protected"].(bool)
+
+	var value map[string]interface{}
+	simple := false
+
+	switch v := local[term].(type) {
+	case nil:
+		return c.defineTerm(term, &TermDefinition{Protected: protected}, previous, defined)
+
+	case string:
+		value = map[string]interface{}{"@id": v}
+		simple = true
+
+	case map[string]interface{}:
+		value = v
+
+	default:
+		return fmt.Errorf("%w: definition of %s must be a string or object", ErrInvalidContext, term)
+	}
+
+	// parts of term definitions that aren't implemented are refused rather than ignored
+	for _, key := range []string{"@context", "@nest", "@index"} {
+		if _, ok := value[key]; ok {
+			return unsupported(ErrInvalidContext, key+" in the definition of "+term)
+		}
+	}
+
+	if p, ok := value["@protected"].(bool); ok {
+		protected = p
+	}
+
+	def := &TermDefinition{Protected: protected}
+
+	if reverse, ok := value["@reverse"]; ok {
+		r, ok := reverse.(string)
+		if !ok {
+			return fmt.Errorf("%w: @reverse of %s must be a string", ErrInvalidIRI, term)
+		}
+
+		id, err := c.expandIRI(r, false, true, local, defined)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(id, ":") {
+			return fmt.Errorf("%w: %s", ErrInvalidIRI, term)
+		}
+
+		def.ID = id
+		def.Reverse = true
+
+	} else if id, ok := value["@id"]; ok && id != term {
+		switch i := id.(type) {
+		case nil:
+			// the term is explicitly unmapped
+			return c.defineTerm(term, def, previous, defined)
+
+		case string:
+			expanded, err := c.expandIRI(i, false, true, local, defined)
+			if err != nil {
+				return err
+			}
+			if !IsKeyword(expanded) && !strings.Contains(expanded, ":") {
+				return fmt.Errorf("%w: %s maps to %s", ErrInvalidIRI, term, expanded)
+			}
+			if expanded == "@context" {
+				return fmt.Errorf("%w: %s can not alias @context", ErrInvalidKeywordUse, term)
+			}
+			def.ID = expanded
+
+			// simple terms ending in a gen-delim can be used as prefixes of compact IRIs
+			if simple && !strings.Contains(term, ":") && len(expanded) > 0 && strings.ContainsAny(expanded[len(expanded)-1:], ":/?#[]@") {
+				def.Prefix = true
+			}
+
+		default:
+			return fmt.Errorf("%w: @id of %s must be a string", ErrInvalidIRI, term)
+		}
+
+	} else if i := strings.Index(term, ":"); i > 0 {
+		prefix := term[:i]
+		if _, ok := local[prefix]; ok {
+			if err := c.createTermDefinition(local, prefix, defined); err != nil {
+				return err
+			}
+		}
+
+		if p, ok := c.Terms[prefix]; ok && p.ID != "" {
+			def.ID = p.ID + term[i+1:]
+		} else {
+			def.ID = term
+		}
+
+	} else if c.Vocab != "" {
+		def.ID = c.Vocab + term
+
+	} else {
+		return fmt.Errorf("%w: %s has no IRI and there is no @vocab", ErrInvalidIRI, term)
+	}
+
+	if t, ok := value["@type"]; ok {
+		typ, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("%w: @type of %s must be a string", ErrInvalidContext, term)
+		}
+
+		switch typ {
+		case "@id", "@vocab", "@none":
+			def.Type = typ
+		case "@json":
+			return unsupported(ErrInvalidContext, "@type @json of "+term)
+		default:
+			expanded, err := c.expandIRI(typ, false, true, local, defined)
+			if err != nil {
+				return err
+			}
+			if !strings.Contains(expanded, ":") {
+				return fmt.Errorf("%w: @type of %s is not an IRI", ErrInvalidContext, term)
+			}
+			def.Type = expanded
+		}
+	}
+
+	if container, ok := value["@container"]; ok {
+		ct, err := parseContainer(container)
+		if err != nil {
+			return fmt.Errorf("%w of %s", err, term)
+		}
+		def.Container = ct
+	}
+
+	if lang, ok := value["@language"]; ok {
+		switch l := lang.(type) {
+		case nil:
+			empty := ""
+			def.Language = &empty
+		case string:
+			lower := strings.ToLower(l)
+			def.Language = &lower
+		default:
+			return fmt.Errorf("%w: @language of %s must be a string", ErrInvalidContext, term)
+		}
+	}
+
+	if p, ok := value["@prefix"].(bool); ok {
+		def.Prefix = p
+	}
+
+	return c.defineTerm(term, def, previous, defined)
+}
+
+// defineTerm sets the definition of a term, a protected term keeps its previous definition and may only be
+// defined again the same way
+func (c *Context) defineTerm(term string, def *TermDefinition, previous *TermDefinition, defined map[string]bool) error {
+
+	if previous != nil && previous.Protected {
+		same := *def
+		same.Protected = true
+		if !reflect.DeepEqual(same, *previous) {
+			return fmt.Errorf("%w: protected term %s can not be redefined", ErrInvalidContext, term)
+		}
+		def = previous
+	}
+
+	c.Terms[term] = def
+	defined[term] = true
+
+	return nil
+}
+
+// parseContainer reads the @container of a term definition. @list, @set, @language and @index are supported, and
+// @set combined with @language or @index, which is equivalent to the other container alone.
+func parseContainer(container interface{}) (string, error) {
+
+	var containers []string
+	switch ct := container.(type) {
+	case nil:
+		return "", nil
+	case string:
+		containers = []string{ct}
+	case []interface{}:
+		for _, item := range ct {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("%w: @container must be a string or strings", ErrInvalidContext)
+			}
+			containers = append(containers, s)
+		}
+	default:
+		return "", fmt.Errorf("%w: @container must be a string or strings", ErrInvalidContext)
+	}
+
+	for _, c := range containers {
+		switch c {
+		case "@list", "@set", "@language", "@index":
+		case "@id", "@type", "@graph":
+			return "", unsupported(ErrInvalidContext, "@container "+c)
+		default:
+			return "", fmt.Errorf("%w: unsupported @container %s", ErrInvalidContext, c)
+		}
+	}
+
+	switch len(containers) {
+	case 0:
+		return "", nil
+	case 1:
+		return containers[0], nil
+	case 2:
+		other := containers[0]
+		if other == "@set" {
+			other = containers[1]
+		}
+		if containers[0] == containers[1] || (containers[0] != "@set" && containers[1] != "@set") || other == "@list" {
+			break
+		}
+		return other, nil
+	}
+
+	return "", fmt.Errorf("%w: unsupported @container %s", ErrInvalidContext, strings.Join(containers, ", "))
+}
+
+// ExpandIRI expands a term, compact IRI or relative IRI using the context.
+// When vocab is set terms and @vocab are used, otherwise relative IRIs are resolved against the base.
+func (c *Context) ExpandIRI(value string, vocab bool) string {
+	iri, _ := c.expandIRI(value, !vocab, vocab, nil, nil)
+	return iri
+}
+
+func (c *Context) expandIRI(value string, documentRelative bool, vocab bool, local map[string]interface{}, defined map[string]bool) (string, error) {
+
+	if IsKeyword(value) || value == "" {
+		return value, nil
+	}
+
+	if local != nil {
+		if _, ok := local[value]; ok && !defined[value] {
+			if err := c.createTermDefinition(local, value, defined); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if def, ok := c.Terms[value]; ok && (vocab || IsKeyword(def.ID)) {
+		return def.ID, nil
+	}
+
+	if i := strings.Index(value, ":"); i >= 0 {
+		prefix, suffix := value[:i], value[i+1:]
+
+		// blank node identifiers and absolute IRIs are returned as is
+		if prefix == "_" || strings.HasPrefix(suffix, "//") {
+			return value, nil
+		}
+
+		if local != nil {
+			if _, ok := local[prefix]; ok && !defined[prefix] {
+				if err := c.createTermDefinition(local, prefix, defined); err != nil {
+					return "", err
+				}
+			}
+		}
+
+		if def, ok := c.Terms[prefix]; ok && def.ID != "" && !def.Reverse {
+			return def.ID + suffix, nil
+		}
+
+		return value, nil
+	}
+
+	if vocab && c.Vocab != "" {
+		return c.Vocab + value, nil
+	}
+
+	if documentRelative {
+		return resolveIRI(c.Base, value), nil
+	}
+
+	return value, nil
+}
+
+// resolveIRI resolves a relative IRI reference against base, returning the reference when base is empty
+func resolveIRI(base string, ref string) string {
+
+	if base == "" {
+		return ref
+	}
+
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+
+	return b.ResolveReference(r).String()
+}
+
+// IsKeyword reports whether s is a JSON-LD keyword
+func IsKeyword(s string) bool {
+
+	switch s {
+	case "@base", "@container", "@context", "@default", "@direction", "@embed", "@explicit", "@graph",
+		"@id", "@import", "@included", "@index", "@json", "@language", "@list", "@nest", "@none",
+		"@omitDefault", "@prefix", "@preserve", "@propagate", "@protected", "@requireAll", "@reverse",
+		"@set", "@type", "@value", "@version", "@vocab":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,534 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Expand returns the expanded form of a document, an array of node objects with every term,
+// compact IRI and relative IRI replaced by an absolute IRI
+func Expand(doc interface{}, opts *Options) ([]interface{}, error) {
+
+	expanded, err := expand(NewContext(opts), "", doc, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// a top level object with only @graph is replaced by the graph
+	if m, ok := expanded.(map[string]interface{}); ok && len(m) == 1 {
+		if graph, ok := m["@graph"]; ok {
+			expanded = graph
+		}
+	}
+
+	if expanded == nil {
+		return []interface{}{}, nil
+	}
+
+	return asArray(expanded), nil
+}
+
+func expand(active *Context, activeProperty string, element interface{}, opts *Options) (interface{}, error) {
+
+	switch e := element.(type) {
+
+	case nil:
+		return nil, nil
+
+	case []interface{}:
+		def := active.Terms[activeProperty]
+		result := []interface{}{}
+
+		for _, item := range e {
+			expanded, err := expand(active, activeProperty, item, opts)
+			if err != nil {
+				return nil, err
+			}
+
+			if def != nil && def.Container == "@list" {
+				if _, ok := expanded.([]interface{}); ok {
+					return nil, unsupported(ErrInvalidKeywordUse, "a list of lists")
+				}
+			}
+
+			switch ex := expanded.(type) {
+			case nil:
+			case []interface{}:
+				result = append(result, ex...)
+			default:
+				result = append(result, ex)
+			}
+		}
+
+		return result, nil
+
+	case map[string]interface{}:
+		return expandObject(active, activeProperty, e, opts)
+
+	default:
+		// free floating scalars are dropped
+		if activeProperty == "" || activeProperty == "@graph" {
+			return nil, nil
+		}
+		return expandValue(active, activeProperty, e)
+	}
+}
+
+func expandObject(active *Context, activeProperty string, element map[string]interface{}, opts *Options) (interface{}, error) {
+
+	if local, ok := element["@context"]; ok {
+		var err error
+		if active, err = active.Parse(local, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	result := map[string]interface{}{}
+
+	for _, key := range sortedKeys(element) {
+		value := element[key]
+
+		if key == "@context" {
+			continue
+		}
+
+		property, err := active.expandIRI(key, false, true, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// properties that don't expand to an absolute IRI or a keyword are dropped
+		if property == "" || (!IsKeyword(property) && !strings.Contains(property, ":")) {
+			continue
+		}
+
+		if IsKeyword(property) {
+			if activeProperty == "@reverse" {
+				return nil, fmt.Errorf("%w: %s in a reverse map", ErrInvalidKeywordUse, property)
+			}
+
+			if _, ok := result[property]; ok && property != "@type" {
+				return nil, fmt.Errorf("%w: colliding %s", ErrInvalidKeywordUse, property)
+			}
+
+			if err := expandKeyword(active, activeProperty, property, value, result, opts); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		def := active.Terms[key]
+
+		var expanded interface{}
+
+		switch {
+		case def != nil && def.Container == "@language" && isMap(value):
+			expanded, err = expandLanguageMap(value.(map[string]interface{}))
+
+		case def != nil && def.Container == "@index" && isMap(value):
+			expanded, err = expandIndexMap(active, key, value.(map[string]interface{}), opts)
+
+		default:
+			expanded, err = expand(active, key, value, opts)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if expanded == nil {
+			continue
+		}
+
+		if def != nil && def.Container == "@list" && !isListObject(expanded) {
+			expanded = map[string]interface{}{"@list": asArray(expanded)}
+		}
+
+		if def != nil && def.Reverse {
+			reverse, _ := result["@reverse"].(map[string]interface{})
+			if reverse == nil {
+				reverse = map[string]interface{}{}
+				result["@reverse"] = reverse
+			}
+
+			for _, item := range asArray(expanded) {
+				if isValueObject(item) || isListObject(item) {
+					return nil, fmt.Errorf("%w: reverse property values must be node objects", ErrInvalidValue)
+				}
+			}
+
+			addValues(reverse, property, expanded)
+			continue
+		}
+
+		addValues(result, property, expanded)
+	}
+
+	return postProcess(activeProperty, result)
+}
+
+func expandKeyword(active *Context, activeProperty string, keyword string, value interface{}, result map[string]interface{}, opts *Options) error {
+
+	switch keyword {
+
+	case "@id":
+		id, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: @id must be a string", ErrInvalidKeywordUse)
+		}
+
+		expanded, err := active.expandIRI(id, true, false, nil, nil)
+		if err != nil {
+			return err
+		}
+		result["@id"] = expanded
+
+	case "@type":
+		var types []interface{}
+
+		for _, t := range asArray(value) {
+			s, ok := t.(string)
+			if !ok {
+				return fmt.Errorf("%w: @type must be a string or array of strings", ErrInvalidKeywordUse)
+			}
+
+			expanded, err := active.expandIRI(s, true, true, nil, nil)
+			if err != nil {
+				return err
+			}
+			types = append(types, expanded)
+		}
+
+		if existing, ok := result["@type"]; ok {
+			types = append(asArray(existing), types...)
+		}
+		result["@type"] = types
+
+	case "@graph":
+		expanded, err := expand(active, "@graph", value, opts)
+		if err != nil {
+			return err
+		}
+		result["@graph"] = asArray(expanded)
+
+	case "@value":
+		switch value.(type) {
+		case nil, string, bool, float64, json.Number, int, int64:
+		default:
+			return fmt.Errorf("%w: @value must be a scalar", ErrInvalidValue)
+		}
+		result["@value"] = value
+
+	case "@language":
+		lang, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: @language must be a string", ErrInvalidValue)
+		}
+		result["@language"] = strings.ToLower(lang)
+
+	case "@index":
+		index, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: @index must be a string", ErrInvalidValue)
+		}
+		result["@index"] = index
+
+	case "@list":
+		if activeProperty == "" || activeProperty == "@graph" {
+			return nil
+		}
+
+		expanded, err := expand(active, activeProperty, value, opts)
+		if err != nil {
+			return err
+		}
+
+		list := asArray(expanded)
+		for _, item := range list {
+			if isListObject(item) {
+				return unsupported(ErrInvalidKeywordUse, "a list of lists")
+			}
+		}
+		result["@list"] = list
+
+	case "@set":
+		expanded, err := expand(active, activeProperty, value, opts)
+		if err != nil {
+			return err
+		}
+		result["@set"] = expanded
+
+	case "@reverse":
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%w: @reverse must be an object", ErrInvalidKeywordUse)
+		}
+
+		expanded, err := expand(active, "@reverse", m, opts)
+		if err != nil {
+			return err
+		}
+
+		expandedMap, _ := expanded.(map[string]interface{})
+
+		// a @reverse inside @reverse points forward again
+		if nested, ok := expandedMap["@reverse"].(map[string]interface{}); ok {
+			for prop, items := range nested {
+				addValues(result, prop, items)
+			}
+			delete(expandedMap, "@reverse")
+		}
+
+		if len(expandedMap) > 0 {
+			reverse, _ := result["@reverse"].(map[string]interface{})
+			if reverse == nil {
+				reverse = map[string]interface{}{}
+				result["@reverse"] = reverse
+			}
+
+			for prop, items := range expandedMap {
+				for _, item := range asArray(items) {
+					if isValueObject(item) || isListObject(item) {
+						return fmt.Errorf("%w: reverse property values must be node objects", ErrInvalidValue)
+					}
+				}
+				addValues(reverse, prop, items)
+			}
+		}
+
+	case "@included", "@nest", "@json":
+		return unsupported(ErrInvalidKeywordUse, keyword)
+	}
+
+	return nil
+}
+
+// postProcess validates value, list and set objects and drops objects that carry no data
+func postProcess(activeProperty string, result map[string]interface{}) (interface{}, error) {
+
+	if value, ok := result["@value"]; ok {
+		for key := range result {
+			switch key {
+			case "@value", "@type", "@language", "@index":
+			default:
+				return nil, fmt.Errorf("%w: unexpected %s", ErrInvalidValue, key)
+			}
+		}
+
+		if _, ok := result["@type"]; ok {
+			if _, ok := result["@language"]; ok {
+				return nil, fmt.Errorf("%w: value has both @type and @language", ErrInvalidValue)
+			}
+
+			types := asArray(result["@type"])
+			if len(types) != 1 {
+				return nil, fmt.Errorf("%w: value must have a single @type", ErrInvalidValue)
+			}
+			t, _ := types[0].(string)
+			if !strings.Contains(t, ":") {
+				return nil, fmt.Errorf("%w: @type %s is not an IRI", ErrInvalidValue, t)
+			}
+			result["@type"] = t
+		}
+
+		if value == nil {
+			return nil, nil
+		}
+
+		if _, ok := result["@language"]; ok {
+			if _, ok := value.(string); !ok {
+				return nil, fmt.Errorf("%w: only strings may have a @language", ErrInvalidValue)
+			}
+		}
+
+	} else if _, ok := result["@list"]; ok {
+		for key := range result {
+			if key != "@list" && key != "@index" {
+				return nil, fmt.Errorf("%w: unexpected %s in list object", ErrInvalidKeywordUse, key)
+			}
+		}
+
+	} else if set, ok := result["@set"]; ok {
+		for key := range result {
+			if key != "@set" && key != "@index" {
+				return nil, fmt.Errorf("%w: unexpected %s in set object", ErrInvalidKeywordUse, key)
+			}
+		}
+		return set, nil
+
+	} else if len(result) == 1 {
+		// a language without a value carries no data
+		if _, ok := result["@language"]; ok {
+			return nil, nil
+		}
+	}
+
+	if activeProperty == "" || activeProperty == "@graph" {
+		if len(result) == 0 {
+			return nil, nil
+		}
+		if _, ok := result["@value"]; ok {
+			return nil, nil
+		}
+		if _, ok := result["@list"]; ok {
+			return nil, nil
+		}
+		if _, ok := result["@id"]; ok && len(result) == 1 && activeProperty == "" {
+			return nil, nil
+		}
+	}
+
+	return result, nil
+}
+
+// expandValue turns a scalar into a value object, or a node reference when the term is typed @id or @vocab
+func expandValue(active *Context, activeProperty string, value interface{}) (interface{}, error) {
+
+	def := active.Terms[activeProperty]
+
+	if s, ok := value.(string); ok && def != nil {
+		switch def.Type {
+		case "@id":
+			id, err := active.expandIRI(s, true, false, nil, nil)
+			return map[string]interface{}{"@id": id}, err
+		case "@vocab":
+			id, err := active.expandIRI(s, true, true, nil, nil)
+			return map[string]interface{}{"@id": id}, err
+		}
+	}
+
+	result := map[string]interface{}{"@value": value}
+
+	if def != nil && def.Type != "" && def.Type != "@id" && def.Type != "@vocab" && def.Type != "@none" {
+		result["@type"] = def.Type
+		return result, nil
+	}
+
+	if _, ok := value.(string); ok {
+		lang := active.Language
+		if def != nil && def.Language != nil {
+			lang = *def.Language
+		}
+		if lang != "" {
+			result["@language"] = lang
+		}
+	}
+
+	return result, nil
+}
+
+func expandLanguageMap(languages map[string]interface{}) (interface{}, error) {
+
+	var result []interface{}
+
+	for _, lang := range sortedKeys(languages) {
+		for _, item := range asArray(languages[lang]) {
+			if item == nil {
+				continue
+			}
+
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: language map values must be strings", ErrInvalidValue)
+			}
+
+			value := map[string]interface{}{"@value": s}
+			if lang != "@none" {
+				value["@language"] = strings.ToLower(lang)
+			}
+			result = append(result, value)
+		}
+	}
+
+	return result, nil
+}
+
+func expandIndexMap(active *Context, activeProperty string, index map[string]interface{}, opts *Options) (interface{}, error) {
+
+	var result []interface{}
+
+	for _, key := range sortedKeys(index) {
+		expanded, err := expand(active, activeProperty, asArray(index[key]), opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range asArray(expanded) {
+			if m, ok := item.(map[string]interface{}); ok {
+				if _, ok := m["@index"]; !ok && key != "@none" {
+					m["@index"] = key
+				}
+			}
+			result = append(result, item)
+		}
+	}
+
+	return result, nil
+}
+
+// addValues appends value, or each item when value is an array, to the array at key
+func addValues(m map[string]interface{}, key string, value interface{}) {
+
+	existing, _ := m[key].([]interface{})
+
+	if arr, ok := value.([]interface{}); ok {
+		m[key] = append(existing, arr...)
+	} else {
+		m[key] = append(existing, value)
+	}
+}
+
+func asArray(value interface{}) []interface{} {
+
+	if value == nil {
+		return []interface{}{}
+	}
+
+	if arr, ok := value.([]interface{}); ok {
+		return arr
+	}
+
+	return []interface{}{value}
+}
+
+func isMap(value interface{}) bool {
+	_, ok := value.(map[string]interface{})
+	return ok
+}
+
+func isValueObject(value interface{}) bool {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = m["@value"]
+	return ok
+}
+
+func isListObject(value interface{}) bool {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = m["@list"]
+	return ok
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
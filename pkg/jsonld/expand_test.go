@@ -0,0 +1,217 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(s), &doc); err != nil {
+		t.Fatalf("Failed to Parse Test Document: %s", err.Error())
+	}
+
+	return doc
+}
+
+type failTransport struct{}
+
+func (failTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("network is disabled")
+}
+
+func TestExpand(t *testing.T) {
+
+	loader := NewCachingLoader()
+	loader.Preload(map[string]interface{}{"@context": map[string]interface{}{"@vocab": "http://schema.org/"}}, "https://schema.org/")
+
+	opts := &Options{Loader: loader}
+
+	cases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "Vocab",
+			input: `{
+				"@context": {"@vocab": "http://schema.org/"},
+				"@id": "ark:99999/test",
+				"@type": "Dataset",
+				"name": "test",
+				"author": {"@id": "ark:99999/author", "name": "Max"}
+			}`,
+			expected: `[{
+				"@id": "ark:99999/test",
+				"@type": ["http://schema.org/Dataset"],
+				"http://schema.org/name": [{"@value": "test"}],
+				"http://schema.org/author": [{"@id": "ark:99999/author", "http://schema.org/name": [{"@value": "Max"}]}]
+			}]`,
+		},
+		{
+			name: "Terms",
+			input: `{
+				"@context": [
+					"https://schema.org/",
+					{
+						"evi": "https://w3id.org/EVI#",
+						"usedSoftware": {"@id": "evi:usedSoftware", "@type": "@id"},
+						"size": {"@id": "evi:size", "@type": "http://www.w3.org/2001/XMLSchema#integer"},
+						"keywords": {"@container": "@list"},
+						"label": {"@id": "evi:label", "@container": "@language"}
+					}
+				],
+				"@id": "ark:99999/comp",
+				"usedSoftware": "ark:99999/soft",
+				"size": 10,
+				"keywords": ["a", "b"],
+				"label": {"en": "Run", "FR": "Exécution"},
+				"evi:status": "done"
+			}`,
+			expected: `[{
+				"@id": "ark:99999/comp",
+				"https://w3id.org/EVI#usedSoftware": [{"@id": "ark:99999/soft"}],
+				"https://w3id.org/EVI#size": [{"@value": 10, "@type": "http://www.w3.org/2001/XMLSchema#integer"}],
+				"http://schema.org/keywords": [{"@list": [{"@value": "a"}, {"@value": "b"}]}],
+				"https://w3id.org/EVI#label": [{"@value": "Exécution", "@language": "fr"}, {"@value": "Run", "@language": "en"}],
+				"https://w3id.org/EVI#status": [{"@value": "done"}]
+			}]`,
+		},
+		{
+			name: "Dropped",
+			input: `{
+				"@context": {"name": "http://schema.org/name", "ignored": null},
+				"@id": "ark:99999/test",
+				"name": "test",
+				"ignored": "value",
+				"undefined": "value"
+			}`,
+			expected: `[{
+				"@id": "ark:99999/test",
+				"http://schema.org/name": [{"@value": "test"}]
+			}]`,
+		},
+		{
+			name: "Reverse",
+			input: `{
+				"@context": {"@vocab": "http://schema.org/", "hasPart": {"@reverse": "http://schema.org/isPartOf"}},
+				"@id": "ark:99999/project",
+				"hasPart": {"@id": "ark:99999/dataset"}
+			}`,
+			expected: `[{
+				"@id": "ark:99999/project",
+				"@reverse": {"http://schema.org/isPartOf": [{"@id": "ark:99999/dataset"}]}
+			}]`,
+		},
+		{
+			name: "Graph",
+			input: `{
+				"@context": {"@vocab": "http://schema.org/", "@base": "http://example.org/"},
+				"@graph": [{"@id": "a", "name": "A"}, {"@id": "b", "name": "B"}]
+			}`,
+			expected: `[
+				{"@id": "http://example.org/a", "http://schema.org/name": [{"@value": "A"}]},
+				{"@id": "http://example.org/b", "http://schema.org/name": [{"@value": "B"}]}
+			]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			expanded, err := Expand(decode(t, c.input), opts)
+			if err != nil {
+				t.Fatalf("Failed to Expand: %s", err.Error())
+			}
+
+			// round trip through json so numbers compare equal
+			out, _ := json.Marshal(expanded)
+			if got, expected := decode(t, string(out)), decode(t, c.expected); !reflect.DeepEqual(got, expected) {
+				t.Fatalf("Incorrect Expansion\ngot:      %s\nexpected: %s", out, c.expected)
+			}
+		})
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+
+		invalid := map[string]error{
+			`{"@context": {"a": "b", "b": "a"}, "a": 1}`:                                                                             ErrCyclicDefinition,
+			`{"@context": {"name": 5}, "name": 1}`:                                                                                   ErrInvalidContext,
+			`{"@context": {"name": {"@id": "notAnIRI"}}, "name": 1}`:                                                                 ErrInvalidIRI,
+			`{"@context": "http://example.org/unknown", "name": 1}`:                                                                  ErrRemoteContext,
+			`{"@context": {"@vocab": "http://schema.org/"}, "@id": 5}`:                                                               ErrInvalidKeywordUse,
+			`{"@context": {"@vocab": "http://schema.org/"}, "name": {"@value": "a", "@type": "x", "@language": "en"}}`:               ErrInvalidValue,
+			`{"@context": {"@import": "http://example.org/context"}, "name": 1}`:                                                     ErrInvalidContext,
+			`{"@context": {"@vocab": "http://schema.org/", "@propagate": false}, "name": 1}`:                                         ErrInvalidContext,
+			`{"@context": {"@vocab": "http://schema.org/", "@direction": "rtl"}, "name": 1}`:                                         ErrInvalidContext,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@context": {}}}, "name": 1}`:                                   ErrInvalidContext,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@nest": "@nest"}}, "name": 1}`:                                 ErrInvalidContext,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@type": "@json"}}, "name": 1}`:                                 ErrInvalidContext,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@container": "@id"}}, "name": 1}`:                              ErrInvalidContext,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@container": "@graph"}}, "name": 1}`:                           ErrInvalidContext,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@container": ["@graph", "@index"]}}, "name": 1}`:               ErrInvalidContext,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@container": ["@list", "@set"]}}, "name": 1}`:                  ErrInvalidContext,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@container": "@list"}}, "name": [[1]]}`:                        ErrInvalidKeywordUse,
+			`{"@context": {"@vocab": "http://schema.org/"}, "@included": []}`:                                                        ErrInvalidKeywordUse,
+			`{"@context": [{"@protected": true, "name": "http://schema.org/name"}, {"name": "http://example.org/name"}], "name": 1}`: ErrInvalidContext,
+			`{"@context": [{"@protected": true, "name": "http://schema.org/name"}, null], "name": 1}`:                                ErrInvalidContext,
+		}
+
+		// remote contexts are never fetched during tests
+		offline := NewCachingLoader()
+		offline.Client.Transport = failTransport{}
+
+		for input, expected := range invalid {
+			if _, err := Expand(decode(t, input), &Options{Loader: offline}); !errors.Is(err, expected) {
+				t.Fatalf("Expected %v Expanding %s, got %v", expected, input, err)
+			}
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+
+		// features that aren't implemented are told apart from invalid documents
+		unsupported := map[string]bool{
+			`{"@context": {"@import": "http://example.org/context"}, "name": 1}`:                                    true,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@container": "@graph"}}, "name": 1}`:          true,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@container": "@list"}}, "name": [[1]]}`:       true,
+			`{"@context": {"@vocab": "http://schema.org/"}, "@included": []}`:                                       true,
+			`{"@context": {"name": 5}, "name": 1}`:                                                                  false,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@container": "@unknown"}}, "name": 1}`:        false,
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@container": ["@list", "@set"]}}, "name": 1}`: false,
+		}
+
+		for input, expected := range unsupported {
+			if _, err := Expand(decode(t, input), opts); err == nil || errors.Is(err, ErrUnsupported) != expected {
+				t.Fatalf("Expected Unsupported %t Expanding %s, got %v", expected, input, err)
+			}
+		}
+	})
+
+	t.Run("Supported", func(t *testing.T) {
+
+		valid := []string{
+			`{"@context": {"name": {"@id": "http://schema.org/name", "@container": ["@set", "@language"]}}, "name": {"en": "a"}}`,
+			`{"@context": [{"@protected": true, "name": "http://schema.org/name"}, {"name": "http://schema.org/name"}], "name": 1}`,
+			`{"@context": {"@vocab": "http://schema.org/", "@propagate": true, "@direction": null}, "name": 1}`,
+		}
+
+		for _, input := range valid {
+			if _, err := Expand(decode(t, input), opts); err != nil {
+				t.Fatalf("Failed to Expand %s: %s", input, err.Error())
+			}
+		}
+	})
+
+}
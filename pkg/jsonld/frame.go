@@ -0,0 +1,522 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidFrame = errors.New("jsonld: invalid frame")
+
+// Embed options of a frame
+const (
+	EmbedAlways = "@always"
+	EmbedOnce   = "@once"
+	EmbedNever  = "@never"
+)
+
+// frame is an expanded frame. Unset flags are inherited from the enclosing frame.
+type frame struct {
+	hasID   bool
+	ids     []string
+	anyID   bool
+	hasType bool
+	types   []string
+	anyType bool
+
+	properties map[string]*propertyFrame
+
+	embed       string
+	explicit    *bool
+	requireAll  *bool
+	omitDefault *bool
+}
+
+// propertyFrame constrains one property of matching nodes
+type propertyFrame struct {
+	// frame filters and shapes the nodes the property refers to, nil matches anything
+	frame *frame
+	// none requires the property to be absent
+	none bool
+	// defaultValue is the expanded value used when a node doesn't have the property
+	defaultValue []interface{}
+	hasDefault   bool
+}
+
+// framingState carries the flags in effect and the nodes embedded so far
+type framingState struct {
+	nodes       map[string]map[string]interface{}
+	embed       string
+	explicit    bool
+	requireAll  bool
+	omitDefault bool
+	embedded    map[string]bool
+	stack       []string
+}
+
+// Frame shapes an expanded document: every node matching frame is returned, with the nodes it refers to embedded
+// as the frame describes, compacted with the frame's @context. Nodes are embedded once, later references to a node
+// are left as references, and references that would repeat a node that is being embedded break the cycle.
+// Value patterns are not supported, a frame only matches on @id, @type and the presence of properties.
+func Frame(expanded []interface{}, frameDoc map[string]interface{}, opts *Options) (map[string]interface{}, error) {
+
+	active, err := NewContext(opts).Parse(frameDoc["@context"], opts)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := expandFrame(active, frameDoc, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	nm := generateNodeMap(expanded, newBlankNodeIssuer())
+
+	state := &framingState{
+		nodes:    nm[defaultGraph],
+		embed:    EmbedOnce,
+		embedded: map[string]bool{},
+	}
+
+	var results []interface{}
+	state.frame(sortedNodeIDs(state.nodes), f, func(output interface{}) {
+		results = append(results, output)
+	}, true)
+
+	pruneBlankNodes(results)
+
+	return Compact(results, frameDoc["@context"], opts)
+}
+
+func expandFrame(active *Context, local map[string]interface{}, opts *Options) (*frame, error) {
+
+	if ctx, ok := local["@context"]; ok {
+		var err error
+		if active, err = active.Parse(ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	f := &frame{properties: map[string]*propertyFrame{}}
+
+	for _, key := range sortedKeys(local) {
+		value := local[key]
+
+		property, err := active.expandIRI(key, false, true, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		switch property {
+
+		case "@context":
+
+		case "@id":
+			f.hasID = true
+			for _, item := range asArray(value) {
+				switch v := item.(type) {
+				case string:
+					id, err := active.expandIRI(v, true, false, nil, nil)
+					if err != nil {
+						return nil, err
+					}
+					f.ids = append(f.ids, id)
+				case map[string]interface{}:
+					if len(v) != 0 {
+						return nil, fmt.Errorf("%w: @id must be an IRI or {}", ErrInvalidFrame)
+					}
+					f.anyID = true
+				default:
+					return nil, fmt.Errorf("%w: @id must be an IRI or {}", ErrInvalidFrame)
+				}
+			}
+
+		case "@type":
+			f.hasType = true
+			for _, item := range asArray(value) {
+				switch v := item.(type) {
+				case string:
+					t, err := active.expandIRI(v, true, true, nil, nil)
+					if err != nil {
+						return nil, err
+					}
+					f.types = append(f.types, t)
+				case map[string]interface{}:
+					// {} matches any type, and so does a type that is only a default
+					if _, ok := v["@default"]; len(v) != 0 && !ok {
+						return nil, fmt.Errorf("%w: @type must be an IRI or {}", ErrInvalidFrame)
+					}
+					f.anyType = true
+				default:
+					return nil, fmt.Errorf("%w: @type must be an IRI or {}", ErrInvalidFrame)
+				}
+			}
+
+		case "@embed":
+			switch value {
+			case EmbedAlways, EmbedOnce, EmbedNever:
+				f.embed = value.(string)
+			case "@last", true:
+				f.embed = EmbedOnce
+			case false:
+				f.embed = EmbedNever
+			default:
+				return nil, fmt.Errorf("%w: unknown @embed %v", ErrInvalidFrame, value)
+			}
+
+		case "@explicit", "@requireAll", "@omitDefault":
+			flag, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s must be a boolean", ErrInvalidFrame, property)
+			}
+			switch property {
+			case "@explicit":
+				f.explicit = &flag
+			case "@requireAll":
+				f.requireAll = &flag
+			default:
+				f.omitDefault = &flag
+			}
+
+		case "@default":
+
+		default:
+			if IsKeyword(property) {
+				return nil, unsupported(ErrInvalidFrame, property)
+			}
+
+			// properties that don't expand to an IRI can't match anything
+			if !strings.Contains(property, ":") {
+				continue
+			}
+
+			pf, err := expandPropertyFrame(active, key, value, opts)
+			if err != nil {
+				return nil, err
+			}
+			f.properties[property] = pf
+		}
+	}
+
+	return f, nil
+}
+
+func expandPropertyFrame(active *Context, key string, value interface{}, opts *Options) (*propertyFrame, error) {
+
+	pf := &propertyFrame{}
+
+	if items, ok := value.([]interface{}); ok {
+		if len(items) == 0 {
+			pf.none = true
+			return pf, nil
+		}
+		value = items[0]
+	}
+
+	sub, ok := value.(map[string]interface{})
+	if !ok {
+		// value patterns aren't supported, any value of the property matches
+		return pf, nil
+	}
+
+	if list, ok := sub["@list"]; ok {
+		sub = map[string]interface{}{}
+		if items := asArray(list); len(items) > 0 {
+			if m, ok := items[0].(map[string]interface{}); ok {
+				sub = m
+			}
+		}
+	}
+
+	if def, ok := sub["@default"]; ok {
+		pf.hasDefault = true
+		if def != "@null" {
+			expanded, err := expand(active, key, def, opts)
+			if err != nil {
+				return nil, err
+			}
+			pf.defaultValue = asArray(expanded)
+		}
+	}
+
+	if _, ok := sub["@value"]; ok {
+		return pf, nil
+	}
+
+	var err error
+	pf.frame, err = expandFrame(active, sub, opts)
+	return pf, err
+}
+
+// frame adds the nodes among ids matching f to the output, top is set for the nodes of the top level frame
+func (s *framingState) frame(ids []string, f *frame, add func(interface{}), top bool) {
+
+	embed, explicit, requireAll, omitDefault := s.flags(f)
+
+	for _, id := range ids {
+		node, ok := s.nodes[id]
+		if !ok || !f.matches(node, requireAll) {
+			continue
+		}
+
+		if top {
+			s.embedded = map[string]bool{}
+		}
+
+		if !top && (embed == EmbedNever || s.onStack(id) || embed == EmbedOnce && s.embedded[id]) {
+			add(map[string]interface{}{"@id": id})
+			continue
+		}
+		s.embedded[id] = true
+
+		s.stack = append(s.stack, id)
+		output := map[string]interface{}{"@id": id}
+
+		for _, property := range sortedKeys(node) {
+			if property == "@id" {
+				continue
+			}
+
+			if IsKeyword(property) {
+				output[property] = node[property]
+				continue
+			}
+
+			pf, framed := f.properties[property]
+			if explicit && !framed {
+				continue
+			}
+
+			subframe := s.implicitFrame(pf)
+
+			for _, item := range asArray(node[property]) {
+				property := property
+
+				if list, ok := listItems(item); ok {
+					var values []interface{}
+					for _, listItem := range asArray(list) {
+						if ref, ok := nodeReference(listItem); ok {
+							s.frame([]string{ref}, subframe, func(v interface{}) { values = append(values, v) }, false)
+						} else {
+							values = append(values, listItem)
+						}
+					}
+					addValues(output, property, map[string]interface{}{"@list": values})
+					continue
+				}
+
+				if ref, ok := nodeReference(item); ok {
+					s.frame([]string{ref}, subframe, func(v interface{}) { addValues(output, property, v) }, false)
+					continue
+				}
+
+				addValues(output, property, item)
+			}
+		}
+
+		// properties of the frame the node doesn't have take their default
+		for _, property := range sortedFrameProperties(f) {
+			pf := f.properties[property]
+			if _, ok := output[property]; ok || pf.none {
+				continue
+			}
+
+			omit := omitDefault
+			if pf.frame != nil && pf.frame.omitDefault != nil {
+				omit = *pf.frame.omitDefault
+			}
+
+			if !omit && len(pf.defaultValue) > 0 {
+				output[property] = pf.defaultValue
+			}
+		}
+
+		s.stack = s.stack[:len(s.stack)-1]
+		add(output)
+	}
+}
+
+// flags returns the flags of f, falling back to the ones in effect
+func (s *framingState) flags(f *frame) (embed string, explicit bool, requireAll bool, omitDefault bool) {
+
+	embed, explicit, requireAll, omitDefault = s.embed, s.explicit, s.requireAll, s.omitDefault
+
+	if f.embed != "" {
+		embed = f.embed
+	}
+	if f.explicit != nil {
+		explicit = *f.explicit
+	}
+	if f.requireAll != nil {
+		requireAll = *f.requireAll
+	}
+	if f.omitDefault != nil {
+		omitDefault = *f.omitDefault
+	}
+
+	return
+}
+
+// implicitFrame is the frame for the values of a property, nodes are matched by an empty frame when the property
+// has none
+func (s *framingState) implicitFrame(pf *propertyFrame) *frame {
+	if pf != nil && pf.frame != nil {
+		return pf.frame
+	}
+	return &frame{properties: map[string]*propertyFrame{}}
+}
+
+func (s *framingState) onStack(id string) bool {
+	for _, stacked := range s.stack {
+		if stacked == id {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether a node matches the frame. Without @requireAll a match on @id or @type is enough,
+// otherwise every constraint must hold. A frame without constraints matches every node.
+func (f *frame) matches(node map[string]interface{}, requireAll bool) bool {
+
+	id, _ := node["@id"].(string)
+	types := asArray(node["@type"])
+
+	if f.hasID {
+		match := f.anyID
+		for _, candidate := range f.ids {
+			match = match || candidate == id
+		}
+		if !requireAll || !match {
+			return match
+		}
+	}
+
+	if f.hasType {
+		var match bool
+		switch {
+		case len(f.types) == 0 && !f.anyType:
+			match = len(types) == 0
+		case f.anyType:
+			match = len(types) > 0 || len(f.types) == 0
+		}
+		for _, candidate := range f.types {
+			for _, t := range types {
+				match = match || t == candidate
+			}
+		}
+		if !requireAll || !match {
+			return match
+		}
+	}
+
+	wildcard := true
+	matchesSome := false
+
+	for _, property := range sortedFrameProperties(f) {
+		pf := f.properties[property]
+		values := asArray(node[property])
+		wildcard = false
+
+		if len(values) == 0 && pf.hasDefault {
+			continue
+		}
+
+		if pf.none {
+			if len(values) > 0 {
+				return false
+			}
+			matchesSome = true
+			continue
+		}
+
+		match := len(values) > 0
+		if !match && requireAll {
+			return false
+		}
+		matchesSome = matchesSome || match
+	}
+
+	return wildcard || matchesSome || requireAll
+}
+
+func sortedFrameProperties(f *frame) []string {
+	properties := make([]string, 0, len(f.properties))
+	for property := range f.properties {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+	return properties
+}
+
+// listItems returns the items of a list object
+func listItems(value interface{}) (interface{}, bool) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	list, ok := m["@list"]
+	return list, ok
+}
+
+// nodeReference returns the @id of a node reference
+func nodeReference(value interface{}) (string, bool) {
+	m, ok := value.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", false
+	}
+	id, ok := m["@id"].(string)
+	return id, ok
+}
+
+// pruneBlankNodes removes the @id of blank nodes that are only mentioned once in the framed output
+func pruneBlankNodes(output []interface{}) {
+
+	counts := map[string]int{}
+
+	var count func(value interface{})
+	count = func(value interface{}) {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				count(item)
+			}
+		case map[string]interface{}:
+			for key, item := range v {
+				if id, ok := item.(string); ok && key == "@id" && isBlankNode(id) {
+					counts[id]++
+				} else if key != "@id" {
+					count(item)
+				}
+			}
+		}
+	}
+	count(output)
+
+	var prune func(value interface{})
+	prune = func(value interface{}) {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				prune(item)
+			}
+		case map[string]interface{}:
+			if id, ok := v["@id"].(string); ok && isBlankNode(id) && counts[id] == 1 && len(v) > 1 {
+				delete(v, "@id")
+			}
+			for key, item := range v {
+				if key != "@id" {
+					prune(item)
+				}
+			}
+		}
+	}
+	prune(output)
+}
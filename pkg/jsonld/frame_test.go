@@ -0,0 +1,115 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const testGraph = `{
+	"@context": {"@vocab": "http://schema.org/"},
+	"@graph": [
+		{"@id": "ark:99999/data", "@type": "Dataset", "name": "data", "author": {"name": "Max"}, "generatedBy": {"@id": "ark:99999/comp"}},
+		{"@id": "ark:99999/comp", "@type": "Computation", "name": "comp", "usedSoftware": {"@id": "ark:99999/soft"}, "generated": {"@id": "ark:99999/data"}},
+		{"@id": "ark:99999/soft", "@type": "Software", "name": "soft"},
+		{"@id": "ark:99999/other", "@type": "Dataset", "name": "other", "usedSoftware": {"@id": "ark:99999/soft"}}
+	]
+}`
+
+func TestFrame(t *testing.T) {
+
+	expanded, err := Expand(decode(t, testGraph), nil)
+	if err != nil {
+		t.Fatalf("Failed to Expand: %s", err.Error())
+	}
+
+	frame := func(t *testing.T, frameDoc string) map[string]interface{} {
+		framed, err := Frame(expanded, decode(t, frameDoc).(map[string]interface{}), nil)
+		if err != nil {
+			t.Fatalf("Failed to Frame: %s", err.Error())
+		}
+
+		// round trip through JSON so the result compares with decoded documents
+		b, _ := json.Marshal(framed)
+		return decode(t, string(b)).(map[string]interface{})
+	}
+
+	t.Run("Embed", func(t *testing.T) {
+
+		framed := frame(t, `{"@context": {"@vocab": "http://schema.org/"}, "@id": "ark:99999/data"}`)
+
+		expected := decode(t, `{
+			"@context": {"@vocab": "http://schema.org/"},
+			"@id": "ark:99999/data",
+			"@type": "Dataset",
+			"name": "data",
+			"author": {"name": "Max"},
+			"generatedBy": {
+				"@id": "ark:99999/comp",
+				"@type": "Computation",
+				"name": "comp",
+				"generated": {"@id": "ark:99999/data"},
+				"usedSoftware": {"@id": "ark:99999/soft", "@type": "Software", "name": "soft"}
+			}
+		}`)
+
+		if !reflect.DeepEqual(framed, expected) {
+			b, _ := json.Marshal(framed)
+			t.Fatalf("Incorrect Frame: %s", b)
+		}
+	})
+
+	t.Run("Type", func(t *testing.T) {
+
+		framed := frame(t, `{"@context": {"@vocab": "http://schema.org/"}, "@type": "Dataset", "@explicit": true, "name": {}, "license": {"@default": "none"}}`)
+
+		graph, ok := framed["@graph"].([]interface{})
+		if !ok || len(graph) != 2 {
+			t.Fatalf("Expected both Datasets: %v", framed)
+		}
+
+		other := graph[1].(map[string]interface{})
+		expected := map[string]interface{}{"@id": "ark:99999/other", "@type": "Dataset", "name": "other", "license": "none"}
+		if !reflect.DeepEqual(other, expected) {
+			t.Fatalf("Explicit Frame Included Other Properties: %v", other)
+		}
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+
+		// only references to Software are embedded, the frame matches nodes that use software
+		framed := frame(t, `{"@context": {"@vocab": "http://schema.org/"}, "usedSoftware": {"@type": "Software", "@embed": "@never"}}`)
+
+		graph := framed["@graph"].([]interface{})
+		if len(graph) != 2 {
+			t.Fatalf("Expected the Nodes using Software: %v", framed)
+		}
+
+		for _, node := range graph {
+			used := node.(map[string]interface{})["usedSoftware"]
+			if !reflect.DeepEqual(used, map[string]interface{}{"@id": "ark:99999/soft"}) {
+				t.Fatalf("Software was Embedded: %v", used)
+			}
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+
+		for _, frameDoc := range []string{
+			`{"@type": 5}`,
+			`{"@embed": "@sometimes"}`,
+			`{"@explicit": "yes"}`,
+		} {
+			if _, err := Frame(expanded, decode(t, frameDoc).(map[string]interface{}), nil); !errors.Is(err, ErrInvalidFrame) {
+				t.Fatalf("Invalid Frame %s was Accepted: %v", frameDoc, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,214 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrContextNotAllowed = errors.New("jsonld: remote context is not allowed")
+	ErrPrivateAddress    = errors.New("jsonld: remote context resolves to a private address")
+)
+
+// DocumentLoader retrieves remote context documents
+type DocumentLoader interface {
+	LoadDocument(url string) (interface{}, error)
+}
+
+// CachingLoader fetches remote documents over http and keeps the most recently used ones. Only documents that were
+// allowed by URL are fetched, from public addresses, so the documents a caller names can't make the loader reach
+// anything else. Documents can be preloaded so well known contexts never touch the network, preloaded documents
+// are never evicted.
+type CachingLoader struct {
+	Client *http.Client
+	// MaxDocuments is how many fetched documents are kept
+	MaxDocuments int
+
+	mu        sync.Mutex
+	allowed   map[string]bool
+	preloaded map[string]interface{}
+	cache     map[string]*list.Element
+	recent    *list.List
+}
+
+type cachedDocument struct {
+	url string
+	doc interface{}
+}
+
+// DefaultLoader is used when Options don't set a Loader, it fetches nothing that wasn't allowed
+var DefaultLoader = NewCachingLoader()
+
+// maxDocumentSize limits the size of remote documents
+const maxDocumentSize = 1 << 20
+
+// defaultMaxDocuments is how many fetched documents a new loader keeps
+const defaultMaxDocuments = 100
+
+// NewCachingLoader returns a loader with an empty cache that fetches no URLs until they are allowed, with a 10
+// second timeout and refusing to connect to loopback, private and link local addresses
+func NewCachingLoader() *CachingLoader {
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: refusePrivate}
+	transport := &http.Transport{
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+
+	l := &CachingLoader{
+		Client:       &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		MaxDocuments: defaultMaxDocuments,
+		allowed:      map[string]bool{},
+		preloaded:    map[string]interface{}{},
+		cache:        map[string]*list.Element{},
+		recent:       list.New(),
+	}
+
+	// redirects are followed only to other allowed documents
+	l.Client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 || !l.isAllowed(req.URL.String()) {
+			return fmt.Errorf("%w: redirect to %s", ErrContextNotAllowed, req.URL.String())
+		}
+		return nil
+	}
+
+	return l
+}
+
+// refusePrivate ends a connection to an address that isn't public, it is checked after the host is resolved so a
+// name can't be pointed at a private address between checking and connecting
+func refusePrivate(network string, address string, conn syscall.RawConn) error {
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+
+	return nil
+}
+
+// Allow lets the loader fetch the documents at urls
+func (l *CachingLoader) Allow(urls ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, url := range urls {
+		l.allowed[url] = true
+	}
+}
+
+func (l *CachingLoader) isAllowed(url string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.allowed[url]
+}
+
+// Preload stores doc as the document for each url
+func (l *CachingLoader) Preload(doc interface{}, urls ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, url := range urls {
+		l.preloaded[url] = doc
+	}
+}
+
+// LoadDocument returns the preloaded or cached document for url, fetching it when it is allowed and hasn't been
+// loaded recently
+func (l *CachingLoader) LoadDocument(url string) (doc interface{}, err error) {
+
+	if doc, ok := l.lookup(url); ok {
+		return doc, nil
+	}
+
+	if !l.isAllowed(url) {
+		return nil, fmt.Errorf("%w: %s", ErrContextNotAllowed, url)
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/ld+json, application/json")
+
+	resp, err := l.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+
+	dec := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize))
+	dec.UseNumber()
+
+	if err = dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	l.store(url, doc)
+
+	return
+}
+
+func (l *CachingLoader) lookup(url string) (interface{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if doc, ok := l.preloaded[url]; ok {
+		return doc, true
+	}
+
+	if elem, ok := l.cache[url]; ok {
+		l.recent.MoveToFront(elem)
+		return elem.Value.(*cachedDocument).doc, true
+	}
+
+	return nil, false
+}
+
+// store caches a fetched document, evicting the least recently used ones beyond MaxDocuments
+func (l *CachingLoader) store(url string, doc interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elem, ok := l.cache[url]; ok {
+		elem.Value.(*cachedDocument).doc = doc
+		l.recent.MoveToFront(elem)
+		return
+	}
+
+	l.cache[url] = l.recent.PushFront(&cachedDocument{url: url, doc: doc})
+
+	for l.recent.Len() > l.MaxDocuments && l.recent.Len() > 0 {
+		oldest := l.recent.Back()
+		l.recent.Remove(oldest)
+		delete(l.cache, oldest.Value.(*cachedDocument).url)
+	}
+}
@@ -0,0 +1,88 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCachingLoader(t *testing.T) {
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/private", http.StatusFound)
+			return
+		}
+		w.Write([]byte(`{"@context": {"@vocab": "http://example.org/"}}`))
+	}))
+	defer server.Close()
+
+	t.Run("NotAllowed", func(t *testing.T) {
+
+		loader := NewCachingLoader()
+		loader.Client = server.Client()
+
+		if _, err := loader.LoadDocument(server.URL + "/context"); !errors.Is(err, ErrContextNotAllowed) {
+			t.Fatalf("Loaded a Context that was not Allowed: %v", err)
+		}
+
+		if requests != 0 {
+			t.Fatalf("Context that was not Allowed was Requested")
+		}
+	})
+
+	t.Run("Private", func(t *testing.T) {
+
+		loader := NewCachingLoader()
+		loader.Allow(server.URL + "/context")
+
+		if _, err := loader.LoadDocument(server.URL + "/context"); !errors.Is(err, ErrPrivateAddress) {
+			t.Fatalf("Loaded a Context from a Loopback Address: %v", err)
+		}
+	})
+
+	t.Run("Redirect", func(t *testing.T) {
+
+		loader := NewCachingLoader()
+		loader.Client.Transport = server.Client().Transport
+		loader.Allow(server.URL + "/redirect")
+
+		if _, err := loader.LoadDocument(server.URL + "/redirect"); !errors.Is(err, ErrContextNotAllowed) {
+			t.Fatalf("Followed a Redirect to a Context that was not Allowed: %v", err)
+		}
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+
+		loader := NewCachingLoader()
+		loader.Client.Transport = server.Client().Transport
+		loader.MaxDocuments = 1
+		loader.Allow(server.URL+"/one", server.URL+"/two")
+		loader.Preload(map[string]interface{}{}, "http://schema.org/")
+
+		requests = 0
+		for _, url := range []string{"/one", "/one", "/two", "/one"} {
+			if _, err := loader.LoadDocument(server.URL + url); err != nil {
+				t.Fatalf("Failed to Load %s: %s", url, err.Error())
+			}
+		}
+
+		// the second /one is cached, the last was evicted by /two
+		if requests != 3 {
+			t.Fatalf("Expected 3 Requests Found %d", requests)
+		}
+
+		if _, err := loader.LoadDocument("http://schema.org/"); err != nil || len(loader.cache) != 1 {
+			t.Fatalf("Preloaded Document was Evicted or Cache Exceeded its Size: %v, %d", err, len(loader.cache))
+		}
+	})
+}
@@ -0,0 +1,248 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const defaultGraph = "@default"
+
+// nodeMap holds every node object of an expanded document by graph name and @id,
+// with nested node objects replaced by references
+type nodeMap map[string]map[string]map[string]interface{}
+
+// blankNodeIssuer relabels blank nodes so the labels of a document are unique and deterministic
+type blankNodeIssuer struct {
+	counter int
+	issued  map[string]string
+}
+
+func newBlankNodeIssuer() *blankNodeIssuer {
+	return &blankNodeIssuer{issued: map[string]string{}}
+}
+
+// id returns the new label of an existing blank node, or a fresh label when old is empty
+func (i *blankNodeIssuer) id(old string) string {
+
+	if old != "" {
+		if issued, ok := i.issued[old]; ok {
+			return issued
+		}
+	}
+
+	id := fmt.Sprintf("_:b%d", i.counter)
+	i.counter++
+
+	if old != "" {
+		i.issued[old] = id
+	}
+
+	return id
+}
+
+func isBlankNode(id string) bool {
+	return strings.HasPrefix(id, "_:")
+}
+
+// generateNodeMap flattens an expanded document into a node map
+func generateNodeMap(expanded []interface{}, issuer *blankNodeIssuer) nodeMap {
+
+	nm := nodeMap{defaultGraph: {}}
+	nm.add(expanded, defaultGraph, "", nil, "", nil, issuer)
+
+	return nm
+}
+
+// add records element in graph. The element is the value of activeProperty on activeSubject,
+// or on reverseSubject when it is set, or an item of list when list is set.
+func (nm nodeMap) add(element interface{}, graph string, activeSubject string, reverseSubject map[string]interface{}, activeProperty string, list *[]interface{}, issuer *blankNodeIssuer) {
+
+	if arr, ok := element.([]interface{}); ok {
+		for _, item := range arr {
+			nm.add(item, graph, activeSubject, reverseSubject, activeProperty, list, issuer)
+		}
+		return
+	}
+
+	elem, ok := element.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if nm[graph] == nil {
+		nm[graph] = map[string]map[string]interface{}{}
+	}
+	graphMap := nm[graph]
+
+	if _, ok := elem["@value"]; ok {
+		if list != nil {
+			*list = append(*list, elem)
+		} else if node := graphMap[activeSubject]; node != nil {
+			addUnique(node, activeProperty, elem)
+		}
+		return
+	}
+
+	if items, ok := elem["@list"]; ok {
+		result := []interface{}{}
+		nm.add(items, graph, activeSubject, reverseSubject, activeProperty, &result, issuer)
+
+		listObject := map[string]interface{}{"@list": result}
+		if list != nil {
+			*list = append(*list, listObject)
+		} else if node := graphMap[activeSubject]; node != nil {
+			addValues(node, activeProperty, listObject)
+		}
+		return
+	}
+
+	// node object
+	id, _ := elem["@id"].(string)
+	if id == "" || isBlankNode(id) {
+		id = issuer.id(id)
+	}
+
+	node := graphMap[id]
+	if node == nil {
+		node = map[string]interface{}{"@id": id}
+		graphMap[id] = node
+	}
+
+	switch {
+	case reverseSubject != nil:
+		addUnique(node, activeProperty, reverseSubject)
+	case activeProperty != "":
+		reference := map[string]interface{}{"@id": id}
+		if list != nil {
+			*list = append(*list, reference)
+		} else if subject := graphMap[activeSubject]; subject != nil {
+			addUnique(subject, activeProperty, reference)
+		}
+	}
+
+	for _, t := range asArray(elem["@type"]) {
+		if s, ok := t.(string); ok {
+			if isBlankNode(s) {
+				s = issuer.id(s)
+			}
+			addUnique(node, "@type", s)
+		}
+	}
+
+	if index, ok := elem["@index"]; ok {
+		node["@index"] = index
+	}
+
+	if reverse, ok := elem["@reverse"].(map[string]interface{}); ok {
+		referenced := map[string]interface{}{"@id": id}
+		for _, property := range sortedKeys(reverse) {
+			nm.add(reverse[property], graph, "", referenced, property, nil, issuer)
+		}
+	}
+
+	if g, ok := elem["@graph"]; ok {
+		nm.add(g, id, "", nil, "", nil, issuer)
+	}
+
+	for _, property := range sortedKeys(elem) {
+		if IsKeyword(property) {
+			continue
+		}
+
+		name := property
+		if isBlankNode(name) {
+			name = issuer.id(name)
+		}
+
+		if _, ok := node[name]; !ok {
+			node[name] = []interface{}{}
+		}
+
+		nm.add(elem[property], graph, id, nil, name, nil, issuer)
+	}
+}
+
+// addUnique appends value to the array at key unless an equal value is already there
+func addUnique(m map[string]interface{}, key string, value interface{}) {
+
+	existing, _ := m[key].([]interface{})
+	for _, item := range existing {
+		if reflect.DeepEqual(item, value) {
+			return
+		}
+	}
+
+	m[key] = append(existing, value)
+}
+
+// Flatten returns the flattened form of an expanded document: every node object at the top level,
+// sorted by @id, with nested nodes replaced by references. Named graphs are kept in @graph of their node.
+func Flatten(expanded []interface{}) []interface{} {
+
+	nm := generateNodeMap(expanded, newBlankNodeIssuer())
+
+	defaultNodes := nm[defaultGraph]
+
+	for _, name := range sortedGraphNames(nm) {
+		if name == defaultGraph {
+			continue
+		}
+
+		node := defaultNodes[name]
+		if node == nil {
+			node = map[string]interface{}{"@id": name}
+			defaultNodes[name] = node
+		}
+		node["@graph"] = flattenGraph(nm[name])
+	}
+
+	return flattenGraph(defaultNodes)
+}
+
+func flattenGraph(graph map[string]map[string]interface{}) []interface{} {
+
+	flattened := []interface{}{}
+
+	for _, id := range sortedNodeIDs(graph) {
+		node := graph[id]
+
+		// nodes that are only referenced carry no statements of their own
+		if len(node) == 1 {
+			continue
+		}
+
+		flattened = append(flattened, node)
+	}
+
+	return flattened
+}
+
+func sortedGraphNames(nm nodeMap) []string {
+
+	names := make([]string, 0, len(nm))
+	for name := range nm {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func sortedNodeIDs(graph map[string]map[string]interface{}) []string {
+
+	ids := make([]string, 0, len(graph))
+	for id := range graph {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
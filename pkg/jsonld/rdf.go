@@ -0,0 +1,424 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"encoding/json"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ClarkLabUVA/mds/pkg/rdf"
+)
+
+// ToRDF converts an expanded document to RDF quads. Nodes and properties
+// that aren't absolute IRIs or blank nodes have no RDF representation and are skipped.
+func ToRDF(expanded []interface{}) []rdf.Quad {
+
+	issuer := newBlankNodeIssuer()
+	nm := generateNodeMap(expanded, issuer)
+
+	var quads []rdf.Quad
+
+	for _, graphName := range sortedGraphNames(nm) {
+
+		var graph rdf.Term
+		if graphName != defaultGraph {
+			var ok bool
+			if graph, ok = nodeTerm(graphName); !ok {
+				continue
+			}
+		}
+
+		nodes := nm[graphName]
+		for _, id := range sortedNodeIDs(nodes) {
+			subject, ok := nodeTerm(id)
+			if !ok {
+				continue
+			}
+
+			node := nodes[id]
+			for _, property := range sortedKeys(node) {
+
+				if property == "@type" {
+					for _, t := range asArray(node[property]) {
+						if object, ok := nodeTerm(t.(string)); ok {
+							quads = append(quads, rdf.Quad{Subject: subject, Predicate: rdf.NewIRI(rdf.RDFType), Object: object, Graph: graph})
+						}
+					}
+					continue
+				}
+
+				// blank node predicates would only be valid in generalized RDF
+				if IsKeyword(property) || isBlankNode(property) || !isAbsoluteIRI(property) {
+					continue
+				}
+				predicate := rdf.NewIRI(property)
+
+				for _, item := range asArray(node[property]) {
+					var listQuads []rdf.Quad
+					object, ok := objectToRDF(item, issuer, &listQuads, graph)
+					if !ok {
+						continue
+					}
+
+					quads = append(quads, rdf.Quad{Subject: subject, Predicate: predicate, Object: object, Graph: graph})
+					quads = append(quads, listQuads...)
+				}
+			}
+		}
+	}
+
+	return quads
+}
+
+// nodeTerm returns the term for a node @id, which must be a blank node or an absolute IRI
+func nodeTerm(id string) (rdf.Term, bool) {
+
+	if isBlankNode(id) {
+		return rdf.NewBlankNode(id), true
+	}
+
+	if isAbsoluteIRI(id) {
+		return rdf.NewIRI(id), true
+	}
+
+	return rdf.Term{}, false
+}
+
+func isAbsoluteIRI(iri string) bool {
+	i := strings.Index(iri, ":")
+	return i > 0 && !strings.ContainsAny(iri[:i], "/?#") && !strings.ContainsAny(iri, " <>\"{}|\\^`")
+}
+
+func objectToRDF(item interface{}, issuer *blankNodeIssuer, listQuads *[]rdf.Quad, graph rdf.Term) (rdf.Term, bool) {
+
+	obj, ok := item.(map[string]interface{})
+	if !ok {
+		return rdf.Term{}, false
+	}
+
+	if list, ok := obj["@list"]; ok {
+		return listToRDF(asArray(list), issuer, listQuads, graph), true
+	}
+
+	value, ok := obj["@value"]
+	if !ok {
+		id, _ := obj["@id"].(string)
+		return nodeTerm(id)
+	}
+
+	datatype, _ := obj["@type"].(string)
+	language, _ := obj["@language"].(string)
+
+	switch v := value.(type) {
+
+	case bool:
+		if datatype == "" {
+			datatype = rdf.XSDBoolean
+		}
+		return rdf.NewLiteral(strconv.FormatBool(v), datatype, ""), true
+
+	case float64, json.Number, int, int64:
+		lexical, numberType := numberLexical(v, datatype)
+		if datatype == "" {
+			datatype = numberType
+		}
+		return rdf.NewLiteral(lexical, datatype, ""), true
+
+	case string:
+		if datatype != "" {
+			return rdf.NewLiteral(v, datatype, ""), true
+		}
+		return rdf.NewLiteral(v, "", language), true
+	}
+
+	return rdf.Term{}, false
+}
+
+// listToRDF writes a list as an rdf:first/rdf:rest chain and returns its head
+func listToRDF(list []interface{}, issuer *blankNodeIssuer, quads *[]rdf.Quad, graph rdf.Term) rdf.Term {
+
+	if len(list) == 0 {
+		return rdf.NewIRI(rdf.RDFNil)
+	}
+
+	nodes := make([]rdf.Term, len(list))
+	for i := range list {
+		nodes[i] = rdf.NewBlankNode(issuer.id(""))
+	}
+
+	for i, item := range list {
+		var nested []rdf.Quad
+		if object, ok := objectToRDF(item, issuer, &nested, graph); ok {
+			*quads = append(*quads, rdf.Quad{Subject: nodes[i], Predicate: rdf.NewIRI(rdf.RDFFirst), Object: object, Graph: graph})
+			*quads = append(*quads, nested...)
+		}
+
+		rest := rdf.NewIRI(rdf.RDFNil)
+		if i+1 < len(nodes) {
+			rest = nodes[i+1]
+		}
+		*quads = append(*quads, rdf.Quad{Subject: nodes[i], Predicate: rdf.NewIRI(rdf.RDFRest), Object: rest, Graph: graph})
+	}
+
+	return nodes[0]
+}
+
+// numberLexical returns the canonical lexical form of a JSON number, an xsd:integer when it has no fractional part
+// and fits, otherwise an xsd:double, unless datatype asks for a double
+func numberLexical(value interface{}, datatype string) (lexical string, numberType string) {
+
+	var f float64
+	integer := ""
+
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case int:
+		f, integer = float64(v), strconv.Itoa(v)
+	case int64:
+		f, integer = float64(v), strconv.FormatInt(v, 10)
+	case json.Number:
+		f, _ = v.Float64()
+		if !strings.ContainsAny(v.String(), ".eE") {
+			integer = strings.TrimPrefix(v.String(), "+")
+		}
+	}
+
+	if datatype != rdf.XSDDouble && (integer != "" || (f == math.Trunc(f) && math.Abs(f) < 1e21)) {
+		if integer == "" {
+			integer = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return integer, rdf.XSDInteger
+	}
+
+	return canonicalDouble(f), rdf.XSDDouble
+}
+
+// canonicalDouble formats f like 1.5E1, with a fractional part on the mantissa and no padding on the exponent
+func canonicalDouble(f float64) string {
+
+	s := strconv.FormatFloat(f, 'E', -1, 64)
+
+	i := strings.Index(s, "E")
+	if i < 0 {
+		// NaN and infinities
+		return s
+	}
+
+	mantissa, exponent := s[:i], s[i+1:]
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+
+	exp, _ := strconv.Atoi(exponent)
+
+	return mantissa + "E" + strconv.Itoa(exp)
+}
+
+var jsonInteger = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+
+// usage records where a node is referenced, so lists can be rebuilt from rdf:first/rdf:rest chains
+type usage struct {
+	node     map[string]interface{}
+	property string
+	value    map[string]interface{}
+}
+
+// FromRDF converts RDF quads to an expanded document, with one node object per subject. Well formed
+// rdf:first/rdf:rest chains become lists, and with useNativeTypes xsd:integer, xsd:double and xsd:boolean
+// literals become JSON numbers and booleans.
+func FromRDF(quads []rdf.Quad, useNativeTypes bool) []interface{} {
+
+	graphs := map[string]map[string]map[string]interface{}{defaultGraph: {}}
+	usages := map[string]map[string][]usage{}
+
+	node := func(graph map[string]map[string]interface{}, id string) map[string]interface{} {
+		if _, ok := graph[id]; !ok {
+			graph[id] = map[string]interface{}{"@id": id}
+		}
+		return graph[id]
+	}
+
+	for _, q := range quads {
+
+		graphName := defaultGraph
+		if !q.Graph.IsZero() {
+			graphName = termID(q.Graph)
+			node(graphs[defaultGraph], graphName)
+		}
+
+		if _, ok := graphs[graphName]; !ok {
+			graphs[graphName] = map[string]map[string]interface{}{}
+		}
+		if _, ok := usages[graphName]; !ok {
+			usages[graphName] = map[string][]usage{}
+		}
+		graph := graphs[graphName]
+
+		subject := node(graph, termID(q.Subject))
+
+		if q.Object.Kind != rdf.Literal {
+			node(graph, termID(q.Object))
+		}
+
+		if q.Predicate.Value == rdf.RDFType && q.Object.Kind != rdf.Literal {
+			addUnique(subject, "@type", termID(q.Object))
+			continue
+		}
+
+		value := rdfToObject(q.Object, useNativeTypes)
+		before := len(asArray(subject[q.Predicate.Value]))
+		addUnique(subject, q.Predicate.Value, value)
+
+		// duplicate statements aren't additional references
+		if q.Object.Kind != rdf.Literal && len(asArray(subject[q.Predicate.Value])) > before {
+			id := termID(q.Object)
+			usages[graphName][id] = append(usages[graphName][id], usage{subject, q.Predicate.Value, value})
+		}
+	}
+
+	for graphName, graph := range graphs {
+		convertLists(graph, usages[graphName])
+	}
+
+	var result []interface{}
+
+	defaultNodes := graphs[defaultGraph]
+	for _, id := range sortedNodeIDs(defaultNodes) {
+		n := defaultNodes[id]
+
+		if named, ok := graphs[id]; ok && id != defaultGraph {
+			var members []interface{}
+			for _, memberID := range sortedNodeIDs(named) {
+				if member := named[memberID]; len(member) > 1 {
+					members = append(members, member)
+				}
+			}
+			n["@graph"] = members
+		}
+
+		// nodes that are only referenced carry no statements of their own
+		if len(n) > 1 {
+			result = append(result, n)
+		}
+	}
+
+	return result
+}
+
+// termID is the node identifier of an IRI or blank node
+func termID(t rdf.Term) string {
+	if t.Kind == rdf.BlankNode {
+		return "_:" + t.Value
+	}
+	return t.Value
+}
+
+func rdfToObject(t rdf.Term, useNativeTypes bool) map[string]interface{} {
+
+	if t.Kind != rdf.Literal {
+		return map[string]interface{}{"@id": termID(t)}
+	}
+
+	switch {
+	case t.Language != "":
+		return map[string]interface{}{"@value": t.Value, "@language": t.Language}
+	case t.Datatype == rdf.XSDString || t.Datatype == "":
+		return map[string]interface{}{"@value": t.Value}
+	}
+
+	if useNativeTypes {
+		switch t.Datatype {
+		case rdf.XSDBoolean:
+			if t.Value == "true" || t.Value == "false" {
+				return map[string]interface{}{"@value": t.Value == "true"}
+			}
+		case rdf.XSDInteger:
+			if jsonInteger.MatchString(t.Value) {
+				return map[string]interface{}{"@value": json.Number(t.Value)}
+			}
+		case rdf.XSDDouble:
+			if f, err := strconv.ParseFloat(t.Value, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+				return map[string]interface{}{"@value": f}
+			}
+		}
+	}
+
+	return map[string]interface{}{"@value": t.Value, "@type": t.Datatype}
+}
+
+// convertLists replaces references to rdf:first/rdf:rest chains of blank nodes with @list objects
+func convertLists(graph map[string]map[string]interface{}, usages map[string][]usage) {
+
+	if _, ok := graph[rdf.RDFNil]; !ok {
+		return
+	}
+
+	for _, u := range usages[rdf.RDFNil] {
+
+		n, property, head := u.node, u.property, u.value
+		var list []interface{}
+		var listNodes []string
+
+		for property == rdf.RDFRest && isListNode(n, usages) {
+			id := n["@id"].(string)
+			list = append(list, asArray(n[rdf.RDFFirst])[0])
+			listNodes = append(listNodes, id)
+
+			next := usages[id][0]
+			n, property, head = next.node, next.property, next.value
+		}
+
+		// a list may be the object of rdf:first, but a chain that is itself a list node's rest can't be converted
+		if property == rdf.RDFRest {
+			continue
+		}
+
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+
+		delete(head, "@id")
+		head["@list"] = list
+
+		for _, id := range listNodes {
+			delete(graph, id)
+		}
+	}
+}
+
+// isListNode reports whether n is a blank node that is referenced once and only holds a list's first and rest
+func isListNode(n map[string]interface{}, usages map[string][]usage) bool {
+
+	id, _ := n["@id"].(string)
+	if !isBlankNode(id) || len(usages[id]) != 1 {
+		return false
+	}
+
+	for key, value := range n {
+		switch key {
+		case "@id":
+		case rdf.RDFFirst, rdf.RDFRest:
+			if len(asArray(value)) != 1 {
+				return false
+			}
+		case "@type":
+			if types := asArray(value); len(types) != 1 || types[0] != rdf.RDFNamespace+"List" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	_, first := n[rdf.RDFFirst]
+	_, rest := n[rdf.RDFRest]
+	return first && rest
+}
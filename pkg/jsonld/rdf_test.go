@@ -0,0 +1,153 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package jsonld
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ClarkLabUVA/mds/pkg/rdf"
+)
+
+const testDocument = `{
+	"@context": {
+		"@vocab": "http://schema.org/",
+		"prov": "http://www.w3.org/ns/prov#",
+		"usedSoftware": {"@id": "prov:used", "@type": "@id"},
+		"size": {"@id": "contentSize", "@type": "http://www.w3.org/2001/XMLSchema#integer"}
+	},
+	"@id": "ark:99999/comp",
+	"@type": "Action",
+	"name": "computation",
+	"usedSoftware": "ark:99999/soft",
+	"size": 10,
+	"score": 1.5,
+	"keywords": {"@list": ["a", "b"]},
+	"agent": {"name": "Max", "url": "https://example.org/max"}
+}`
+
+func TestRDF(t *testing.T) {
+
+	expanded, err := Expand(decode(t, testDocument), nil)
+	if err != nil {
+		t.Fatalf("Failed to Expand: %s", err.Error())
+	}
+
+	t.Run("ToRDF", func(t *testing.T) {
+
+		var out bytes.Buffer
+		rdf.WriteNQuads(&out, ToRDF(expanded))
+
+		expected := `_:b0 <http://schema.org/name> "Max" .
+_:b0 <http://schema.org/url> "https://example.org/max" .
+<ark:99999/comp> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://schema.org/Action> .
+<ark:99999/comp> <http://schema.org/agent> _:b0 .
+<ark:99999/comp> <http://schema.org/contentSize> "10"^^<http://www.w3.org/2001/XMLSchema#integer> .
+<ark:99999/comp> <http://schema.org/keywords> _:b1 .
+_:b1 <http://www.w3.org/1999/02/22-rdf-syntax-ns#first> "a" .
+_:b1 <http://www.w3.org/1999/02/22-rdf-syntax-ns#rest> _:b2 .
+_:b2 <http://www.w3.org/1999/02/22-rdf-syntax-ns#first> "b" .
+_:b2 <http://www.w3.org/1999/02/22-rdf-syntax-ns#rest> <http://www.w3.org/1999/02/22-rdf-syntax-ns#nil> .
+<ark:99999/comp> <http://schema.org/name> "computation" .
+<ark:99999/comp> <http://schema.org/score> "1.5E0"^^<http://www.w3.org/2001/XMLSchema#double> .
+<ark:99999/comp> <http://www.w3.org/ns/prov#used> <ark:99999/soft> .
+`
+		if out.String() != expected {
+			t.Fatalf("Incorrect Quads\ngot:\n%s\nexpected:\n%s", out.String(), expected)
+		}
+	})
+
+	t.Run("Flatten", func(t *testing.T) {
+
+		flattened := Flatten(expanded)
+		if len(flattened) != 2 {
+			t.Fatalf("Flattened Document should have 2 Nodes: %+v", flattened)
+		}
+
+		comp := flattened[1].(map[string]interface{})
+		agent := comp["http://schema.org/agent"].([]interface{})[0]
+		if !reflect.DeepEqual(agent, map[string]interface{}{"@id": "_:b0"}) {
+			t.Fatalf("Nested Node was not Replaced by a Reference: %+v", agent)
+		}
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+
+		doc := decode(t, testDocument).(map[string]interface{})
+
+		compacted, err := Compact(expanded, doc["@context"], nil)
+		if err != nil {
+			t.Fatalf("Failed to Compact: %s", err.Error())
+		}
+
+		// the list keeps its list object because keywords isn't a @list container
+		original, _ := json.Marshal(doc)
+		roundTrip, _ := json.Marshal(compacted)
+		if !reflect.DeepEqual(decode(t, string(original)), decode(t, string(roundTrip))) {
+			t.Fatalf("Compaction did not Round Trip\ngot:      %s\nexpected: %s", roundTrip, original)
+		}
+
+		compacted, err = Compact(expanded, map[string]interface{}{"schema": "http://schema.org/"}, nil)
+		if err != nil {
+			t.Fatalf("Failed to Compact: %s", err.Error())
+		}
+		if compacted["schema:name"] != "computation" || compacted["@type"] != "schema:Action" {
+			t.Fatalf("Compact IRIs were not Used: %+v", compacted)
+		}
+	})
+
+	t.Run("FromRDF", func(t *testing.T) {
+
+		nodes := FromRDF(ToRDF(expanded), true)
+		if len(nodes) != 2 {
+			t.Fatalf("Expected 2 Nodes: %+v", nodes)
+		}
+
+		comp := nodes[1].(map[string]interface{})
+		if comp["@id"] != "ark:99999/comp" || !reflect.DeepEqual(comp["@type"], []interface{}{"http://schema.org/Action"}) {
+			t.Fatalf("Incorrect Node: %+v", comp)
+		}
+
+		keywords := []interface{}{map[string]interface{}{"@list": []interface{}{
+			map[string]interface{}{"@value": "a"},
+			map[string]interface{}{"@value": "b"},
+		}}}
+		if !reflect.DeepEqual(comp["http://schema.org/keywords"], keywords) {
+			t.Fatalf("List was not Rebuilt: %+v", comp["http://schema.org/keywords"])
+		}
+
+		if !reflect.DeepEqual(comp["http://schema.org/score"], []interface{}{map[string]interface{}{"@value": 1.5}}) {
+			t.Fatalf("Double was not Converted: %+v", comp["http://schema.org/score"])
+		}
+
+		typed := FromRDF(ToRDF(expanded), false)[1].(map[string]interface{})
+		size := []interface{}{map[string]interface{}{"@value": "10", "@type": rdf.XSDInteger}}
+		if !reflect.DeepEqual(typed["http://schema.org/contentSize"], size) {
+			t.Fatalf("Typed Literal was Converted: %+v", typed["http://schema.org/contentSize"])
+		}
+	})
+
+	t.Run("Numbers", func(t *testing.T) {
+
+		cases := map[interface{}][2]string{
+			float64(5):         {"5", rdf.XSDInteger},
+			float64(-0.25):     {"-2.5E-1", rdf.XSDDouble},
+			float64(1e21):      {"1.0E21", rdf.XSDDouble},
+			json.Number("12"):  {"12", rdf.XSDInteger},
+			json.Number("2.5"): {"2.5E0", rdf.XSDDouble},
+		}
+
+		for value, expected := range cases {
+			if lexical, datatype := numberLexical(value, ""); lexical != expected[0] || datatype != expected[1] {
+				t.Fatalf("Incorrect Lexical Form for %v: %s %s", value, lexical, datatype)
+			}
+		}
+	})
+
+}
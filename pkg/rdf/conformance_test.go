@@ -0,0 +1,207 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package rdf
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The conformance tests run the manifests of the W3C RDF 1.1 test suite, https://github.com/w3c/rdf-tests, when
+// RDF_TEST_SUITE is the rdf/rdf11 directory of a checkout. RDF_TEST_BASE is the IRI the suite is published at.
+const (
+	defaultRDFTestBase = "https://w3c.github.io/rdf-tests/rdf/rdf11/"
+	mfNamespace        = "http://www.w3.org/2001/sw/DataAccess/tests/test-manifest#"
+	rdftNamespace      = "http://www.w3.org/ns/rdftest#"
+)
+
+type conformanceTest struct {
+	id     string
+	name   string
+	types  []string
+	action string
+	result string
+}
+
+// readManifest returns the entries of the manifest in dir, base is the IRI the manifest is published at
+func readManifest(t *testing.T, dir string, base string) []conformanceTest {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join(dir, "manifest.ttl"))
+	if err != nil {
+		t.Fatalf("Failed to Open Manifest: %s", err.Error())
+	}
+	defer f.Close()
+
+	quads, _, err := ParseTurtle(f, base)
+	if err != nil {
+		t.Fatalf("Failed to Parse Manifest: %s", err.Error())
+	}
+
+	properties := map[Term]map[string][]Term{}
+	for _, q := range quads {
+		if properties[q.Subject] == nil {
+			properties[q.Subject] = map[string][]Term{}
+		}
+		properties[q.Subject][q.Predicate.Value] = append(properties[q.Subject][q.Predicate.Value], q.Object)
+	}
+
+	first := func(subject Term, predicate string) Term {
+		if values := properties[subject][predicate]; len(values) > 0 {
+			return values[0]
+		}
+		return Term{}
+	}
+
+	var tests []conformanceTest
+	for subject := range properties {
+		for _, list := range properties[subject][mfNamespace+"entries"] {
+			for ; list.Value != RDFNamespace+"nil" && !list.IsZero(); list = first(list, RDFNamespace+"rest") {
+				entry := first(list, RDFNamespace+"first")
+
+				test := conformanceTest{
+					id:     entry.Value,
+					name:   first(entry, mfNamespace+"name").Value,
+					action: first(entry, mfNamespace+"action").Value,
+					result: first(entry, mfNamespace+"result").Value,
+				}
+				for _, typ := range properties[entry][RDFType] {
+					test.types = append(test.types, strings.TrimPrefix(typ.Value, rdftNamespace))
+				}
+
+				tests = append(tests, test)
+			}
+		}
+	}
+
+	return tests
+}
+
+func TestConformance(t *testing.T) {
+
+	suite := os.Getenv("RDF_TEST_SUITE")
+	if suite == "" {
+		t.Skip("RDF_TEST_SUITE is not set")
+	}
+
+	testBase := os.Getenv("RDF_TEST_BASE")
+	if testBase == "" {
+		testBase = defaultRDFTestBase
+	}
+
+	parsers := map[string]func(path string, base string) ([]Quad, error){
+		"NTriples": func(path string, base string) ([]Quad, error) {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return ParseNTriples(f)
+		},
+		"NQuads": func(path string, base string) ([]Quad, error) {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return ParseNQuads(f)
+		},
+		"Turtle": func(path string, base string) ([]Quad, error) {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			quads, _, err := ParseTurtle(f, base)
+			return quads, err
+		},
+		"XML": func(path string, base string) ([]Quad, error) {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			quads, _, err := ParseRDFXML(f, base)
+			return quads, err
+		},
+	}
+
+	for _, dir := range []string{"rdf-n-triples", "rdf-n-quads", "rdf-turtle", "rdf-xml"} {
+		dir := dir
+
+		t.Run(dir, func(t *testing.T) {
+
+			if _, err := os.Stat(filepath.Join(suite, dir, "manifest.ttl")); err != nil {
+				t.Skipf("No Manifest in %s", filepath.Join(suite, dir))
+			}
+
+			base := testBase + dir + "/"
+			local := func(iri string) string {
+				return filepath.Join(suite, dir, filepath.FromSlash(strings.TrimPrefix(iri, base)))
+			}
+
+			for _, test := range readManifest(t, filepath.Join(suite, dir), base+"manifest.ttl") {
+				test := test
+
+				t.Run(strings.TrimPrefix(test.id, base+"manifest.ttl#"), func(t *testing.T) {
+
+					if len(test.types) != 1 {
+						t.Skipf("Unknown Test Type %v", test.types)
+					}
+
+					var format, kind string
+					for f := range parsers {
+						if strings.HasPrefix(test.types[0], "Test"+f) {
+							format, kind = f, strings.TrimPrefix(test.types[0], "Test"+f)
+						}
+					}
+
+					// N-Triples and N-Quads are read with the Turtle grammar, which accepts the syntax these tests reject
+					if format == "" || test.types[0] == "TestNTriplesNegativeSyntax" || test.types[0] == "TestNQuadsNegativeSyntax" {
+						t.Skipf("Unsupported Test Type %s", test.types[0])
+					}
+
+					quads, err := parsers[format](local(test.action), test.action)
+
+					switch kind {
+					case "PositiveSyntax":
+						if err != nil {
+							t.Fatalf("Failed to Parse %s: %s", test.name, err.Error())
+						}
+
+					case "NegativeSyntax", "NegativeEval":
+						if err == nil {
+							t.Fatalf("Parsed Invalid Document %s", test.name)
+						}
+
+					case "Eval":
+						if err != nil {
+							t.Fatalf("Failed to Parse %s: %s", test.name, err.Error())
+						}
+
+						expected, err := parsers["NTriples"](local(test.result), test.result)
+						if err != nil {
+							t.Fatalf("Failed to Parse Expected Result of %s: %s", test.name, err.Error())
+						}
+
+						if !Isomorphic(quads, expected) {
+							var out bytes.Buffer
+							WriteNQuads(&out, quads)
+							t.Fatalf("Incorrect Triples for %s\n%s", test.name, out.String())
+						}
+
+					default:
+						t.Skipf("Unsupported Test Type %s", test.types[0])
+					}
+				})
+			}
+		})
+	}
+}
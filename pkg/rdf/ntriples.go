@@ -0,0 +1,109 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package rdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteNTriples writes the quads of the default graph as N-Triples
+func WriteNTriples(w io.Writer, quads []Quad) error {
+
+	bw := bufio.NewWriter(w)
+
+	for _, q := range quads {
+		if !q.Graph.IsZero() {
+			continue
+		}
+		fmt.Fprintf(bw, "%s %s %s .\n", formatTerm(q.Subject), formatTerm(q.Predicate), formatTerm(q.Object))
+	}
+
+	return bw.Flush()
+}
+
+// WriteNQuads writes every quad as N-Quads
+func WriteNQuads(w io.Writer, quads []Quad) error {
+
+	bw := bufio.NewWriter(w)
+
+	for _, q := range quads {
+		if q.Graph.IsZero() {
+			fmt.Fprintf(bw, "%s %s %s .\n", formatTerm(q.Subject), formatTerm(q.Predicate), formatTerm(q.Object))
+		} else {
+			fmt.Fprintf(bw, "%s %s %s %s .\n", formatTerm(q.Subject), formatTerm(q.Predicate), formatTerm(q.Object), formatTerm(q.Graph))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// formatTerm writes a term the way N-Triples, N-Quads and Turtle spell it out in full
+func formatTerm(t Term) string {
+
+	switch t.Kind {
+	case IRI:
+		return "<" + escapeIRI(t.Value) + ">"
+	case BlankNode:
+		return "_:" + t.Value
+	}
+
+	lit := `"` + escapeString(t.Value) + `"`
+
+	switch {
+	case t.Language != "":
+		return lit + "@" + t.Language
+	case t.Datatype == XSDString || t.Datatype == "":
+		return lit
+	}
+
+	return lit + "^^<" + escapeIRI(t.Datatype) + ">"
+}
+
+func escapeIRI(iri string) string {
+
+	var b strings.Builder
+	for _, r := range iri {
+		switch {
+		case r <= 0x20, strings.ContainsRune("<>\"{}|^`\\", r):
+			fmt.Fprintf(&b, "\\u%04X", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func escapeString(s string) string {
+
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, "\\u%04X", r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,263 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package rdf is a minimal RDF data model with readers and writers for the serializations MDS exchanges:
+// N-Triples, N-Quads, Turtle and RDF/XML.
+package rdf
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Common vocabulary IRIs
+const (
+	RDFNamespace  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	XSDNamespace  = "http://www.w3.org/2001/XMLSchema#"
+	RDFType       = RDFNamespace + "type"
+	RDFFirst      = RDFNamespace + "first"
+	RDFRest       = RDFNamespace + "rest"
+	RDFNil        = RDFNamespace + "nil"
+	RDFLangString = RDFNamespace + "langString"
+	XSDString     = XSDNamespace + "string"
+	XSDBoolean    = XSDNamespace + "boolean"
+	XSDInteger    = XSDNamespace + "integer"
+	XSDDouble     = XSDNamespace + "double"
+	XSDDecimal    = XSDNamespace + "decimal"
+)
+
+var (
+	ErrSyntax          = errors.New("rdf: syntax error")
+	ErrUnserializable  = errors.New("rdf: graph can not be serialized")
+	ErrUnsupportedType = errors.New("rdf: unsupported media type")
+)
+
+// TermKind distinguishes IRIs, blank nodes and literals
+type TermKind int
+
+const (
+	IRI TermKind = iota
+	BlankNode
+	Literal
+)
+
+// Term is a node or literal in a graph.
+// Blank node values don't include the _: prefix, literals always have a Datatype.
+type Term struct {
+	Kind     TermKind
+	Value    string
+	Datatype string
+	Language string
+}
+
+// NewIRI returns an IRI term
+func NewIRI(iri string) Term {
+	return Term{Kind: IRI, Value: iri}
+}
+
+// NewBlankNode returns a blank node term, label may include the _: prefix
+func NewBlankNode(label string) Term {
+	return Term{Kind: BlankNode, Value: strings.TrimPrefix(label, "_:")}
+}
+
+// NewLiteral returns a literal, a language tag sets the datatype to rdf:langString and an empty datatype is xsd:string
+func NewLiteral(value string, datatype string, language string) Term {
+
+	if language != "" {
+		datatype = RDFLangString
+	} else if datatype == "" {
+		datatype = XSDString
+	}
+
+	return Term{Kind: Literal, Value: value, Datatype: datatype, Language: language}
+}
+
+// IsZero reports whether the term is unset, which as a graph name means the default graph
+func (t Term) IsZero() bool {
+	return t == Term{}
+}
+
+// Quad is a triple in a graph, the zero Graph is the default graph
+type Quad struct {
+	Subject   Term
+	Predicate Term
+	Object    Term
+	Graph     Term
+}
+
+// Subjects returns the distinct subjects of the quads in the default graph, in the order they first appear
+func Subjects(quads []Quad) (subjects []Term) {
+
+	seen := map[Term]bool{}
+	for _, q := range quads {
+		if q.Graph.IsZero() && !seen[q.Subject] {
+			seen[q.Subject] = true
+			subjects = append(subjects, q.Subject)
+		}
+	}
+
+	return
+}
+
+// SortQuads orders quads by graph, subject, predicate and object so output is deterministic
+func SortQuads(quads []Quad) {
+
+	key := func(t Term) string {
+		return string(rune('0'+t.Kind)) + t.Value + "\x00" + t.Datatype + "\x00" + t.Language
+	}
+
+	sort.SliceStable(quads, func(i, j int) bool {
+		a, b := quads[i], quads[j]
+		for _, pair := range [][2]Term{{a.Graph, b.Graph}, {a.Subject, b.Subject}, {a.Predicate, b.Predicate}, {a.Object, b.Object}} {
+			if ka, kb := key(pair[0]), key(pair[1]); ka != kb {
+				return ka < kb
+			}
+		}
+		return false
+	})
+}
+
+// Isomorphic reports whether two sets of quads are the same dataset once their blank nodes are relabelled.
+// Language tags are compared without regard to case.
+func Isomorphic(a []Quad, b []Quad) bool {
+
+	setA, setB := quadSet(a), quadSet(b)
+	if len(setA) != len(setB) {
+		return false
+	}
+
+	blanksA, blanksB := blankNodes(setA), blankNodes(setB)
+	if len(blanksA) != len(blanksB) {
+		return false
+	}
+
+	// a blank node can only map to one that appears in the same quads once blank nodes are ignored
+	signaturesA, signaturesB := map[string]string{}, map[string]string{}
+	for _, blank := range blanksA {
+		signaturesA[blank] = blankSignature(setA, blank)
+	}
+	for _, blank := range blanksB {
+		signaturesB[blank] = blankSignature(setB, blank)
+	}
+
+	mapping := map[string]string{}
+	used := map[string]bool{}
+
+	var match func(i int) bool
+	match = func(i int) bool {
+
+		if i == len(blanksA) {
+			for q := range setA {
+				if !setB[relabelQuad(q, mapping)] {
+					return false
+				}
+			}
+			return true
+		}
+
+		for _, candidate := range blanksB {
+			if used[candidate] || signaturesA[blanksA[i]] != signaturesB[candidate] {
+				continue
+			}
+
+			mapping[blanksA[i]], used[candidate] = candidate, true
+			if match(i + 1) {
+				return true
+			}
+			delete(mapping, blanksA[i])
+			used[candidate] = false
+		}
+
+		return false
+	}
+
+	return match(0)
+}
+
+func quadSet(quads []Quad) map[Quad]bool {
+
+	set := make(map[Quad]bool, len(quads))
+	for _, q := range quads {
+		q.Subject.Language, q.Object.Language = strings.ToLower(q.Subject.Language), strings.ToLower(q.Object.Language)
+		set[q] = true
+	}
+
+	return set
+}
+
+func blankNodes(set map[Quad]bool) (blanks []string) {
+
+	seen := map[string]bool{}
+	for q := range set {
+		for _, t := range []Term{q.Subject, q.Object, q.Graph} {
+			if t.Kind == BlankNode && !seen[t.Value] {
+				seen[t.Value] = true
+				blanks = append(blanks, t.Value)
+			}
+		}
+	}
+
+	sort.Strings(blanks)
+	return
+}
+
+// blankSignature lists the quads a blank node appears in with every blank node replaced by a placeholder
+func blankSignature(set map[Quad]bool, blank string) string {
+
+	mask := func(t Term) string {
+		switch {
+		case t.Kind != BlankNode:
+			return formatTerm(t)
+		case t.Value == blank:
+			return "_:self"
+		}
+		return "_:"
+	}
+
+	var quads []string
+	for q := range set {
+		if q.Subject.Kind == BlankNode && q.Subject.Value == blank || q.Object.Kind == BlankNode && q.Object.Value == blank ||
+			q.Graph.Kind == BlankNode && q.Graph.Value == blank {
+			quads = append(quads, mask(q.Subject)+" "+mask(q.Predicate)+" "+mask(q.Object)+" "+mask(q.Graph))
+		}
+	}
+
+	sort.Strings(quads)
+	return strings.Join(quads, "\n")
+}
+
+func relabelQuad(q Quad, mapping map[string]string) Quad {
+
+	relabel := func(t Term) Term {
+		if t.Kind == BlankNode {
+			t.Value = mapping[t.Value]
+		}
+		return t
+	}
+
+	return Quad{Subject: relabel(q.Subject), Predicate: q.Predicate, Object: relabel(q.Object), Graph: relabel(q.Graph)}
+}
+
+// MediaType of each serialization
+const (
+	MediaTypeNTriples = "application/n-triples"
+	MediaTypeNQuads   = "application/n-quads"
+	MediaTypeTurtle   = "text/turtle"
+	MediaTypeRDFXML   = "application/rdf+xml"
+)
+
+// splitIRI splits an IRI into a namespace ending in # / or : and a local name
+func splitIRI(iri string) (namespace string, local string) {
+
+	i := strings.LastIndexAny(iri, "#/:")
+	if i < 0 {
+		return "", iri
+	}
+
+	return iri[:i+1], iri[i+1:]
+}
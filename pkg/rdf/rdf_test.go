@@ -0,0 +1,332 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package rdf
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var testQuads = []Quad{
+	{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI(RDFType), Object: NewIRI("http://schema.org/Dataset")},
+	{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI("http://schema.org/name"), Object: NewLiteral("a \"quoted\"\nname", "", "")},
+	{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI("http://schema.org/description"), Object: NewLiteral("données", "", "fr")},
+	{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI("http://schema.org/contentSize"), Object: NewLiteral("10", XSDInteger, "")},
+	{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI("http://www.w3.org/ns/prov#wasGeneratedBy"), Object: NewBlankNode("_:b0")},
+	{Subject: NewBlankNode("b0"), Predicate: NewIRI("http://schema.org/name"), Object: NewLiteral("run", "", "")},
+	{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI("http://schema.org/name"), Object: NewLiteral("named", "", ""), Graph: NewIRI("ark:99999/graph")},
+}
+
+func TestWriters(t *testing.T) {
+
+	t.Run("NTriples", func(t *testing.T) {
+
+		var out bytes.Buffer
+		if err := WriteNTriples(&out, testQuads); err != nil {
+			t.Fatalf("Failed to Write N-Triples: %s", err.Error())
+		}
+
+		expected := `<ark:99999/test> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://schema.org/Dataset> .
+<ark:99999/test> <http://schema.org/name> "a \"quoted\"\nname" .
+<ark:99999/test> <http://schema.org/description> "données"@fr .
+<ark:99999/test> <http://schema.org/contentSize> "10"^^<http://www.w3.org/2001/XMLSchema#integer> .
+<ark:99999/test> <http://www.w3.org/ns/prov#wasGeneratedBy> _:b0 .
+_:b0 <http://schema.org/name> "run" .
+`
+		if out.String() != expected {
+			t.Fatalf("Incorrect N-Triples\n%s", out.String())
+		}
+
+		out.Reset()
+		WriteNQuads(&out, testQuads)
+		if !bytes.HasSuffix(out.Bytes(), []byte("<ark:99999/test> <http://schema.org/name> \"named\" <ark:99999/graph> .\n")) {
+			t.Fatalf("Named Graph Missing from N-Quads\n%s", out.String())
+		}
+	})
+
+	t.Run("Turtle", func(t *testing.T) {
+
+		var out bytes.Buffer
+		prefixes := map[string]string{"schema": "http://schema.org/", "prov": "http://www.w3.org/ns/prov#", "foaf": "http://xmlns.com/foaf/0.1/"}
+		if err := WriteTurtle(&out, testQuads, prefixes); err != nil {
+			t.Fatalf("Failed to Write Turtle: %s", err.Error())
+		}
+
+		expected := `@prefix prov: <http://www.w3.org/ns/prov#> .
+@prefix schema: <http://schema.org/> .
+
+<ark:99999/test> a schema:Dataset ;
+    schema:name "a \"quoted\"\nname" ;
+    schema:description "données"@fr ;
+    schema:contentSize 10 ;
+    prov:wasGeneratedBy _:b0 .
+
+_:b0 schema:name "run" .
+
+`
+		if out.String() != expected {
+			t.Fatalf("Incorrect Turtle\n%s", out.String())
+		}
+	})
+
+	t.Run("RDFXML", func(t *testing.T) {
+
+		var out bytes.Buffer
+		if err := WriteRDFXML(&out, testQuads, map[string]string{"schema": "http://schema.org/"}); err != nil {
+			t.Fatalf("Failed to Write RDF/XML: %s", err.Error())
+		}
+
+		for _, expected := range []string{
+			`xmlns:schema="http://schema.org/"`,
+			`<rdf:Description rdf:about="ark:99999/test">`,
+			`<rdf:type rdf:resource="http://schema.org/Dataset"/>`,
+			`<schema:name>a &#34;quoted&#34;&#xA;name</schema:name>`,
+			`<schema:description xml:lang="fr">données</schema:description>`,
+			`<schema:contentSize rdf:datatype="http://www.w3.org/2001/XMLSchema#integer">10</schema:contentSize>`,
+			`:wasGeneratedBy rdf:nodeID="b0"/>`,
+			`<rdf:Description rdf:nodeID="b0">`,
+		} {
+			if !bytes.Contains(out.Bytes(), []byte(expected)) {
+				t.Fatalf("RDF/XML is Missing %s\n%s", expected, out.String())
+			}
+		}
+
+		bad := []Quad{{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI("http://example.org/1"), Object: NewLiteral("x", "", "")}}
+		if err := WriteRDFXML(&out, bad, nil); !errors.Is(err, ErrUnserializable) {
+			t.Fatalf("Predicate without an XML Name was Written: %v", err)
+		}
+	})
+
+}
+
+// statements renders quads as N-Triples lines, labelling blank nodes in the order they appear
+func statements(quads []Quad) map[string]bool {
+
+	labels := map[string]string{}
+	relabel := func(t Term) Term {
+		if t.Kind == BlankNode {
+			if _, ok := labels[t.Value]; !ok {
+				labels[t.Value] = "b" + string(rune('0'+len(labels)))
+			}
+			t.Value = labels[t.Value]
+		}
+		return t
+	}
+
+	lines := map[string]bool{}
+	for _, q := range quads {
+		lines[formatTerm(relabel(q.Subject))+" "+formatTerm(q.Predicate)+" "+formatTerm(relabel(q.Object))] = true
+	}
+	return lines
+}
+
+func TestParsers(t *testing.T) {
+
+	t.Run("Turtle", func(t *testing.T) {
+
+		doc := `@prefix schema: <http://schema.org/> .
+PREFIX prov: <http://www.w3.org/ns/prov#>
+# a comment
+<> a schema:Dataset ;
+    schema:name "test", 'other'@EN ;
+    schema:description """two
+lines""" ;
+    schema:contentSize 10 ; schema:version 1.5 ; schema:size 2e3 ; schema:isAccessibleForFree true ;
+    schema:keywords ( "a" "b" ) ;
+    prov:wasGeneratedBy [ schema:name "run\t1" ] ;
+    schema:url <http://example.org/abc> ;
+    schema:identifier "x"^^<http://example.org/type> ;
+    .
+_:c schema:name "c" .
+`
+		quads, prefixes, err := ParseTurtle(bytes.NewBufferString(doc), "ark:99999/test")
+		if err != nil {
+			t.Fatalf("Failed to Parse Turtle: %s", err.Error())
+		}
+
+		if prefixes["prov"] != "http://www.w3.org/ns/prov#" || prefixes["schema"] != "http://schema.org/" {
+			t.Fatalf("Incorrect Prefixes: %v", prefixes)
+		}
+
+		lines := statements(quads)
+		for _, expected := range []string{
+			`<ark:99999/test> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://schema.org/Dataset>`,
+			`<ark:99999/test> <http://schema.org/name> "test"`,
+			`<ark:99999/test> <http://schema.org/name> "other"@en`,
+			`<ark:99999/test> <http://schema.org/description> "two\nlines"`,
+			`<ark:99999/test> <http://schema.org/contentSize> "10"^^<http://www.w3.org/2001/XMLSchema#integer>`,
+			`<ark:99999/test> <http://schema.org/version> "1.5"^^<http://www.w3.org/2001/XMLSchema#decimal>`,
+			`<ark:99999/test> <http://schema.org/size> "2e3"^^<http://www.w3.org/2001/XMLSchema#double>`,
+			`<ark:99999/test> <http://schema.org/isAccessibleForFree> "true"^^<http://www.w3.org/2001/XMLSchema#boolean>`,
+			`<ark:99999/test> <http://schema.org/keywords> _:b1`,
+			`_:b1 <http://www.w3.org/1999/02/22-rdf-syntax-ns#first> "a"`,
+			`_:b1 <http://www.w3.org/1999/02/22-rdf-syntax-ns#rest> _:b0`,
+			`_:b0 <http://www.w3.org/1999/02/22-rdf-syntax-ns#rest> <http://www.w3.org/1999/02/22-rdf-syntax-ns#nil>`,
+			`_:b2 <http://schema.org/name> "run\t1"`,
+			`<ark:99999/test> <http://schema.org/url> <http://example.org/abc>`,
+			`<ark:99999/test> <http://schema.org/identifier> "x"^^<http://example.org/type>`,
+			`_:b3 <http://schema.org/name> "c"`,
+		} {
+			if !lines[expected] {
+				t.Fatalf("Missing Statement %s\n%v", expected, lines)
+			}
+		}
+
+		if len(quads) != 18 {
+			t.Fatalf("Expected 18 Statements, found %d", len(quads))
+		}
+
+		for _, bad := range []string{
+			`<a> <b> "unterminated .`,
+			`undefined:a <b> <c> .`,
+			`<a> <b> <c>`,
+			`<a> <b> <c d> .`,
+		} {
+			if _, _, err := ParseTurtle(bytes.NewBufferString(bad), ""); !errors.Is(err, ErrSyntax) {
+				t.Fatalf("Invalid Turtle was Parsed: %s", bad)
+			}
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+
+		var defaultGraph []Quad
+		for _, q := range testQuads {
+			if q.Graph.IsZero() {
+				defaultGraph = append(defaultGraph, q)
+			}
+		}
+		expected := statements(defaultGraph)
+
+		var out bytes.Buffer
+		WriteNTriples(&out, testQuads)
+		quads, err := ParseNTriples(&out)
+		if err != nil || len(quads) != len(expected) {
+			t.Fatalf("Failed to Parse N-Triples: %v %v", quads, err)
+		}
+
+		out.Reset()
+		WriteTurtle(&out, testQuads, DefaultPrefixes)
+		turtle, _, err := ParseTurtle(&out, "")
+		if err != nil {
+			t.Fatalf("Failed to Parse Turtle: %s", err.Error())
+		}
+
+		out.Reset()
+		WriteRDFXML(&out, testQuads, DefaultPrefixes)
+		rdfxml, prefixes, err := ParseRDFXML(&out, "")
+		if err != nil {
+			t.Fatalf("Failed to Parse RDF/XML: %s", err.Error())
+		}
+
+		if prefixes["schema"] != "http://schema.org/" {
+			t.Fatalf("RDF/XML Namespaces were not Returned: %v", prefixes)
+		}
+
+		for name, parsed := range map[string][]Quad{"N-Triples": quads, "Turtle": turtle, "RDF/XML": rdfxml} {
+			lines := statements(parsed)
+			if len(lines) != len(expected) {
+				t.Fatalf("%s Round Trip has %d Statements\n%v", name, len(lines), lines)
+			}
+			for line := range expected {
+				if !lines[line] {
+					t.Fatalf("%s Round Trip is Missing %s\n%v", name, line, lines)
+				}
+			}
+		}
+	})
+
+	t.Run("NQuads", func(t *testing.T) {
+
+		var out bytes.Buffer
+		WriteNQuads(&out, testQuads)
+
+		quads, err := ParseNQuads(&out)
+		if err != nil {
+			t.Fatalf("Failed to Parse N-Quads: %s", err.Error())
+		}
+
+		if !Isomorphic(quads, testQuads) {
+			t.Fatalf("Incorrect Quads: %+v", quads)
+		}
+	})
+
+	t.Run("RDFXML", func(t *testing.T) {
+
+		doc := `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:schema="http://schema.org/" xml:base="ark:99999/test">
+  <schema:Dataset rdf:about="" schema:name="test">
+    <schema:author rdf:parseType="Resource">
+      <schema:name xml:lang="en">Author</schema:name>
+    </schema:author>
+    <schema:contentSize rdf:datatype="http://www.w3.org/2001/XMLSchema#integer">10</schema:contentSize>
+    <schema:keywords rdf:parseType="Collection">
+      <rdf:Description rdf:about="http://example.org/a"/>
+    </schema:keywords>
+    <schema:isPartOf>
+      <schema:Collection rdf:about="ark:99999/collection"/>
+    </schema:isPartOf>
+    <schema:license rdf:resource="http://example.org/license"/>
+  </schema:Dataset>
+</rdf:RDF>`
+
+		quads, _, err := ParseRDFXML(bytes.NewBufferString(doc), "")
+		if err != nil {
+			t.Fatalf("Failed to Parse RDF/XML: %s", err.Error())
+		}
+
+		lines := statements(quads)
+		for _, expected := range []string{
+			`<ark:99999/test> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://schema.org/Dataset>`,
+			`<ark:99999/test> <http://schema.org/name> "test"`,
+			`<ark:99999/test> <http://schema.org/author> _:b0`,
+			`_:b0 <http://schema.org/name> "Author"@en`,
+			`<ark:99999/test> <http://schema.org/contentSize> "10"^^<http://www.w3.org/2001/XMLSchema#integer>`,
+			`_:b1 <http://www.w3.org/1999/02/22-rdf-syntax-ns#first> <http://example.org/a>`,
+			`<ark:99999/test> <http://schema.org/keywords> _:b1`,
+			`<ark:99999/collection> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://schema.org/Collection>`,
+			`<ark:99999/test> <http://schema.org/isPartOf> <ark:99999/collection>`,
+			`<ark:99999/test> <http://schema.org/license> <http://example.org/license>`,
+		} {
+			if !lines[expected] {
+				t.Fatalf("Missing Statement %s\n%v", expected, lines)
+			}
+		}
+
+		if _, _, err := ParseRDFXML(bytes.NewBufferString(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description>`), ""); !errors.Is(err, ErrSyntax) {
+			t.Fatalf("Truncated RDF/XML was Parsed: %v", err)
+		}
+	})
+}
+
+func TestIsomorphic(t *testing.T) {
+
+	a := []Quad{
+		{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI("http://schema.org/author"), Object: NewBlankNode("a")},
+		{Subject: NewBlankNode("a"), Predicate: NewIRI("http://schema.org/name"), Object: NewLiteral("one", "", "")},
+		{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI("http://schema.org/author"), Object: NewBlankNode("b")},
+		{Subject: NewBlankNode("b"), Predicate: NewIRI("http://schema.org/name"), Object: NewLiteral("two", "", "EN")},
+	}
+
+	b := []Quad{
+		{Subject: NewBlankNode("x"), Predicate: NewIRI("http://schema.org/name"), Object: NewLiteral("two", "", "en")},
+		{Subject: NewBlankNode("y"), Predicate: NewIRI("http://schema.org/name"), Object: NewLiteral("one", "", "")},
+		{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI("http://schema.org/author"), Object: NewBlankNode("y")},
+		{Subject: NewIRI("ark:99999/test"), Predicate: NewIRI("http://schema.org/author"), Object: NewBlankNode("x")},
+	}
+
+	if !Isomorphic(a, b) {
+		t.Fatal("Relabelled Blank Nodes were not Isomorphic")
+	}
+
+	// the same quads with blank nodes ignored, but one author has both names
+	b[1].Subject = NewBlankNode("x")
+	if Isomorphic(a, b) {
+		t.Fatal("Different Graphs were Isomorphic")
+	}
+}
@@ -0,0 +1,123 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package rdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+)
+
+var xmlNCName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// WriteRDFXML writes the quads of the default graph as RDF/XML, one rdf:Description per subject.
+// Every predicate must end in a valid XML name, otherwise ErrUnserializable is returned.
+func WriteRDFXML(w io.Writer, quads []Quad, prefixes map[string]string) error {
+
+	if prefixes == nil {
+		prefixes = DefaultPrefixes
+	}
+
+	// namespaces are assigned their prefix, or a generated one, as predicates use them
+	names := map[string]string{RDFNamespace: "rdf"}
+	for name, ns := range prefixes {
+		if ns != RDFNamespace {
+			names[ns] = name
+		}
+	}
+	used := map[string]bool{RDFNamespace: true}
+
+	qname := func(iri string) (string, error) {
+		ns, local := splitIRI(iri)
+		if ns == "" || !xmlNCName.MatchString(local) {
+			return "", fmt.Errorf("%w: predicate %s has no valid XML name", ErrUnserializable, iri)
+		}
+
+		if _, ok := names[ns]; !ok {
+			names[ns] = fmt.Sprintf("ns%d", len(names))
+		}
+		used[ns] = true
+
+		return names[ns] + ":" + local, nil
+	}
+
+	var body bytes.Buffer
+
+	for _, subject := range Subjects(quads) {
+
+		body.WriteString("  <rdf:Description ")
+		body.WriteString(nodeAttribute("about", subject))
+		body.WriteString(">\n")
+
+		for _, q := range quads {
+			if !q.Graph.IsZero() || q.Subject != subject {
+				continue
+			}
+
+			name, err := qname(q.Predicate.Value)
+			if err != nil {
+				return err
+			}
+
+			switch q.Object.Kind {
+			case IRI, BlankNode:
+				fmt.Fprintf(&body, "    <%s %s/>\n", name, nodeAttribute("resource", q.Object))
+
+			case Literal:
+				body.WriteString("    <" + name)
+				if q.Object.Language != "" {
+					body.WriteString(` xml:lang="` + escapeXML(q.Object.Language) + `"`)
+				} else if q.Object.Datatype != XSDString {
+					body.WriteString(` rdf:datatype="` + escapeXML(q.Object.Datatype) + `"`)
+				}
+				body.WriteString(">" + escapeXML(q.Object.Value) + "</" + name + ">\n")
+			}
+		}
+
+		body.WriteString("  </rdf:Description>\n")
+	}
+
+	var declarations []string
+	for ns := range used {
+		declarations = append(declarations, fmt.Sprintf(`xmlns:%s="%s"`, names[ns], escapeXML(ns)))
+	}
+	sort.Strings(declarations)
+
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	out.WriteString("<rdf:RDF")
+	for _, d := range declarations {
+		out.WriteString("\n    " + d)
+	}
+	out.WriteString(">\n")
+	out.Write(body.Bytes())
+	out.WriteString("</rdf:RDF>\n")
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// nodeAttribute refers to a node with rdf:about or rdf:resource, or rdf:nodeID for blank nodes
+func nodeAttribute(attr string, t Term) string {
+
+	if t.Kind == BlankNode {
+		return `rdf:nodeID="` + escapeXML(t.Value) + `"`
+	}
+
+	return "rdf:" + attr + `="` + escapeXML(t.Value) + `"`
+}
+
+func escapeXML(s string) string {
+
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+
+	return b.String()
+}
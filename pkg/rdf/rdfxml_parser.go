@@ -0,0 +1,419 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package rdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	xmlNamespace    = "http://www.w3.org/XML/1998/namespace"
+	rdfXMLLiteral   = RDFNamespace + "XMLLiteral"
+	rdfDescription  = RDFNamespace + "Description"
+	rdfRDF          = RDFNamespace + "RDF"
+	rdfLi           = RDFNamespace + "li"
+	rdfMemberPrefix = RDFNamespace + "_"
+)
+
+// ParseRDFXML reads an RDF/XML document, resolving relative IRIs against base.
+// The namespaces the document declares are returned as prefixes.
+func ParseRDFXML(r io.Reader, base string) (quads []Quad, prefixes map[string]string, err error) {
+
+	p := &rdfxmlParser{
+		dec:      xml.NewDecoder(r),
+		prefixes: map[string]string{},
+		labels:   map[string]string{},
+	}
+
+	root, err := p.nextElement()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scope := xmlScope{base: base}
+
+	if elementIRI(root.Name) == rdfRDF {
+		scope = scope.enter(root)
+		for {
+			child, end, err := p.nextChild()
+			if err != nil {
+				return nil, nil, err
+			}
+			if end {
+				break
+			}
+			if _, err = p.nodeElement(child, scope); err != nil {
+				return nil, nil, err
+			}
+		}
+	} else if _, err = p.nodeElement(root, scope); err != nil {
+		return nil, nil, err
+	}
+
+	return p.quads, p.prefixes, nil
+}
+
+// xmlScope holds the base IRI and language inherited by an element
+type xmlScope struct {
+	base string
+	lang string
+}
+
+func (s xmlScope) enter(el xml.StartElement) xmlScope {
+	for _, attr := range el.Attr {
+		if attr.Name.Space != xmlNamespace {
+			continue
+		}
+		switch attr.Name.Local {
+		case "base":
+			s.base = ResolveIRI(s.base, attr.Value)
+		case "lang":
+			s.lang = strings.ToLower(attr.Value)
+		}
+	}
+	return s
+}
+
+type rdfxmlParser struct {
+	dec      *xml.Decoder
+	quads    []Quad
+	prefixes map[string]string
+	blanks   int
+	labels   map[string]string
+}
+
+func (p *rdfxmlParser) errorf(format string, args ...interface{}) error {
+	line, _ := p.dec.InputPos()
+	return fmt.Errorf("%w: line %d: %s", ErrSyntax, line, fmt.Sprintf(format, args...))
+}
+
+func (p *rdfxmlParser) token() (xml.Token, error) {
+
+	tok, err := p.dec.Token()
+	if err == io.EOF {
+		return nil, p.errorf("unexpected end of document")
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSyntax, err.Error())
+	}
+
+	if start, ok := tok.(xml.StartElement); ok {
+		for _, attr := range start.Attr {
+			if attr.Name.Space == "xmlns" {
+				p.prefixes[attr.Name.Local] = attr.Value
+			}
+		}
+	}
+
+	return tok, nil
+}
+
+// nextElement skips to the document's first element
+func (p *rdfxmlParser) nextElement() (xml.StartElement, error) {
+	for {
+		tok, err := p.token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+// nextChild returns the next child element, or end when the enclosing element closes. Only whitespace may
+// appear between elements.
+func (p *rdfxmlParser) nextChild() (child xml.StartElement, end bool, err error) {
+	for {
+		tok, err := p.token()
+		if err != nil {
+			return child, false, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t, false, nil
+		case xml.EndElement:
+			return child, true, nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return child, false, p.errorf("unexpected text %q", strings.TrimSpace(string(t)))
+			}
+		}
+	}
+}
+
+func (p *rdfxmlParser) emit(s, pr, o Term) {
+	p.quads = append(p.quads, Quad{Subject: s, Predicate: pr, Object: o})
+}
+
+func (p *rdfxmlParser) newBlank() Term {
+	p.blanks++
+	return NewBlankNode(fmt.Sprintf("x%d", p.blanks))
+}
+
+func (p *rdfxmlParser) blankLabel(label string) Term {
+	if mapped, ok := p.labels[label]; ok {
+		return NewBlankNode(mapped)
+	}
+	t := p.newBlank()
+	p.labels[label] = t.Value
+	return t
+}
+
+func elementIRI(name xml.Name) string {
+	return name.Space + name.Local
+}
+
+// isSyntaxAttribute reports whether attr is part of the RDF/XML syntax rather than a property
+func isSyntaxAttribute(attr xml.Attr) bool {
+	return attr.Name.Space == "xmlns" || attr.Name.Space == "" && attr.Name.Local == "xmlns" || attr.Name.Space == xmlNamespace
+}
+
+func (p *rdfxmlParser) nodeElement(el xml.StartElement, scope xmlScope) (subject Term, err error) {
+
+	scope = scope.enter(el)
+
+	if el.Name.Space == "" {
+		return subject, p.errorf("element %s has no namespace", el.Name.Local)
+	}
+
+	var properties []xml.Attr
+
+	for _, attr := range el.Attr {
+		switch {
+		case isSyntaxAttribute(attr):
+		case attr.Name.Space == RDFNamespace && attr.Name.Local == "about":
+			subject = NewIRI(ResolveIRI(scope.base, attr.Value))
+		case attr.Name.Space == RDFNamespace && attr.Name.Local == "ID":
+			subject = NewIRI(ResolveIRI(scope.base, "#"+attr.Value))
+		case attr.Name.Space == RDFNamespace && attr.Name.Local == "nodeID":
+			subject = p.blankLabel(attr.Value)
+		default:
+			properties = append(properties, attr)
+		}
+	}
+
+	if subject.IsZero() {
+		subject = p.newBlank()
+	}
+
+	if iri := elementIRI(el.Name); iri != rdfDescription {
+		p.emit(subject, NewIRI(RDFType), NewIRI(iri))
+	}
+
+	if err = p.propertyAttributes(subject, properties, scope); err != nil {
+		return
+	}
+
+	return subject, p.propertyElements(subject, scope)
+}
+
+// propertyAttributes emits the properties given as attributes, rdf:type is an IRI and the rest are literals
+func (p *rdfxmlParser) propertyAttributes(subject Term, attrs []xml.Attr, scope xmlScope) error {
+
+	for _, attr := range attrs {
+		if attr.Name.Space == "" {
+			return p.errorf("attribute %s has no namespace", attr.Name.Local)
+		}
+
+		predicate := elementIRI(attr.Name)
+		if predicate == RDFType {
+			p.emit(subject, NewIRI(predicate), NewIRI(ResolveIRI(scope.base, attr.Value)))
+			continue
+		}
+
+		p.emit(subject, NewIRI(predicate), NewLiteral(attr.Value, "", scope.lang))
+	}
+
+	return nil
+}
+
+// propertyElements reads the child elements of a node element as its properties
+func (p *rdfxmlParser) propertyElements(subject Term, scope xmlScope) error {
+
+	member := 0
+	for {
+		child, end, err := p.nextChild()
+		if err != nil || end {
+			return err
+		}
+
+		if err = p.propertyElement(subject, child, scope, &member); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *rdfxmlParser) propertyElement(subject Term, el xml.StartElement, scope xmlScope, member *int) error {
+
+	scope = scope.enter(el)
+
+	if el.Name.Space == "" {
+		return p.errorf("element %s has no namespace", el.Name.Local)
+	}
+
+	predicate := elementIRI(el.Name)
+	if predicate == rdfLi {
+		*member++
+		predicate = rdfMemberPrefix + strconv.Itoa(*member)
+	}
+
+	var (
+		object     Term
+		parseType  string
+		datatype   string
+		properties []xml.Attr
+	)
+
+	for _, attr := range el.Attr {
+		switch {
+		case isSyntaxAttribute(attr):
+		case attr.Name.Space == RDFNamespace && attr.Name.Local == "resource":
+			object = NewIRI(ResolveIRI(scope.base, attr.Value))
+		case attr.Name.Space == RDFNamespace && attr.Name.Local == "nodeID":
+			object = p.blankLabel(attr.Value)
+		case attr.Name.Space == RDFNamespace && attr.Name.Local == "parseType":
+			parseType = attr.Value
+		case attr.Name.Space == RDFNamespace && attr.Name.Local == "datatype":
+			datatype = ResolveIRI(scope.base, attr.Value)
+		case attr.Name.Space == RDFNamespace && attr.Name.Local == "ID":
+			// statements aren't reified
+		default:
+			properties = append(properties, attr)
+		}
+	}
+
+	switch parseType {
+	case "Resource":
+		node := p.newBlank()
+		p.emit(subject, NewIRI(predicate), node)
+		return p.propertyElements(node, scope)
+
+	case "Literal":
+		literal, err := p.innerXML()
+		if err != nil {
+			return err
+		}
+		p.emit(subject, NewIRI(predicate), NewLiteral(literal, rdfXMLLiteral, ""))
+		return nil
+
+	case "Collection":
+		var items []Term
+		for {
+			child, end, err := p.nextChild()
+			if err != nil {
+				return err
+			}
+			if end {
+				break
+			}
+			item, err := p.nodeElement(child, scope)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+
+		head := NewIRI(RDFNil)
+		for i := len(items) - 1; i >= 0; i-- {
+			node := p.newBlank()
+			p.emit(node, NewIRI(RDFFirst), items[i])
+			p.emit(node, NewIRI(RDFRest), head)
+			head = node
+		}
+		p.emit(subject, NewIRI(predicate), head)
+		return nil
+
+	case "":
+	default:
+		return p.errorf("unsupported parseType %s", parseType)
+	}
+
+	// the content is either text, a single node element, or empty
+	var text strings.Builder
+	for {
+		tok, err := p.token()
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			text.Write(t)
+
+		case xml.StartElement:
+			if strings.TrimSpace(text.String()) != "" || !object.IsZero() {
+				return p.errorf("property %s mixes text and elements", predicate)
+			}
+			if object, err = p.nodeElement(t, scope); err != nil {
+				return err
+			}
+			p.emit(subject, NewIRI(predicate), object)
+
+			if _, end, err := p.nextChild(); err != nil {
+				return err
+			} else if !end {
+				return p.errorf("property %s has more than one value", predicate)
+			}
+			return nil
+
+		case xml.EndElement:
+			if object.IsZero() && len(properties) == 0 {
+				p.emit(subject, NewIRI(predicate), NewLiteral(text.String(), datatype, scope.lang))
+				return nil
+			}
+
+			if strings.TrimSpace(text.String()) != "" {
+				return p.errorf("property %s has both a resource and text", predicate)
+			}
+
+			// an empty property element with property attributes describes a blank node
+			if object.IsZero() {
+				object = p.newBlank()
+			}
+			p.emit(subject, NewIRI(predicate), object)
+			return p.propertyAttributes(object, properties, scope)
+		}
+	}
+}
+
+// innerXML serializes the content of the current element up to its end tag
+func (p *rdfxmlParser) innerXML() (string, error) {
+
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+
+	depth := 0
+	for {
+		tok, err := p.token()
+		if err != nil {
+			return "", err
+		}
+
+		switch tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			if depth == 0 {
+				if err = enc.Flush(); err != nil {
+					return "", err
+				}
+				return buf.String(), nil
+			}
+			depth--
+		}
+
+		if err = enc.EncodeToken(xml.CopyToken(tok)); err != nil {
+			return "", fmt.Errorf("%w: %s", ErrSyntax, err.Error())
+		}
+	}
+}
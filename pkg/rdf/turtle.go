@@ -0,0 +1,160 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package rdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	turtleLocalName = regexp.MustCompile(`^([A-Za-z0-9_]([A-Za-z0-9_.-]*[A-Za-z0-9_-])?)?$`)
+	turtleInteger   = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	turtleDecimal   = regexp.MustCompile(`^[+-]?[0-9]*\.[0-9]+$`)
+	turtleDouble    = regexp.MustCompile(`^[+-]?([0-9]+\.[0-9]*|\.[0-9]+|[0-9]+)[eE][+-]?[0-9]+$`)
+)
+
+// DefaultPrefixes are used to abbreviate IRIs when a writer isn't given any
+var DefaultPrefixes = map[string]string{
+	"rdf":    RDFNamespace,
+	"xsd":    XSDNamespace,
+	"schema": "http://schema.org/",
+}
+
+// WriteTurtle writes the quads of the default graph as Turtle, abbreviating IRIs with prefixes
+func WriteTurtle(w io.Writer, quads []Quad, prefixes map[string]string) error {
+
+	if prefixes == nil {
+		prefixes = DefaultPrefixes
+	}
+
+	t := &turtleWriter{prefixes: prefixes, used: map[string]bool{}}
+
+	var body bytes.Buffer
+
+	for _, subject := range Subjects(quads) {
+
+		// group the objects of the subject by predicate, keeping the order they appear in
+		var predicates []Term
+		objects := map[Term][]Term{}
+
+		for _, q := range quads {
+			if !q.Graph.IsZero() || q.Subject != subject {
+				continue
+			}
+			if _, ok := objects[q.Predicate]; !ok {
+				predicates = append(predicates, q.Predicate)
+			}
+			objects[q.Predicate] = append(objects[q.Predicate], q.Object)
+		}
+
+		// rdf:type is written first as "a"
+		sort.SliceStable(predicates, func(i, j int) bool {
+			return predicates[i].Value == RDFType && predicates[j].Value != RDFType
+		})
+
+		body.WriteString(t.term(subject))
+
+		for i, p := range predicates {
+			if i > 0 {
+				body.WriteString(" ;\n   ")
+			}
+
+			if p.Value == RDFType {
+				body.WriteString(" a ")
+			} else {
+				body.WriteString(" " + t.term(p) + " ")
+			}
+
+			for j, o := range objects[p] {
+				if j > 0 {
+					body.WriteString(", ")
+				}
+				body.WriteString(t.term(o))
+			}
+		}
+
+		body.WriteString(" .\n\n")
+	}
+
+	var header bytes.Buffer
+
+	names := make([]string, 0, len(t.used))
+	for name := range t.used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(&header, "@prefix %s: <%s> .\n", name, escapeIRI(prefixes[name]))
+	}
+	if len(names) > 0 {
+		header.WriteString("\n")
+	}
+
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	_, err := w.Write(body.Bytes())
+	return err
+}
+
+type turtleWriter struct {
+	prefixes map[string]string
+	used     map[string]bool
+}
+
+// term writes a term abbreviated with a prefix or as a native literal when possible
+func (t *turtleWriter) term(term Term) string {
+
+	switch term.Kind {
+	case IRI:
+		return t.iri(term.Value)
+	case BlankNode:
+		return "_:" + term.Value
+	}
+
+	switch {
+	case term.Language != "":
+		return `"` + escapeString(term.Value) + `"@` + term.Language
+	case term.Datatype == XSDString:
+		return `"` + escapeString(term.Value) + `"`
+	case term.Datatype == XSDInteger && turtleInteger.MatchString(term.Value),
+		term.Datatype == XSDDecimal && turtleDecimal.MatchString(term.Value),
+		term.Datatype == XSDDouble && turtleDouble.MatchString(term.Value),
+		term.Datatype == XSDBoolean && (term.Value == "true" || term.Value == "false"):
+		return term.Value
+	}
+
+	return `"` + escapeString(term.Value) + `"^^` + t.iri(term.Datatype)
+}
+
+// iri returns the prefixed name of an IRI using the longest matching prefix, or the full IRI
+func (t *turtleWriter) iri(iri string) string {
+
+	best := ""
+	for name, ns := range t.prefixes {
+		if !strings.HasPrefix(iri, ns) || !turtleLocalName.MatchString(iri[len(ns):]) {
+			continue
+		}
+		if best == "" || len(ns) > len(t.prefixes[best]) || (len(ns) == len(t.prefixes[best]) && name < best) {
+			best = name
+		}
+	}
+
+	if best == "" {
+		return "<" + escapeIRI(iri) + ">"
+	}
+
+	t.used[best] = true
+	return best + ":" + iri[len(t.prefixes[best]):]
+}
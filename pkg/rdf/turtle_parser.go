@@ -0,0 +1,800 @@
+//© 2020 By The Rector And Visitors Of The University Of Virginia
+
+//Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package rdf
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var iriScheme = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*:`)
+
+var turtleNumber = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*[eE][+-]?[0-9]+|\.[0-9]+[eE][+-]?[0-9]+|[0-9]*\.[0-9]+|[0-9]+)`)
+
+// ParseTurtle reads a Turtle document, which includes N-Triples documents, resolving relative IRIs against base.
+// The prefixes the document declares are returned along with its triples.
+func ParseTurtle(r io.Reader, base string) (quads []Quad, prefixes map[string]string, err error) {
+
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	p := &turtleParser{
+		input:    string(input),
+		line:     1,
+		base:     base,
+		prefixes: map[string]string{},
+		labels:   map[string]string{},
+	}
+
+	if err = p.parse(); err != nil {
+		return nil, nil, err
+	}
+
+	return p.quads, p.prefixes, nil
+}
+
+// ParseNTriples reads an N-Triples document. It is read as Turtle, so Turtle syntax N-Triples doesn't allow is accepted.
+func ParseNTriples(r io.Reader) ([]Quad, error) {
+	quads, _, err := ParseTurtle(r, "")
+	return quads, err
+}
+
+// ParseNQuads reads an N-Quads document. Like N-Triples it is read with the Turtle grammar, each statement may end
+// with the IRI or blank node of its graph.
+func ParseNQuads(r io.Reader) ([]Quad, error) {
+
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &turtleParser{
+		input:    string(input),
+		line:     1,
+		prefixes: map[string]string{},
+		labels:   map[string]string{},
+		nquads:   true,
+	}
+
+	if err = p.parse(); err != nil {
+		return nil, err
+	}
+
+	return p.quads, nil
+}
+
+type turtleParser struct {
+	input    string
+	pos      int
+	line     int
+	base     string
+	prefixes map[string]string
+	quads    []Quad
+	blanks   int
+	labels   map[string]string
+	// nquads statements are a single triple and a graph
+	nquads bool
+}
+
+func (p *turtleParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: line %d: %s", ErrSyntax, p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *turtleParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *turtleParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *turtleParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(p.input[p.pos:], s)
+}
+
+// hasKeyword matches a case insensitive keyword followed by whitespace
+func (p *turtleParser) hasKeyword(keyword string) bool {
+	end := p.pos + len(keyword)
+	if end >= len(p.input) || !strings.EqualFold(p.input[p.pos:end], keyword) {
+		return false
+	}
+	return strings.ContainsRune(" \t\r\n<", rune(p.input[end]))
+}
+
+func (p *turtleParser) skipSpace() {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *turtleParser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		if p.eof() {
+			return p.errorf("expected '%c' but the document ended", c)
+		}
+		return p.errorf("expected '%c' but found '%c'", c, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *turtleParser) emit(s, pr, o Term) {
+	p.quads = append(p.quads, Quad{Subject: s, Predicate: pr, Object: o})
+}
+
+func (p *turtleParser) newBlank() Term {
+	p.blanks++
+	return NewBlankNode(fmt.Sprintf("t%d", p.blanks))
+}
+
+// blankLabel maps a document's blank node label to a label unique to the parse
+func (p *turtleParser) blankLabel(label string) Term {
+	if mapped, ok := p.labels[label]; ok {
+		return NewBlankNode(mapped)
+	}
+	t := p.newBlank()
+	p.labels[label] = t.Value
+	return t
+}
+
+func (p *turtleParser) parse() error {
+
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil
+		}
+
+		switch {
+		case p.hasPrefix("@prefix"):
+			p.pos += len("@prefix")
+			if err := p.prefixDirective(); err != nil {
+				return err
+			}
+			if err := p.expect('.'); err != nil {
+				return err
+			}
+
+		case p.hasPrefix("@base"):
+			p.pos += len("@base")
+			if err := p.baseDirective(); err != nil {
+				return err
+			}
+			if err := p.expect('.'); err != nil {
+				return err
+			}
+
+		case p.hasKeyword("PREFIX"):
+			p.pos += len("PREFIX")
+			if err := p.prefixDirective(); err != nil {
+				return err
+			}
+
+		case p.hasKeyword("BASE"):
+			p.pos += len("BASE")
+			if err := p.baseDirective(); err != nil {
+				return err
+			}
+
+		case p.nquads:
+			if err := p.quad(); err != nil {
+				return err
+			}
+			if err := p.expect('.'); err != nil {
+				return err
+			}
+
+		default:
+			if err := p.triples(); err != nil {
+				return err
+			}
+			if err := p.expect('.'); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *turtleParser) prefixDirective() error {
+
+	p.skipSpace()
+
+	start := p.pos
+	for !p.eof() && p.peek() != ':' && !isSpace(p.peek()) {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+
+	if err := p.expect(':'); err != nil {
+		return err
+	}
+
+	p.skipSpace()
+	iri, err := p.iriRef()
+	if err != nil {
+		return err
+	}
+
+	p.prefixes[name] = iri
+	return nil
+}
+
+func (p *turtleParser) baseDirective() error {
+
+	p.skipSpace()
+	iri, err := p.iriRef()
+	if err != nil {
+		return err
+	}
+
+	p.base = iri
+	return nil
+}
+
+func (p *turtleParser) triples() error {
+
+	p.skipSpace()
+
+	if p.peek() == '[' {
+		subject, err := p.blankNodePropertyList()
+		if err != nil {
+			return err
+		}
+
+		// a blank node property list may stand alone as a statement
+		p.skipSpace()
+		if p.peek() == '.' {
+			return nil
+		}
+
+		return p.predicateObjectList(subject)
+	}
+
+	subject, err := p.subject()
+	if err != nil {
+		return err
+	}
+
+	return p.predicateObjectList(subject)
+}
+
+// quad reads an N-Quads statement, the graph is left unset for the default graph
+func (p *turtleParser) quad() error {
+
+	subject, err := p.subject()
+	if err != nil {
+		return err
+	}
+
+	p.skipSpace()
+	predicate, err := p.verb()
+	if err != nil {
+		return err
+	}
+
+	p.skipSpace()
+	object, err := p.object()
+	if err != nil {
+		return err
+	}
+
+	var graph Term
+	if p.skipSpace(); p.peek() == '<' || p.hasPrefix("_:") {
+		if graph, err = p.subject(); err != nil {
+			return err
+		}
+	}
+
+	p.quads = append(p.quads, Quad{Subject: subject, Predicate: predicate, Object: object, Graph: graph})
+	return nil
+}
+
+func (p *turtleParser) subject() (Term, error) {
+
+	switch {
+	case p.peek() == '<':
+		iri, err := p.iriRef()
+		return NewIRI(iri), err
+	case p.hasPrefix("_:"):
+		return p.blankNodeLabel()
+	case p.peek() == '(':
+		return p.collection()
+	}
+
+	iri, err := p.prefixedName()
+	return NewIRI(iri), err
+}
+
+func (p *turtleParser) predicateObjectList(subject Term) error {
+
+	for {
+		p.skipSpace()
+
+		predicate, err := p.verb()
+		if err != nil {
+			return err
+		}
+
+		if err = p.objectList(subject, predicate); err != nil {
+			return err
+		}
+
+		p.skipSpace()
+		if p.peek() != ';' {
+			return nil
+		}
+
+		for p.peek() == ';' {
+			p.pos++
+			p.skipSpace()
+		}
+
+		// a trailing ; may end the list
+		if c := p.peek(); c == '.' || c == ']' || p.eof() {
+			return nil
+		}
+	}
+}
+
+func (p *turtleParser) verb() (Term, error) {
+
+	if p.peek() == 'a' && p.pos+1 < len(p.input) && strings.ContainsRune(" \t\r\n<[\"'(_", rune(p.input[p.pos+1])) {
+		p.pos++
+		return NewIRI(RDFType), nil
+	}
+
+	if p.peek() == '<' {
+		iri, err := p.iriRef()
+		return NewIRI(iri), err
+	}
+
+	iri, err := p.prefixedName()
+	return NewIRI(iri), err
+}
+
+func (p *turtleParser) objectList(subject Term, predicate Term) error {
+
+	for {
+		p.skipSpace()
+
+		object, err := p.object()
+		if err != nil {
+			return err
+		}
+		p.emit(subject, predicate, object)
+
+		p.skipSpace()
+		if p.peek() != ',' {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+func (p *turtleParser) object() (Term, error) {
+
+	switch c := p.peek(); {
+	case c == '<':
+		iri, err := p.iriRef()
+		return NewIRI(iri), err
+	case p.hasPrefix("_:"):
+		return p.blankNodeLabel()
+	case c == '[':
+		return p.blankNodePropertyList()
+	case c == '(':
+		return p.collection()
+	case c == '"' || c == '\'':
+		return p.literal()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	case p.hasPrefix("true") || p.hasPrefix("false"):
+		// booleans unless they are the prefix of a prefixed name
+		end := p.pos + 4
+		if p.hasPrefix("false") {
+			end++
+		}
+		if end >= len(p.input) || !isNameChar(rune(p.input[end])) {
+			value := p.input[p.pos:end]
+			p.pos = end
+			return NewLiteral(value, XSDBoolean, ""), nil
+		}
+	case p.eof():
+		return Term{}, p.errorf("expected an object but the document ended")
+	}
+
+	iri, err := p.prefixedName()
+	return NewIRI(iri), err
+}
+
+func (p *turtleParser) blankNodeLabel() (Term, error) {
+
+	p.pos += 2
+	start := p.pos
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+		if !isNameChar(r) {
+			break
+		}
+		p.pos += size
+	}
+
+	// a label can't end in a period
+	for p.pos > start && p.input[p.pos-1] == '.' {
+		p.pos--
+	}
+
+	if p.pos == start {
+		return Term{}, p.errorf("empty blank node label")
+	}
+
+	return p.blankLabel(p.input[start:p.pos]), nil
+}
+
+func (p *turtleParser) blankNodePropertyList() (Term, error) {
+
+	p.pos++ // [
+	subject := p.newBlank()
+
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		return subject, nil
+	}
+
+	if err := p.predicateObjectList(subject); err != nil {
+		return Term{}, err
+	}
+
+	return subject, p.expect(']')
+}
+
+func (p *turtleParser) collection() (Term, error) {
+
+	p.pos++ // (
+
+	var items []Term
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return Term{}, p.errorf("unterminated collection")
+		}
+		if p.peek() == ')' {
+			p.pos++
+			break
+		}
+
+		item, err := p.object()
+		if err != nil {
+			return Term{}, err
+		}
+		items = append(items, item)
+	}
+
+	head := NewIRI(RDFNil)
+	for i := len(items) - 1; i >= 0; i-- {
+		node := p.newBlank()
+		p.emit(node, NewIRI(RDFFirst), items[i])
+		p.emit(node, NewIRI(RDFRest), head)
+		head = node
+	}
+
+	return head, nil
+}
+
+func (p *turtleParser) number() (Term, error) {
+
+	match := turtleNumber.FindString(p.input[p.pos:])
+	if match == "" {
+		return Term{}, p.errorf("invalid number")
+	}
+	p.pos += len(match)
+
+	switch {
+	case strings.ContainsAny(match, "eE"):
+		return NewLiteral(match, XSDDouble, ""), nil
+	case strings.Contains(match, "."):
+		return NewLiteral(match, XSDDecimal, ""), nil
+	}
+
+	return NewLiteral(match, XSDInteger, ""), nil
+}
+
+func (p *turtleParser) literal() (Term, error) {
+
+	value, err := p.quotedString()
+	if err != nil {
+		return Term{}, err
+	}
+
+	switch {
+	case p.peek() == '@':
+		p.pos++
+		start := p.pos
+		for !p.eof() && (isAlphaNum(p.peek()) || p.peek() == '-') {
+			p.pos++
+		}
+		if p.pos == start {
+			return Term{}, p.errorf("empty language tag")
+		}
+		return NewLiteral(value, "", strings.ToLower(p.input[start:p.pos])), nil
+
+	case p.hasPrefix("^^"):
+		p.pos += 2
+		var datatype string
+		if p.peek() == '<' {
+			datatype, err = p.iriRef()
+		} else {
+			datatype, err = p.prefixedName()
+		}
+		return NewLiteral(value, datatype, ""), err
+	}
+
+	return NewLiteral(value, "", ""), nil
+}
+
+func (p *turtleParser) quotedString() (string, error) {
+
+	quote := p.input[p.pos : p.pos+1]
+	long := p.hasPrefix(strings.Repeat(quote, 3))
+
+	if long {
+		p.pos += 3
+	} else {
+		p.pos++
+	}
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+
+		if long && p.hasPrefix(strings.Repeat(quote, 3)) {
+			// a long string may end with up to two more quotes
+			for p.pos+3 < len(p.input) && p.input[p.pos+3:p.pos+4] == quote {
+				b.WriteString(quote)
+				p.pos++
+			}
+			p.pos += 3
+			return b.String(), nil
+		}
+
+		c := p.peek()
+		switch {
+		case !long && c == quote[0]:
+			p.pos++
+			return b.String(), nil
+		case !long && (c == '\n' || c == '\r'):
+			return "", p.errorf("line break in string")
+		case c == '\\':
+			r, err := p.escape(true)
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+			b.WriteRune(r)
+			p.pos += size
+		}
+	}
+}
+
+// escape decodes the escape sequence at the current position, string escapes are only allowed in strings
+func (p *turtleParser) escape(stringEscapes bool) (rune, error) {
+
+	if p.pos+1 >= len(p.input) {
+		return 0, p.errorf("incomplete escape")
+	}
+
+	c := p.input[p.pos+1]
+	p.pos += 2
+
+	switch c {
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.input) {
+			return 0, p.errorf("incomplete unicode escape")
+		}
+		code, err := strconv.ParseUint(p.input[p.pos:p.pos+n], 16, 32)
+		if err != nil {
+			return 0, p.errorf("invalid unicode escape")
+		}
+		p.pos += n
+		return rune(code), nil
+	}
+
+	if stringEscapes {
+		switch c {
+		case 't':
+			return '\t', nil
+		case 'b':
+			return '\b', nil
+		case 'n':
+			return '\n', nil
+		case 'r':
+			return '\r', nil
+		case 'f':
+			return '\f', nil
+		case '"', '\'', '\\':
+			return rune(c), nil
+		}
+	}
+
+	return 0, p.errorf("invalid escape \\%c", c)
+}
+
+func (p *turtleParser) iriRef() (string, error) {
+
+	if p.peek() != '<' {
+		return "", p.errorf("expected an IRI")
+	}
+	p.pos++
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated IRI")
+		}
+
+		c := p.peek()
+		switch {
+		case c == '>':
+			p.pos++
+			return p.resolve(b.String()), nil
+		case c == '\\':
+			r, err := p.escape(false)
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+		case c <= ' ' || strings.IndexByte("<\"{}|^`", c) >= 0:
+			return "", p.errorf("invalid character in IRI")
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *turtleParser) prefixedName() (string, error) {
+
+	start := p.pos
+	for !p.eof() && p.peek() != ':' {
+		r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+		if !isNameChar(r) || r == '.' && p.pos == start {
+			break
+		}
+		p.pos += size
+	}
+
+	if p.peek() != ':' {
+		p.pos = start
+		if p.eof() {
+			return "", p.errorf("expected a term but the document ended")
+		}
+		return "", p.errorf("unexpected '%c'", p.peek())
+	}
+
+	prefix := p.input[start:p.pos]
+	ns, ok := p.prefixes[prefix]
+	if !ok {
+		return "", p.errorf("undefined prefix %s", prefix)
+	}
+	p.pos++
+
+	var local strings.Builder
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+
+		switch {
+		case r == '\\' && p.pos+1 < len(p.input):
+			// reserved characters are escaped with a backslash
+			local.WriteByte(p.input[p.pos+1])
+			p.pos += 2
+			continue
+		case r == '%' || r == ':' || isNameChar(r):
+			local.WriteRune(r)
+			p.pos += size
+			continue
+		}
+		break
+	}
+
+	// a local name can't end in a period, it ends the statement
+	name := local.String()
+	for strings.HasSuffix(name, ".") {
+		name = name[:len(name)-1]
+		p.pos--
+	}
+
+	return ns + name, nil
+}
+
+// resolve resolves a relative IRI against the base
+func (p *turtleParser) resolve(iri string) string {
+	return ResolveIRI(p.base, iri)
+}
+
+// ResolveIRI resolves ref against base. Base may be an opaque IRI such as an ARK, which only
+// the empty reference and fragments can be resolved against.
+func ResolveIRI(base string, ref string) string {
+
+	if base == "" || iriScheme.MatchString(ref) {
+		return ref
+	}
+
+	if ref == "" {
+		if i := strings.Index(base, "#"); i >= 0 {
+			return base[:i]
+		}
+		return base
+	}
+
+	if strings.HasPrefix(ref, "#") {
+		if i := strings.Index(base, "#"); i >= 0 {
+			base = base[:i]
+		}
+		return base + ref
+	}
+
+	b, err := url.Parse(base)
+	if err != nil || b.Opaque != "" {
+		return ref
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+
+	return b.ResolveReference(r).String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isAlphaNum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// isNameChar reports whether r may appear in a prefix, local name or blank node label
+func isNameChar(r rune) bool {
+	return r == '_' || r == '-' || r == '.' || r == 0xB7 || unicode.IsLetter(r) || unicode.IsDigit(r)
+}